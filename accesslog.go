@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/contester/advfiler/hashes"
+	log "github.com/sirupsen/logrus"
+)
+
+type requestIDKey struct{}
+
+// withRequestID attaches the request ID to ctx for requestLog.
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestID returns the ID withAccessLog gave the request, or else the
+// caller's X-Request-Id, or a fresh random one.
+func requestID(r *http.Request) string {
+	if v, ok := r.Context().Value(requestIDKey{}).(string); ok {
+		return v
+	}
+	if v := r.Header.Get("X-Request-Id"); validRequestID(v) {
+		return v
+	}
+	return newRequestID()
+}
+
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID keeps what callers send as X-Request-Id short and free of
+// anything that would garble a log line.
+func validRequestID(v string) bool {
+	if v == "" || len(v) > 128 {
+		return false
+	}
+	for _, c := range []byte(v) {
+		if c <= ' ' || c > '~' || c == '"' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// requestLog returns the logger for lines about the request served with
+// ctx, tagged with its request ID.
+func requestLog(ctx context.Context) *log.Entry {
+	if v, ok := ctx.Value(requestIDKey{}).(string); ok {
+		return log.WithField("request_id", v)
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+type accessRecordKey struct{}
+
+// accessRecord collects what the Store learns about the files a request
+// reads and writes, for its access log line.
+type accessRecord struct {
+	mu         sync.Mutex
+	files      int
+	hardlinked bool
+	blake3     []byte
+}
+
+// noteAccess records a file read or written with ctx.
+func noteAccess(ctx context.Context, d hashes.Digests, hardlinked bool) {
+	rec, _ := ctx.Value(accessRecordKey{}).(*accessRecord)
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.files++
+	rec.hardlinked = rec.hardlinked || hardlinked
+	rec.blake3 = d.Blake3
+}
+
+// newAccessLogger returns a JSON logger writing to path, or to stderr if
+// path is empty.
+func newAccessLogger(path string) (*log.Logger, error) {
+	l := log.New()
+	l.Formatter = &log.JSONFormatter{}
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+		if err != nil {
+			return nil, err
+		}
+		l.Out = f
+	}
+	return l, nil
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+type countingBody struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
+
+// withAccessLog gives every request an X-Request-Id, taken from the caller
+// or made up, and writes a line to out for each one served by h. The digest
+// and hardlinked flag are logged for requests touching a single file.
+func withAccessLog(h http.Handler, ac AuthCheck, out *log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rid := r.Header.Get("X-Request-Id")
+		if !validRequestID(rid) {
+			rid = newRequestID()
+		}
+		w.Header().Set("X-Request-Id", rid)
+		rec := &accessRecord{}
+		r = r.WithContext(context.WithValue(withRequestID(r.Context(), rid), accessRecordKey{}, rec))
+		body := &countingBody{ReadCloser: r.Body}
+		r.Body = body
+		sw := &statusWriter{ResponseWriter: w}
+
+		h.ServeHTTP(sw, r)
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		fields := log.Fields{
+			"request_id": rid,
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"status":     sw.status,
+			"bytes_in":   body.n.Load(),
+			"bytes_out":  sw.bytes,
+			"duration":   time.Since(start).Seconds(),
+			"identity":   ac.Identify(tokenFromHeader(r)),
+			"remote":     r.RemoteAddr,
+		}
+		rec.mu.Lock()
+		if rec.files == 1 {
+			fields["hardlinked"] = rec.hardlinked
+			fields["digest"] = "blake3:" + hex.EncodeToString(rec.blake3)
+		} else if rec.files > 1 {
+			fields["files"] = rec.files
+		}
+		rec.mu.Unlock()
+		out.WithFields(fields).Info("access")
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestAccessLog(t *testing.T) {
+	s := newTestStore(t)
+	ac := NewAuthChecker([]string{"tok"}, nil, map[string]string{"judge": "tok"})
+	var out bytes.Buffer
+	al, _ := newAccessLogger("")
+	al.Out = &out
+	srv := httptest.NewServer(withAccessLog(NewFiler(s, ac), ac, al))
+	defer srv.Close()
+
+	content := strings.Repeat("x", 100)
+	if _, err := s.Upload(context.Background(), FileInfo{Name: "a"}, strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	req := authorized(t, http.MethodPut, srv.URL+"/fs/b", strings.NewReader(content))
+	req.Header.Set("X-Request-Id", "caller-id")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st UploadStatus
+	json.NewDecoder(resp.Body).Decode(&st)
+	resp.Body.Close()
+	if resp.Header.Get("X-Request-Id") != "caller-id" {
+		t.Errorf("request ID not propagated: %v", resp.Header)
+	}
+
+	resp, err = http.DefaultClient.Get(srv.URL + "/fs/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	generated := resp.Header.Get("X-Request-Id")
+	if generated == "" {
+		t.Error("no request ID generated")
+	}
+
+	var lines []map[string]any
+	dec := json.NewDecoder(&out)
+	for {
+		var m map[string]any
+		if err := dec.Decode(&m); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, m)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("access log: %v", lines)
+	}
+	put, get := lines[0], lines[1]
+	if put["request_id"] != "caller-id" || put["method"] != "PUT" || put["path"] != "/fs/b" || put["status"] != 200.0 ||
+		put["bytes_in"] != 100.0 || put["bytes_out"] == 0.0 || put["identity"] != "judge" ||
+		put["hardlinked"] != st.Hardlinked || put["digest"] != "blake3:"+hex.EncodeToString(blake3Sum([]byte(content))) {
+		t.Errorf("upload line: %v", put)
+	}
+	if get["request_id"] != generated || get["status"] != 401.0 || get["identity"] != "anonymous" {
+		t.Errorf("unauthorized line: %v", get)
+	}
+	if _, ok := get["digest"]; ok {
+		t.Errorf("digest logged for a file not read: %v", get)
+	}
+
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	requestLog(withRequestID(context.Background(), "rid")).Error("failed")
+	if e := hook.LastEntry(); e == nil || e.Data["request_id"] != "rid" || e.Level != log.ErrorLevel {
+		t.Errorf("request log entry: %+v", e)
+	}
+}
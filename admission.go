@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTooLarge is returned by Upload for files over the size limit of
+	// their prefix.
+	ErrTooLarge = errors.New("file too large")
+	// ErrOverloaded is returned by Upload when too many uploads are in
+	// flight, or they hold too much memory; the client should retry later.
+	ErrOverloaded = errors.New("too many uploads in flight")
+	// errLengthMismatch is returned by Upload when the body isn't as long
+	// as FileInfo.ContentLength says.
+	errLengthMismatch = errors.New("received size doesn't match the declared length")
+)
+
+// overloadRetryAfter is the Retry-After sent with ErrOverloaded responses.
+const overloadRetryAfter = 5 * time.Second
+
+// UploadLimits bound what Upload accepts. Zero values mean no limit.
+// Replication writes aren't limited; the primary has already taken them.
+type UploadLimits struct {
+	// MaxFileSize applies to paths that no PrefixMaxFileSize key is a
+	// prefix of; among those that are, the longest one wins.
+	MaxFileSize       int64
+	PrefixMaxFileSize map[string]int64
+	// MaxUploads is the number of uploads Store takes at once.
+	MaxUploads int
+	// MaxMemory caps the bytes held by uploads in flight. Upload keeps the
+	// whole body in memory until it commits.
+	MaxMemory int64
+	// MaxArchiveSize caps a zip import, which is spooled to a temporary
+	// file before its entries are read.
+	MaxArchiveSize int64
+}
+
+func (l *UploadLimits) maxFileSize(path string) int64 {
+	limit, best := l.MaxFileSize, -1
+	for prefix, v := range l.PrefixMaxFileSize {
+		if len(prefix) > best && strings.HasPrefix(path, prefix) {
+			limit, best = v, len(prefix)
+		}
+	}
+	return limit
+}
+
+// maxSessionSize is the most an upload session may hold: the largest file
+// Upload takes under any path, within the memory budget. Zero means no
+// limit.
+func (l *UploadLimits) maxSessionSize() int64 {
+	limit := l.MaxFileSize
+	for _, v := range l.PrefixMaxFileSize {
+		if limit == 0 || v == 0 {
+			limit = 0
+			break
+		}
+		limit = max(limit, v)
+	}
+	if l.MaxMemory > 0 && (limit == 0 || l.MaxMemory < limit) {
+		limit = l.MaxMemory
+	}
+	return limit
+}
+
+// admission tracks the uploads in flight against UploadLimits.
+type admission struct {
+	limits UploadLimits
+
+	mu       sync.Mutex
+	uploads  int
+	reserved int64
+}
+
+// SetUploadLimits replaces the limits on Upload.
+func (s *Store) SetUploadLimits(l UploadLimits) {
+	s.admission.mu.Lock()
+	defer s.admission.mu.Unlock()
+	s.admission.limits = l
+}
+
+// maxArchiveSize is UploadLimits.MaxArchiveSize.
+func (a *admission) maxArchiveSize() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.limits.MaxArchiveSize
+}
+
+// checkSessionSize rejects upload sessions that could never be stored.
+func (a *admission) checkSessionSize(size int64) error {
+	a.mu.Lock()
+	limit := a.limits.maxSessionSize()
+	a.mu.Unlock()
+	if limit > 0 && size > limit {
+		return fmt.Errorf("%w: %d bytes, at most %d allowed", ErrTooLarge, size, limit)
+	}
+	return nil
+}
+
+func (a *admission) enter() (UploadLimits, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.limits.MaxUploads > 0 && a.uploads >= a.limits.MaxUploads {
+		return UploadLimits{}, ErrOverloaded
+	}
+	a.uploads++
+	return a.limits, nil
+}
+
+func (a *admission) leave(reserved int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.uploads--
+	a.reserved -= reserved
+}
+
+// reserve takes n more bytes of the memory budget for an upload that will
+// then hold total. An upload that can never fit is ErrTooLarge rather than
+// ErrOverloaded, which clients retry.
+func (a *admission) reserve(n, total int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.limits.MaxMemory > 0 && total > a.limits.MaxMemory {
+		return fmt.Errorf("%w: %d bytes is over the upload memory budget of %d bytes", ErrTooLarge, total, a.limits.MaxMemory)
+	}
+	if a.limits.MaxMemory > 0 && a.reserved+n > a.limits.MaxMemory {
+		return fmt.Errorf("%w: upload memory budget of %d bytes exhausted", ErrOverloaded, a.limits.MaxMemory)
+	}
+	a.reserved += n
+	return nil
+}
+
+// readUpload reads an upload body within the limits for path, rejecting
+// bodies that don't match a declared length (when positive). The memory
+// budget is charged for the buffer's capacity. The returned function gives
+// the slot and memory back.
+func (a *admission) readUpload(ctx context.Context, path string, declared int64, body io.Reader) ([]byte, func(), error) {
+	if ctx.Value(replicationWriteKey{}) != nil {
+		data, err := io.ReadAll(body)
+		return data, func() {}, err
+	}
+	limits, err := a.enter()
+	if err != nil {
+		return nil, nil, err
+	}
+	var reserved int64
+	done := func() { a.leave(reserved) }
+	fail := func(err error) ([]byte, func(), error) {
+		done()
+		return nil, nil, err
+	}
+
+	maxSize := limits.maxFileSize(path)
+	if maxSize > 0 && declared > maxSize {
+		return fail(fmt.Errorf("%w: %d bytes, at most %d allowed under %q", ErrTooLarge, declared, maxSize, path))
+	}
+	if declared > 0 {
+		if err := a.reserve(declared, declared); err != nil {
+			return fail(err)
+		}
+		reserved = declared
+		buf := make([]byte, declared)
+		if n, err := io.ReadFull(body, buf); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return fail(fmt.Errorf("%w: got %d bytes, expected %d", errLengthMismatch, n, declared))
+			}
+			return fail(fmt.Errorf("reading body: %w", err))
+		}
+		// One more byte tells a longer body from an exact one.
+		if err := readPastEnd(body); err != nil {
+			if errors.Is(err, errBodyTooLong) {
+				return fail(fmt.Errorf("%w: more than the %d bytes declared", errLengthMismatch, declared))
+			}
+			return fail(err)
+		}
+		return buf, done, nil
+	}
+
+	// Without a declared length the buffer grows by doubling, up to the
+	// smaller of the file size limit and the memory budget.
+	ceiling := limits.MaxMemory
+	if maxSize > 0 && (ceiling == 0 || maxSize < ceiling) {
+		ceiling = maxSize
+	}
+	var buf []byte
+	for {
+		if len(buf) == cap(buf) {
+			if ceiling > 0 && int64(len(buf)) >= ceiling {
+				err := readPastEnd(body)
+				if err == nil {
+					break
+				}
+				if errors.Is(err, errBodyTooLong) {
+					if ceiling == maxSize {
+						return fail(fmt.Errorf("%w: more than %d bytes under %q", ErrTooLarge, maxSize, path))
+					}
+					return fail(fmt.Errorf("%w: more than the upload memory budget of %d bytes", ErrTooLarge, ceiling))
+				}
+				return fail(err)
+			}
+			size := max(2*int64(cap(buf)), 64<<10)
+			if ceiling > 0 {
+				size = min(size, ceiling)
+			}
+			if err := a.reserve(size-reserved, size); err != nil {
+				return fail(err)
+			}
+			reserved = size
+			grown := make([]byte, len(buf), size)
+			copy(grown, buf)
+			buf = grown
+		}
+		n, err := body.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(fmt.Errorf("reading body: %w", err))
+		}
+	}
+	return buf, done, nil
+}
+
+// errBodyTooLong is returned by readPastEnd when body has more to read.
+var errBodyTooLong = errors.New("body too long")
+
+// readPastEnd checks that body has nothing left.
+func readPastEnd(body io.Reader) error {
+	var one [1]byte
+	switch _, err := io.ReadFull(body, one[:]); {
+	case err == nil:
+		return errBodyTooLong
+	case errors.Is(err, io.EOF):
+		return nil
+	default:
+		return fmt.Errorf("reading body: %w", err)
+	}
+}
+
+// retryAfterWriter adds Retry-After to 503 responses.
+type retryAfterWriter struct {
+	http.ResponseWriter
+}
+
+func (w retryAfterWriter) WriteHeader(code int) {
+	if code == http.StatusServiceUnavailable && w.Header().Get("Retry-After") == "" {
+		w.Header().Set("Retry-After", strconv.Itoa(int(overloadRetryAfter/time.Second)))
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w retryAfterWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// withRetryAfter makes every 503 from h tell the client when to come back.
+func withRetryAfter(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(retryAfterWriter{w}, r)
+	})
+}
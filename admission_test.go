@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockingReader returns its content, then blocks until release is closed.
+type blockingReader struct {
+	io.Reader
+	release chan struct{}
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		<-r.release
+	}
+	return n, err
+}
+
+func TestUploadLimits(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	s.SetUploadLimits(UploadLimits{
+		MaxFileSize:       10,
+		PrefixMaxFileSize: map[string]int64{"big/": 100, "big/small/": 3},
+	})
+
+	for _, c := range []struct {
+		name     string
+		declared int64
+		body     string
+		err      error
+	}{
+		{"a", 0, "0123456789", nil},
+		{"a", 0, "0123456789a", ErrTooLarge},
+		{"a", 11, "0123456789a", ErrTooLarge},
+		{"big/a", 0, strings.Repeat("x", 100), nil},
+		{"big/small/a", 0, "xxxx", ErrTooLarge},
+		{"b", 5, "abc", errLengthMismatch},
+		{"b", 2, "abc", errLengthMismatch},
+		{"b", 3, "abc", nil},
+	} {
+		_, err := s.Upload(ctx, FileInfo{Name: c.name, ContentLength: c.declared}, strings.NewReader(c.body))
+		if !errors.Is(err, c.err) || (c.err == nil) != (err == nil) {
+			t.Errorf("%s (%d declared, %d sent): %v, want %v", c.name, c.declared, len(c.body), err, c.err)
+		}
+	}
+	if _, err := s.Stat(ctx, "b"); err != nil {
+		t.Errorf("exact upload: %v", err)
+	}
+
+	// Replicated writes have already been admitted on the primary.
+	if _, err := s.Upload(withReplicationWrite(ctx), FileInfo{Name: "r"}, strings.NewReader(strings.Repeat("x", 50))); err != nil {
+		t.Errorf("replication write: %v", err)
+	}
+}
+
+func TestUploadAdmission(t *testing.T) {
+	s, srv := newTestServer(t)
+	ctx := context.Background()
+	s.SetUploadLimits(UploadLimits{MaxUploads: 1, MaxMemory: 8, PrefixMaxFileSize: map[string]int64{"limited/": 4}})
+
+	br := &blockingReader{Reader: strings.NewReader("abc"), release: make(chan struct{})}
+	done := make(chan error)
+	go func() {
+		_, err := s.Upload(ctx, FileInfo{Name: "slow"}, br)
+		done <- err
+	}()
+	// Wait for the slow upload to take the only slot.
+	for {
+		s.admission.mu.Lock()
+		n := s.admission.uploads
+		s.admission.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	resp, err := http.DefaultClient.Do(authorized(t, http.MethodPut, srv.URL+"/fs/fast", strings.NewReader("x")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("over the upload limit: %s %v", resp.Status, resp.Header)
+	}
+	close(br.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	s.SetUploadLimits(UploadLimits{MaxMemory: 8, PrefixMaxFileSize: map[string]int64{"limited/": 4}})
+	br = &blockingReader{Reader: strings.NewReader("abc"), release: make(chan struct{})}
+	go func() {
+		_, err := s.Upload(ctx, FileInfo{Name: "slow"}, br)
+		done <- err
+	}()
+	// Wait for the slow upload to take the whole budget for its buffer.
+	for {
+		s.admission.mu.Lock()
+		n := s.admission.reserved
+		s.admission.mu.Unlock()
+		if n == 8 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := s.Upload(ctx, FileInfo{Name: "small", ContentLength: 4}, strings.NewReader("1234")); !errors.Is(err, ErrOverloaded) {
+		t.Errorf("over the memory budget left: %v", err)
+	}
+	close(br.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// Bodies bigger than the whole budget won't fit on a retry either.
+	if _, err := s.Upload(ctx, FileInfo{Name: "huge", ContentLength: 9}, strings.NewReader("123456789")); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("declared over the memory budget: %v", err)
+	}
+	if _, err := s.Upload(ctx, FileInfo{Name: "huge"}, strings.NewReader("123456789")); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("undeclared over the memory budget: %v", err)
+	}
+	if _, err := s.Upload(ctx, FileInfo{Name: "fits"}, strings.NewReader("12345678")); err != nil {
+		t.Errorf("undeclared within the memory budget: %v", err)
+	}
+	if s.admission.uploads != 0 || s.admission.reserved != 0 {
+		t.Errorf("leaked %d uploads, %d bytes", s.admission.uploads, s.admission.reserved)
+	}
+
+	for _, c := range []struct {
+		path, body, declared string
+		status               int
+	}{
+		{"limited/a", "12345", "", http.StatusRequestEntityTooLarge},
+		{"huge", "123456789", "9", http.StatusRequestEntityTooLarge},
+		{"limited/a", "123", "4", http.StatusBadRequest},
+		{"limited/a", "1234", "4", http.StatusOK},
+	} {
+		req := authorized(t, http.MethodPut, srv.URL+"/fs/"+c.path, io.NopCloser(strings.NewReader(c.body)))
+		if c.declared != "" {
+			req.Header.Set("X-Fs-Content-Length", c.declared)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Errorf("%s with %q: %s, want %d", c.path, c.body, resp.Status, c.status)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	pb "github.com/contester/advfiler/protos"
+	"github.com/dgraph-io/badger/v4"
+)
+
+// User-defined attributes are small key/value strings kept in a file's
+// DirectoryEntry: the compiler version, the generator command, the checker
+// verdict and the like. Over HTTP they travel as X-Fs-Meta-<key> headers,
+// and keys are always lowercase.
+
+const (
+	attributeHeaderPrefix = "X-Fs-Meta-"
+	// attributeXattrPrefix names attributes in tar archives, as
+	// SCHILY.xattr.user.fs_meta.<key> PAX records.
+	attributeXattrPrefix = "user.fs_meta."
+
+	// maxAttributesSize bounds the total length of a file's keys and values.
+	maxAttributesSize = 8 << 10
+)
+
+var errInvalidAttributes = errors.New("invalid attributes")
+
+func validAttributeKey(k string) bool {
+	if k == "" {
+		return false
+	}
+	for i := 0; i < len(k); i++ {
+		c := k[i]
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// validAttributeValue accepts UTF-8 that can be sent in a header as is.
+func validAttributeValue(v string) bool {
+	if !utf8.ValidString(v) {
+		return false
+	}
+	for _, c := range v {
+		if c < 0x20 || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func validateAttributes(attrs map[string]string) error {
+	var size int
+	for k, v := range attrs {
+		if !validAttributeKey(k) {
+			return fmt.Errorf("%w: bad key %q", errInvalidAttributes, k)
+		}
+		if v == "" || !validAttributeValue(v) {
+			return fmt.Errorf("%w: bad value for %q", errInvalidAttributes, k)
+		}
+		size += len(k) + len(v)
+	}
+	if size > maxAttributesSize {
+		return fmt.Errorf("%w: %d bytes, at most %d allowed", errInvalidAttributes, size, maxAttributesSize)
+	}
+	return nil
+}
+
+// attributesFromHeader collects X-Fs-Meta-* headers, empty values included.
+// Returns nil if there are none.
+func attributesFromHeader(h http.Header) map[string]string {
+	var attrs map[string]string
+	for k, v := range h {
+		name, ok := strings.CutPrefix(http.CanonicalHeaderKey(k), attributeHeaderPrefix)
+		if !ok || len(v) == 0 {
+			continue
+		}
+		if attrs == nil {
+			attrs = make(map[string]string)
+		}
+		attrs[strings.ToLower(name)] = v[0]
+	}
+	return attrs
+}
+
+func addAttributeHeaders(h http.Header, attrs map[string]string) {
+	for k, v := range attrs {
+		h.Set(attributeHeaderPrefix+k, v)
+	}
+}
+
+// attributesFromXattrs picks attributes out of tar extended attributes.
+func attributesFromXattrs(xattrs map[string]string) map[string]string {
+	var attrs map[string]string
+	for k, v := range xattrs {
+		if name, ok := strings.CutPrefix(k, attributeXattrPrefix); ok {
+			if attrs == nil {
+				attrs = make(map[string]string)
+			}
+			attrs[name] = v
+		}
+	}
+	return attrs
+}
+
+// UpdateAttributes merges update into the attributes of the file at path,
+// removing the keys whose value is empty, and returns the result. The
+// content and its timestamp are left alone.
+func (s *Store) UpdateAttributes(ctx context.Context, path string, update map[string]string) (map[string]string, error) {
+	if err := s.checkWritable(ctx); err != nil {
+		return nil, err
+	}
+	var result map[string]string
+	err := s.update(func(tx *badger.Txn) error {
+		de, err := getProto[pb.DirectoryEntry](tx, dirMetaKey(path))
+		if err == badger.ErrKeyNotFound {
+			return fs.ErrNotExist
+		}
+		if err != nil {
+			return fmt.Errorf("reading dir entry: %w", err)
+		}
+		if err := checkEntryPrecondition(ctx, de); err != nil {
+			return err
+		}
+		attrs := maps.Clone(de.GetAttributes())
+		if attrs == nil {
+			attrs = make(map[string]string)
+		}
+		for k, v := range update {
+			if v == "" {
+				delete(attrs, k)
+			} else {
+				attrs[k] = v
+			}
+		}
+		if err := validateAttributes(attrs); err != nil {
+			return err
+		}
+		de.SetAttributes(attrs)
+
+		h := de.GetBlake3Hash()
+		if len(h) == 0 {
+			h = emptyDigests.Blake3
+		}
+		if err := recordAudit(ctx, tx, AuditAttributes, path, h, h); err != nil {
+			return fmt.Errorf("writing audit record: %w", err)
+		}
+		result = attrs
+		return setProtoMeta(tx, dirMetaKey(path), de, entryMetaReplaced)
+	})
+	return result, err
+}
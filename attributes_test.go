@@ -0,0 +1,108 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/contester/advfiler/client"
+)
+
+func TestStoreAttributes(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	data := strings.Repeat("x", 100)
+
+	// The second upload externalizes the blob, rewriting the first entry.
+	if _, err := s.Upload(ctx, FileInfo{Name: "a", Attributes: map[string]string{"compiler": "gcc 14"}}, strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Upload(ctx, FileInfo{Name: "b", Attributes: map[string]string{"verdict": "ok"}}, strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if dr, err := s.Stat(ctx, "a"); err != nil || dr.Attributes["compiler"] != "gcc 14" {
+		t.Errorf("a: %v %v", dr.Attributes, err)
+	}
+
+	attrs, err := s.UpdateAttributes(ctx, "b", map[string]string{"verdict": "", "host": "h1"})
+	if err != nil || !maps.Equal(attrs, map[string]string{"host": "h1"}) {
+		t.Errorf("update: %v %v", attrs, err)
+	}
+	if err := s.Download(ctx, "b", func(dr DownloadResult) error {
+		body, _ := io.ReadAll(dr.Body)
+		if string(body) != data || !maps.Equal(dr.Attributes, attrs) {
+			t.Errorf("download after update: %q %v", body, dr.Attributes)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.UpdateAttributes(ctx, "b", map[string]string{"Bad Key": "v"}); !errors.Is(err, errInvalidAttributes) {
+		t.Errorf("expected errInvalidAttributes, got %v", err)
+	}
+	big := map[string]string{"k": strings.Repeat("v", maxAttributesSize)}
+	if _, err := s.Upload(ctx, FileInfo{Name: "c", Attributes: big}, strings.NewReader("c")); !errors.Is(err, errInvalidAttributes) {
+		t.Errorf("expected errInvalidAttributes, got %v", err)
+	}
+	if _, err := s.UpdateAttributes(ctx, "missing", map[string]string{"k": "v"}); err == nil {
+		t.Error("updating a missing file succeeded")
+	}
+}
+
+func TestAttributesHTTP(t *testing.T) {
+	_, srv := newTestServer(t)
+	c := client.New(srv.URL, "tok")
+	ctx := context.Background()
+
+	resp, _ := doRequest(t, authorized(t, http.MethodPut, srv.URL+"/fs/p/1/output", strings.NewReader("out")),
+		"X-Fs-Meta-Checker-Verdict", "OK", "X-Fs-Meta-Generator", "gen 1 2")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("put: %s", resp.Status)
+	}
+	fi, err := c.Stat(ctx, "p/1/output")
+	if err != nil || !maps.Equal(fi.Attributes, map[string]string{"checker-verdict": "OK", "generator": "gen 1 2"}) {
+		t.Errorf("stat: %v %v", fi, err)
+	}
+
+	attrs, err := c.SetAttributes(ctx, "p/1/output", map[string]string{"generator": "", "host": "judge1"})
+	if err != nil || !maps.Equal(attrs, map[string]string{"checker-verdict": "OK", "host": "judge1"}) {
+		t.Errorf("set attributes: %v %v", attrs, err)
+	}
+	if resp, _ := doRequest(t, authorized(t, http.MethodPatch, srv.URL+"/fs/p/1/output", nil), "X-Fs-Meta-Big", strings.Repeat("v", maxAttributesSize)); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("oversized attributes: %s", resp.Status)
+	}
+
+	_, body := doRequest(t, authorized(t, http.MethodGet, srv.URL+"/fs/p/?format=json", nil))
+	var entries []listEntry
+	if err := json.Unmarshal([]byte(body), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != "p/1/output" || entries[0].Size != 3 ||
+		entries[0].Attributes["host"] != "judge1" || entries[0].Digests["BLAKE3"] == "" {
+		t.Errorf("json listing: %+v", entries)
+	}
+
+	// Attributes survive a tar export and import.
+	_, tb := doRequest(t, authorized(t, http.MethodGet, srv.URL+"/tar/?path=p/", nil))
+	tr := tar.NewReader(strings.NewReader(tb))
+	h, err := tr.Next()
+	if err != nil || h.PAXRecords["SCHILY.xattr.user.fs_meta.host"] != "judge1" {
+		t.Fatalf("tar header: %+v %v", h, err)
+	}
+	if err := c.Delete(ctx, "p/1/output"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.TarImport(ctx, strings.NewReader(tb), ""); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := c.Stat(ctx, "p/1/output"); err != nil || !maps.Equal(fi.Attributes, attrs) {
+		t.Errorf("after tar import: %v %v", fi, err)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/contester/advfiler/protos"
+	"github.com/dgraph-io/badger/v4"
+	"google.golang.org/protobuf/proto"
+	"lukechampine.com/blake3"
+)
+
+// Key prefix for the audit log.
+const prefixAudit byte = 0x07
+
+// Audit actions.
+const (
+	AuditUpload     = "upload"
+	AuditDelete     = "delete"
+	AuditWipe       = "wipe"
+	AuditTarImport  = "tar-import"
+	AuditZipImport  = "zip-import"
+	AuditManifest   = "manifest-set"
+	AuditContestXML = "contest-xml-set"
+	AuditProblemXML = "problem-xml-set"
+	AuditAttributes = "attributes-set"
+)
+
+var auditSeq atomic.Uint32
+
+// auditKey: 0x07 + be64(unix nanos) + be32(seq), so keys sort by time.
+func auditKey(ts int64, seq uint32) []byte {
+	k := make([]byte, 13)
+	k[0] = prefixAudit
+	binary.BigEndian.PutUint64(k[1:], uint64(ts))
+	binary.BigEndian.PutUint32(k[9:], seq)
+	return k
+}
+
+// AuditActor identifies who is behind a mutating Store call.
+type AuditActor struct {
+	Identity   string
+	RemoteAddr string
+	RequestID  string
+	// Action, if set, overrides the Store's own action name, e.g. so deletes
+	// issued by a wipe are logged as such.
+	Action string
+}
+
+type auditActorKey struct{}
+
+// WithAuditActor attaches the actor to ctx for Store methods to record.
+func WithAuditActor(ctx context.Context, a AuditActor) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, a)
+}
+
+func auditActorFrom(ctx context.Context) AuditActor {
+	a, _ := ctx.Value(auditActorKey{}).(AuditActor)
+	if a.Identity == "" {
+		a.Identity = "local"
+	}
+	return a
+}
+
+func blake3Sum(b []byte) []byte {
+	h := blake3.Sum256(b)
+	return h[:]
+}
+
+// recordAudit writes an audit record inside the mutating transaction, so the
+// log and the change commit (or fail) together.
+func recordAudit(ctx context.Context, tx *badger.Txn, action, path string, oldBlake3, newBlake3 []byte) error {
+	a := auditActorFrom(ctx)
+	if a.Action != "" {
+		action = a.Action
+	}
+	now := time.Now().UnixNano()
+	rec := pb.AuditRecord_builder{
+		TimestampUnixNano: proto.Int64(now),
+		Identity:          proto.String(a.Identity),
+		Action:            proto.String(action),
+		Path:              proto.String(path),
+		OldBlake3:         oldBlake3,
+		NewBlake3:         newBlake3,
+		RemoteAddr:        proto.String(a.RemoteAddr),
+		RequestId:         proto.String(a.RequestID),
+	}.Build()
+	return setProto(tx, auditKey(now, auditSeq.Add(1)), rec)
+}
+
+// AuditQuery filters audit records. Zero values match everything.
+type AuditQuery struct {
+	PathPrefix string
+	Identity   string
+	From, To   time.Time
+}
+
+// QueryAudit calls fn for each matching record in time order until fn
+// returns an error.
+func (s *Store) QueryAudit(ctx context.Context, q AuditQuery, fn func(*pb.AuditRecord) error) error {
+	return s.view(func(tx *badger.Txn) error {
+		it := tx.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte{prefixAudit}
+		seek := prefix
+		if !q.From.IsZero() {
+			seek = auditKey(q.From.UnixNano(), 0)
+		}
+		var until int64
+		if !q.To.IsZero() {
+			until = q.To.UnixNano()
+		}
+		for it.Seek(seek); it.ValidForPrefix(prefix); it.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			k := it.Item().Key()
+			if len(k) != 13 {
+				continue
+			}
+			if until != 0 && int64(binary.BigEndian.Uint64(k[1:])) > until {
+				break
+			}
+			var rec pb.AuditRecord
+			if err := it.Item().Value(func(v []byte) error {
+				return proto.Unmarshal(v, &rec)
+			}); err != nil {
+				return err
+			}
+			if !strings.HasPrefix(rec.GetPath(), q.PathPrefix) {
+				continue
+			}
+			if q.Identity != "" && rec.GetIdentity() != q.Identity {
+				continue
+			}
+			if err := fn(&rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
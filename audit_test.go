@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/contester/advfiler/hashes"
+	pb "github.com/contester/advfiler/protos"
+)
+
+func collectAudit(t *testing.T, s *Store, q AuditQuery) []*pb.AuditRecord {
+	t.Helper()
+	var recs []*pb.AuditRecord
+	if err := s.QueryAudit(context.Background(), q, func(rec *pb.AuditRecord) error {
+		recs = append(recs, rec)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return recs
+}
+
+func TestAuditUploadDelete(t *testing.T) {
+	s := newTestStore(t)
+	ctx := WithAuditActor(context.Background(), AuditActor{
+		Identity:   "alice",
+		RemoteAddr: "10.0.0.1:1234",
+		RequestID:  "req-1",
+	})
+
+	first, err := s.Upload(ctx, FileInfo{Name: "a/x"}, strings.NewReader("one"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Upload(ctx, FileInfo{Name: "a/x"}, strings.NewReader("two")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(WithAuditActor(context.Background(), AuditActor{Identity: "bob", Action: AuditWipe}), "a/x"); err != nil {
+		t.Fatal(err)
+	}
+	// Deleting a missing path changes nothing and isn't logged.
+	if err := s.Delete(ctx, "a/missing"); err != nil {
+		t.Fatal(err)
+	}
+
+	recs := collectAudit(t, s, AuditQuery{})
+	if len(recs) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(recs))
+	}
+	wantActions := []string{AuditUpload, AuditUpload, AuditWipe}
+	for i, rec := range recs {
+		if rec.GetAction() != wantActions[i] || rec.GetPath() != "a/x" {
+			t.Errorf("record %d: expected %s a/x, got %s %s", i, wantActions[i], rec.GetAction(), rec.GetPath())
+		}
+	}
+	if len(recs[0].GetOldBlake3()) != 0 || len(recs[0].GetNewBlake3()) != 32 {
+		t.Errorf("create record should have only a new hash: %v", recs[0])
+	}
+	if !bytes.Equal(recs[1].GetOldBlake3(), recs[0].GetNewBlake3()) {
+		t.Error("overwrite record should carry the previous hash")
+	}
+	if !bytes.Equal(recs[2].GetOldBlake3(), recs[1].GetNewBlake3()) || len(recs[2].GetNewBlake3()) != 0 {
+		t.Errorf("delete record hashes wrong: %v", recs[2])
+	}
+	if recs[0].GetIdentity() != "alice" || recs[0].GetRemoteAddr() != "10.0.0.1:1234" || recs[0].GetRequestId() != "req-1" {
+		t.Errorf("actor not recorded: %v", recs[0])
+	}
+	if hashes.DigestsToMap(hashes.Digests{Blake3: recs[0].GetNewBlake3()})["BLAKE3"] != first.Digests["BLAKE3"] {
+		t.Error("recorded hash doesn't match upload digest")
+	}
+}
+
+func TestAuditManifestAndXML(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	if err := s.SetManifest(ctx, "p/1", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetContest(ctx, "c1", []byte("<contest/>"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetProblem(ctx, "p1", 3, []byte("<problem/>"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	recs := collectAudit(t, s, AuditQuery{})
+	want := []struct{ action, path string }{
+		{AuditManifest, "p/1"},
+		{AuditContestXML, "c1"},
+		{AuditProblemXML, "p1/3"},
+	}
+	if len(recs) != len(want) {
+		t.Fatalf("expected %d records, got %d", len(want), len(recs))
+	}
+	for i, w := range want {
+		if recs[i].GetAction() != w.action || recs[i].GetPath() != w.path {
+			t.Errorf("record %d: expected %s %s, got %s %s", i, w.action, w.path, recs[i].GetAction(), recs[i].GetPath())
+		}
+		if recs[i].GetIdentity() != "local" {
+			t.Errorf("record %d: expected identity local, got %q", i, recs[i].GetIdentity())
+		}
+	}
+}
+
+func TestAuditQueryFilters(t *testing.T) {
+	s := newTestStore(t)
+	alice := WithAuditActor(context.Background(), AuditActor{Identity: "alice"})
+	bob := WithAuditActor(context.Background(), AuditActor{Identity: "bob"})
+
+	for _, p := range []string{"x/1", "y/1"} {
+		if _, err := s.Upload(alice, FileInfo{Name: p}, strings.NewReader(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mid := time.Now()
+	time.Sleep(time.Millisecond)
+	if _, err := s.Upload(bob, FileInfo{Name: "x/2"}, strings.NewReader("2")); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(collectAudit(t, s, AuditQuery{PathPrefix: "x/"})); n != 2 {
+		t.Errorf("prefix filter: expected 2, got %d", n)
+	}
+	if n := len(collectAudit(t, s, AuditQuery{Identity: "alice"})); n != 2 {
+		t.Errorf("identity filter: expected 2, got %d", n)
+	}
+	if recs := collectAudit(t, s, AuditQuery{From: mid}); len(recs) != 1 || recs[0].GetPath() != "x/2" {
+		t.Errorf("from filter: expected only x/2, got %v", recs)
+	}
+	if n := len(collectAudit(t, s, AuditQuery{To: mid})); n != 2 {
+		t.Errorf("to filter: expected 2, got %d", n)
+	}
+}
+
+func TestAuthCheckerIdentify(t *testing.T) {
+	ac := NewAuthChecker([]string{"plain"}, []string{"root"}, map[string]string{"judge1": "s3cret"})
+	if got := ac.Identify("s3cret"); got != "judge1" {
+		t.Errorf("expected named identity, got %q", got)
+	}
+	if got := ac.Identify("plain"); !strings.HasPrefix(got, "sha256:") || strings.Contains(got, "plain") {
+		t.Errorf("expected hashed identity, got %q", got)
+	}
+	if ok, _ := ac.Check(context.Background(), "s3cret", pb.AuthAction_A_WRITE, "x"); !ok {
+		t.Error("named token should be valid")
+	}
+	if ok, _ := ac.Check(context.Background(), "plain", pb.AuthAction_A_ADMIN, ""); ok {
+		t.Error("non-admin token passed admin check")
+	}
+	if ok, _ := ac.Check(context.Background(), "root", pb.AuthAction_A_ADMIN, ""); !ok {
+		t.Error("admin token failed admin check")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/contester/advfiler/protos"
+)
+
+const defaultAuditLimit = 1000
+
+// auditContext returns the request context carrying the caller's identity
+// for the Store to record. action may be empty to keep the Store's default.
+func auditContext(r *http.Request, ac AuthCheck, action string) context.Context {
+	return WithAuditActor(r.Context(), AuditActor{
+		Identity:   ac.Identify(tokenFromHeader(r)),
+		RemoteAddr: r.RemoteAddr,
+		RequestID:  requestID(r),
+		Action:     action,
+	})
+}
+
+type auditServer struct {
+	store       *Store
+	authChecker AuthCheck
+}
+
+func NewAuditServer(store *Store, authChecker AuthCheck) *auditServer {
+	return &auditServer{store: store, authChecker: authChecker}
+}
+
+type auditEntry struct {
+	Time       time.Time `json:"time"`
+	Identity   string    `json:"identity"`
+	Action     string    `json:"action"`
+	Path       string    `json:"path"`
+	OldBlake3  string    `json:"oldBlake3,omitempty"`
+	NewBlake3  string    `json:"newBlake3,omitempty"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+	RequestID  string    `json:"requestId,omitempty"`
+}
+
+func auditEntryFromProto(rec *pb.AuditRecord) auditEntry {
+	return auditEntry{
+		Time:       time.Unix(0, rec.GetTimestampUnixNano()).UTC(),
+		Identity:   rec.GetIdentity(),
+		Action:     rec.GetAction(),
+		Path:       rec.GetPath(),
+		OldBlake3:  hex.EncodeToString(rec.GetOldBlake3()),
+		NewBlake3:  hex.EncodeToString(rec.GetNewBlake3()),
+		RemoteAddr: rec.GetRemoteAddr(),
+		RequestID:  rec.GetRequestId(),
+	}
+}
+
+// parseTimeParam accepts RFC 3339 or unix seconds. Empty means unbounded.
+func parseTimeParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+var errAuditLimit = errors.New("audit limit reached")
+
+// handleAudit serves GET /audit/?prefix=&identity=&from=&to=&limit=.
+// With format=jsonl (or Accept: application/x-ndjson) the matching records
+// are streamed as JSON lines without a limit, for export.
+func (a *auditServer) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	if v, _ := a.authChecker.Check(ctx, tokenFromHeader(r), pb.AuthAction_A_ADMIN, ""); !v {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	query := r.URL.Query()
+	q := AuditQuery{
+		PathPrefix: query.Get("prefix"),
+		Identity:   query.Get("identity"),
+	}
+	var err error
+	if q.From, err = parseTimeParam(query.Get("from")); err != nil {
+		http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.To, err = parseTimeParam(query.Get("to")); err != nil {
+		http.Error(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if query.Get("format") == "jsonl" || strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		err := a.store.QueryAudit(ctx, q, func(rec *pb.AuditRecord) error {
+			e := auditEntryFromProto(rec)
+			return enc.Encode(&e)
+		})
+		if err != nil {
+			// Headers are gone; the truncated stream is all we can signal.
+			requestLog(ctx).Errorf("audit export: %v", err)
+		}
+		return
+	}
+
+	limit := defaultAuditLimit
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	entries := []auditEntry{}
+	err = a.store.QueryAudit(ctx, q, func(rec *pb.AuditRecord) error {
+		entries = append(entries, auditEntryFromProto(rec))
+		if len(entries) >= limit {
+			return errAuditLimit
+		}
+		return nil
+	})
+	if err != nil && err != errAuditLimit {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -2,15 +2,45 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 
 	pb "github.com/contester/advfiler/protos"
 )
 
 type AuthChecker struct {
 	validTokens map[string]struct{}
+	// adminTokens, when non-empty, are the only tokens allowed A_ADMIN.
+	adminTokens map[string]struct{}
+	// names maps a token to a human-readable identity for logs.
+	names map[string]string
+}
+
+func NewAuthChecker(valid, admin []string, named map[string]string) *AuthChecker {
+	s := &AuthChecker{
+		validTokens: make(map[string]struct{}, len(valid)+len(admin)+len(named)),
+		adminTokens: make(map[string]struct{}, len(admin)),
+		names:       make(map[string]string, len(named)),
+	}
+	for _, v := range valid {
+		s.validTokens[v] = struct{}{}
+	}
+	for name, v := range named {
+		s.validTokens[v] = struct{}{}
+		s.names[v] = name
+	}
+	for _, v := range admin {
+		s.validTokens[v] = struct{}{}
+		s.adminTokens[v] = struct{}{}
+	}
+	return s
 }
 
 func (s *AuthChecker) Check(ctx context.Context, token string, action pb.AuthAction, path string) (bool, error) {
+	if action == pb.AuthAction_A_ADMIN && len(s.adminTokens) != 0 {
+		_, ok := s.adminTokens[token]
+		return ok, nil
+	}
 	if len(s.validTokens) == 0 {
 		return true, nil
 	}
@@ -19,3 +49,16 @@ func (s *AuthChecker) Check(ctx context.Context, token string, action pb.AuthAct
 	}
 	return false, nil
 }
+
+// Identify returns a loggable identity for a token: its configured name, or
+// a short hash so the secret itself never ends up in logs.
+func (s *AuthChecker) Identify(token string) string {
+	if token == "" {
+		return "anonymous"
+	}
+	if name, ok := s.names[token]; ok {
+		return name
+	}
+	h := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(h[:6])
+}
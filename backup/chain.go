@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/contester/advfiler/client"
+)
+
+// Native backups are chained in a directory as files named after the since
+// they were taken from and the since for the next one, so a chain restores
+// by sorting names and checking that each picks up where the previous ended.
+const chainFormat = "advfiler-%020d-%020d.bak"
+
+type chainLink struct {
+	name        string
+	since, next uint64
+}
+
+func readChain(dir string) ([]chainLink, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var chain []chainLink
+	for _, e := range entries {
+		var l chainLink
+		if _, err := fmt.Sscanf(e.Name(), chainFormat, &l.since, &l.next); err != nil {
+			continue
+		}
+		l.name = filepath.Join(dir, e.Name())
+		chain = append(chain, l)
+	}
+	sort.Slice(chain, func(i, j int) bool { return chain[i].since < chain[j].since })
+	for i, l := range chain {
+		if i == 0 && l.since != 0 {
+			return nil, fmt.Errorf("chain in %s doesn't start with a full backup", dir)
+		}
+		if i > 0 && l.since != chain[i-1].next {
+			return nil, fmt.Errorf("chain broken between %s and %s", chain[i-1].name, l.name)
+		}
+	}
+	return chain, nil
+}
+
+// takeBackup appends a backup to the chain in dir: a full one if the chain
+// is empty or full is set (which starts a new chain), incremental otherwise.
+func takeBackup(c *client.Client, dir string, full bool) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	chain, err := readChain(dir)
+	if err != nil {
+		return err
+	}
+	var since uint64
+	if !full && len(chain) != 0 {
+		since = chain[len(chain)-1].next
+	} else if len(chain) != 0 {
+		return fmt.Errorf("%s already holds a chain; use an empty directory for a new full backup", dir)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".partial-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	cw := &countingWriter{w: tmp}
+	next, err := c.Backup(context.Background(), since, cw)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	n := cw.n
+	if n == 0 && next == since {
+		fmt.Fprintf(os.Stderr, "nothing changed since %d\n", since)
+		return nil
+	}
+	name := filepath.Join(dir, fmt.Sprintf(chainFormat, since, next))
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d bytes\n", name, n)
+	return nil
+}
+
+// restoreChain loads every backup of the chain in dir, in order.
+func restoreChain(c *client.Client, dir string) error {
+	chain, err := readChain(dir)
+	if err != nil {
+		return err
+	}
+	if len(chain) == 0 {
+		return fmt.Errorf("no backups in %s", dir)
+	}
+	for _, l := range chain {
+		if err := restore1(c, l.name); err != nil {
+			return fmt.Errorf("restoring %s: %w", l.name, err)
+		}
+		fmt.Fprintf(os.Stderr, "restored %s\n", l.name)
+	}
+	return nil
+}
+
+func restore1(c *client.Client, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.Restore(context.Background(), f)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func cmdBackup(c *client.Client, args []string) error {
+	fl := subcommandFlags("backup")
+	full := fl.Bool("full", false, "start a new chain with a full backup")
+	fl.Parse(args)
+	if fl.NArg() != 1 {
+		return errUsage
+	}
+	return takeBackup(c, fl.Arg(0), *full)
+}
+
+func cmdRestore(c *client.Client, args []string) error {
+	fl := subcommandFlags("restore")
+	fl.Parse(args)
+	if fl.NArg() != 1 {
+		return errUsage
+	}
+	return restoreChain(c, fl.Arg(0))
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/contester/advfiler/client"
+	"github.com/contester/advfiler/hashes"
+)
+
+// download writes p to w, returning an error if the content doesn't match
+// the server's digests. w has seen the data by then, so callers writing
+// somewhere permanent should write to a temporary first.
+func download(c *client.Client, p string, w io.Writer) (*client.FileInfo, error) {
+	f, err := c.Download(context.Background(), p)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(w, f); err != nil {
+		return nil, err
+	}
+	return &f.FileInfo, nil
+}
+
+// downloadFile writes p to the local file name, replacing it only once the
+// content has been verified.
+func downloadFile(c *client.Client, p, name string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	fi, err := download(c, p, tmp)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if !fi.ModTime.IsZero() {
+		os.Chtimes(tmp.Name(), fi.ModTime, fi.ModTime)
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+func upload(c *client.Client, p string, r io.Reader, moduleType string) (*client.UploadStatus, error) {
+	st, err := c.Upload(context.Background(), p, r, moduleType)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	return st, nil
+}
+
+// copyFile streams src into dst, attributes included; both ends verify the
+// digests.
+func copyFile(c *client.Client, src, dst string) error {
+	f, err := c.Download(context.Background(), src)
+	if err != nil {
+		return fmt.Errorf("%s: %w", src, err)
+	}
+	defer f.Close()
+	if _, err = upload(c, dst, f, f.ModuleType); err != nil || len(f.Attributes) == 0 {
+		return err
+	}
+	if _, err := c.SetAttributes(context.Background(), dst, f.Attributes); err != nil {
+		return fmt.Errorf("%s: %w", dst, err)
+	}
+	return nil
+}
+
+func remove(c *client.Client, p string) error {
+	if err := c.Delete(context.Background(), p); err != nil {
+		return fmt.Errorf("%s: %w", p, err)
+	}
+	return nil
+}
+
+func cmdLs(c *client.Client, args []string) error {
+	fl := subcommandFlags("ls")
+	long := fl.Bool("l", false, "show size, modification time and module type")
+	fl.Parse(args)
+	if fl.NArg() > 1 {
+		return errUsage
+	}
+	ctx := context.Background()
+	names, err := c.List(ctx, fl.Arg(0))
+	if err != nil {
+		return err
+	}
+	if !*long {
+		for _, n := range names {
+			fmt.Println(n)
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	defer tw.Flush()
+	for _, n := range names {
+		fi, err := c.Stat(ctx, n)
+		if err != nil {
+			return fmt.Errorf("%s: %w", n, err)
+		}
+		var mt string
+		if !fi.ModTime.IsZero() {
+			mt = fi.ModTime.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(tw, "%d\t %s\t %s\t %s\n", fi.Size, mt, fi.ModuleType, n)
+	}
+	return nil
+}
+
+func cmdStat(c *client.Client, args []string) error {
+	fl := subcommandFlags("stat")
+	fl.Parse(args)
+	if fl.NArg() == 0 {
+		return errUsage
+	}
+	for i, p := range fl.Args() {
+		fi, err := c.Stat(context.Background(), p)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("path: %s\nsize: %d\n", fi.Path, fi.Size)
+		if fi.ModuleType != "" {
+			fmt.Printf("module-type: %s\n", fi.ModuleType)
+		}
+		if !fi.ModTime.IsZero() {
+			fmt.Printf("modified: %s\n", fi.ModTime.Format(time.RFC3339))
+		}
+		digests := hashes.DigestsToMap(fi.Digests)
+		for _, name := range []string{"MD5", "SHA", "SHA-256", "BLAKE3"} {
+			if v := digests[name]; v != "" {
+				fmt.Printf("%s: %s\n", strings.ToLower(name), v)
+			}
+		}
+		printAttributes(fi.Attributes)
+	}
+	return nil
+}
+
+func printAttributes(attrs map[string]string) {
+	for _, k := range slices.Sorted(maps.Keys(attrs)) {
+		fmt.Printf("meta.%s: %s\n", k, attrs[k])
+	}
+}
+
+func cmdAttr(c *client.Client, args []string) error {
+	fl := subcommandFlags("attr")
+	fl.Parse(args)
+	if fl.NArg() == 0 {
+		return errUsage
+	}
+	p := fl.Arg(0)
+	ctx := context.Background()
+	if fl.NArg() == 1 {
+		fi, err := c.Stat(ctx, p)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		printAttributes(fi.Attributes)
+		return nil
+	}
+	update := make(map[string]string)
+	for _, kv := range fl.Args()[1:] {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return errUsage
+		}
+		update[k] = v
+	}
+	attrs, err := c.SetAttributes(ctx, p, update)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p, err)
+	}
+	printAttributes(attrs)
+	return nil
+}
+
+func cmdGet(c *client.Client, args []string) error {
+	fl := subcommandFlags("get")
+	fl.Parse(args)
+	if fl.NArg() < 1 || fl.NArg() > 2 {
+		return errUsage
+	}
+	remote, local := fl.Arg(0), fl.Arg(1)
+	if local == "" || local == "-" {
+		_, err := download(c, remote, os.Stdout)
+		return err
+	}
+	if st, err := os.Stat(local); err == nil && st.IsDir() {
+		local = filepath.Join(local, path.Base(remote))
+	}
+	return downloadFile(c, remote, local)
+}
+
+func cmdPut(c *client.Client, args []string) error {
+	fl := subcommandFlags("put")
+	moduleType := fl.String("t", "", "module type")
+	chunkSize := fl.Int64("c", 0, "upload resumably, in chunks of `SIZE` bytes, resuming after network errors")
+	fl.Parse(args)
+	if fl.NArg() != 2 {
+		return errUsage
+	}
+	local, remote := fl.Arg(0), fl.Arg(1)
+
+	var f *os.File
+	if local == "-" {
+		// Spool stdin so the digests can be sent up front.
+		tmp, err := os.CreateTemp("", "advfiler-put-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		if _, err := io.Copy(tmp, os.Stdin); err != nil {
+			return err
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		f = tmp
+	} else {
+		var err error
+		if f, err = os.Open(local); err != nil {
+			return err
+		}
+		defer f.Close()
+		if strings.HasSuffix(remote, "/") {
+			remote += filepath.Base(local)
+		}
+	}
+	var st *client.UploadStatus
+	var err error
+	if *chunkSize > 0 {
+		if st, err = c.UploadResumable(context.Background(), remote, f, *moduleType, *chunkSize); err != nil {
+			return fmt.Errorf("%s: %w", remote, err)
+		}
+	} else if st, err = upload(c, remote, f, *moduleType); err != nil {
+		return err
+	}
+	if st.Hardlinked {
+		fmt.Fprintf(os.Stderr, "%s: %d bytes (deduplicated)\n", remote, st.Size)
+	}
+	return nil
+}
+
+func cmdRm(c *client.Client, args []string) error {
+	fl := subcommandFlags("rm")
+	recursive := fl.Bool("r", false, "delete everything under each prefix")
+	fl.Parse(args)
+	if fl.NArg() == 0 {
+		return errUsage
+	}
+	for _, p := range fl.Args() {
+		if !*recursive {
+			if err := remove(c, p); err != nil {
+				return err
+			}
+			continue
+		}
+		names, err := c.List(context.Background(), p)
+		if err != nil {
+			return err
+		}
+		for _, n := range names {
+			if err := remove(c, n); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func cmdCp(c *client.Client, args []string) error {
+	fl := subcommandFlags("cp")
+	fl.Parse(args)
+	if fl.NArg() != 2 {
+		return errUsage
+	}
+	return copyFile(c, fl.Arg(0), fl.Arg(1))
+}
+
+func cmdMv(c *client.Client, args []string) error {
+	fl := subcommandFlags("mv")
+	fl.Parse(args)
+	if fl.NArg() != 2 {
+		return errUsage
+	}
+	src, dst := fl.Arg(0), fl.Arg(1)
+	if src == dst {
+		return fmt.Errorf("%s and %s are the same file", src, dst)
+	}
+	if err := copyFile(c, src, dst); err != nil {
+		return err
+	}
+	return remove(c, src)
+}
@@ -1,142 +1,203 @@
+// Command contester-advfiler-backup is the advfiler command-line client.
+//
+// The server is taken from -backend, $ADVFILER_BACKEND or the config file,
+// and the token from -auth, $ADVFILER_AUTH_TOKEN or the config file, in that
+// order. The config file is JSON: {"backend": "http://host:port/", "token": "..."}.
+//
+// The -mode flags of earlier versions still work, with a warning, and map
+// to commands:
+//
+//	-mode export [PREFIX]         tar-export [PREFIX]
+//	-mode import, -mode import2   tar-import
+//	-mode backup -dir DIR [-full] backup [-full] DIR
+//	-mode restore -dir DIR        restore DIR
 package main
 
 import (
-	"archive/tar"
-	"bufio"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
-	"net/http"
+	"io/fs"
 	"os"
-	"strconv"
+	"path/filepath"
+	"strings"
+
+	"github.com/contester/advfiler/client"
 )
 
-func exportAll(base, path string) error {
-	req, err := http.NewRequest(http.MethodGet, base+path, nil)
-	if err != nil {
-		return err
-	}
-	if *authToken != "" {
-		req.Header.Add("Authorization", "Bearer "+*authToken)
+type cliConfig struct {
+	Backend string `json:"backend"`
+	Token   string `json:"token"`
+}
+
+// loadConfig reads the config file. A missing default config is not an error.
+func loadConfig(name string) (cliConfig, error) {
+	var cfg cliConfig
+	explicit := name != ""
+	if !explicit {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return cfg, nil
+		}
+		name = filepath.Join(dir, "advfiler", "config.json")
 	}
-	resp, err := http.DefaultClient.Do(req)
+	data, err := os.ReadFile(name)
 	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	var files []string
-	scanner := bufio.NewScanner(resp.Body)
-	for scanner.Scan() {
-		files = append(files, scanner.Text())
+		if !explicit && errors.Is(err, fs.ErrNotExist) {
+			return cfg, nil
+		}
+		return cfg, err
 	}
-	if err = scanner.Err(); err != nil {
-		return err
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", name, err)
 	}
+	return cfg, nil
+}
 
-	fw := tar.NewWriter(os.Stdout)
-	defer fw.Close()
-	for _, v := range files {
-		if err = export1(base, v, fw); err != nil {
-			return err
-		}
+type command struct {
+	name, args, help string
+	run              func(c *client.Client, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"ls", "[-l] [PREFIX]", "list files under PREFIX", cmdLs},
+		{"stat", "PATH...", "show size, module type, modification time, digests and attributes", cmdStat},
+		{"attr", "PATH [KEY=VALUE|KEY=]...", "show or change the attributes of a file; KEY= removes one", cmdAttr},
+		{"get", "REMOTE [LOCAL|-]", "download a file, verifying its digests", cmdGet},
+		{"put", "[-t TYPE] [-c SIZE] LOCAL|- REMOTE", "upload a file along with its digests", cmdPut},
+		{"rm", "[-r] PATH...", "delete files, or everything under a prefix with -r", cmdRm},
+		{"cp", "SRC DST", "copy a file on the server", cmdCp},
+		{"mv", "SRC DST", "move a file on the server", cmdMv},
+		{"tar-export", "[-o FILE] [PREFIX]", "write files under PREFIX as a tar to stdout or FILE", cmdTarExport},
+		{"tar-import", "[-conflict POLICY] [FILE|-]", "upload a tar archive, optionally gzip, zstd or xz compressed", cmdTarImport},
+		{"zip-import", "[-p PREFIX] [-conflict POLICY] [FILE|-]", "upload a zip archive, storing its files under PREFIX", cmdZipImport},
+		{"sync", "[-down] [-delete] [-n] LOCALDIR PREFIX", "upload changed files from LOCALDIR, or download with -down", cmdSync},
+		{"manifest", "get ID [REVISION] | set [FILE|-]", "read or write problem manifests", cmdManifest},
+		{"xml", "contest|problem get|set ...", "read or write contest and problem XML", cmdXML},
+		{"backup", "[-full] DIR", "append a native backup to the chain in DIR", cmdBackup},
+		{"restore", "DIR", "restore the backup chain in DIR into an empty server", cmdRestore},
 	}
+}
 
-	return nil
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "usage: %s [flags] COMMAND [args]\n\ncommands:\n", filepath.Base(os.Args[0]))
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %s %s\n    \t%s\n", c.name, c.args, c.help)
+	}
+	fmt.Fprintf(w, "\nflags:\n")
+	flag.PrintDefaults()
 }
 
-func importAll(base string) error {
-	fr := tar.NewReader(os.Stdin)
-	for {
-		h, err := fr.Next()
-		if err == io.EOF {
-			return nil
-		}
-		req, err := http.NewRequest(http.MethodPut, base+h.Name, fr)
-		if err != nil {
-			return err
-		}
-		if mn := h.Xattrs["user.fs_module_type"]; mn != "" {
-			req.Header.Add("X-FS-Module-Type", mn)
+// subcommandFlags returns a flag set for a command that prints its usage line.
+func subcommandFlags(name string) *flag.FlagSet {
+	fl := flag.NewFlagSet(name, flag.ExitOnError)
+	fl.Usage = func() {
+		for _, c := range commands {
+			if c.name == name {
+				fmt.Fprintf(fl.Output(), "usage: %s %s\n", c.name, c.args)
+			}
 		}
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return err
-		}
-		resp.Body.Close()
+		fl.PrintDefaults()
 	}
+	return fl
 }
 
-func import2(base string) error {
-	req, err := http.NewRequest(http.MethodPut, base+"tar/", os.Stdin)
-	if err != nil {
-		return err
-	}
-	if *authToken != "" {
-		req.Header.Add("Authorization", "Bearer "+*authToken)
-	}
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	fmt.Fprintf(os.Stderr, "Status: %v\n", resp.Status)
-	io.Copy(os.Stderr, resp.Body)
-	return err
+// errUsage makes main print the command's usage and exit with status 2.
+var errUsage = errors.New("invalid arguments")
+
+var (
+	backendFlag = flag.String("backend", "", "server root URL, e.g. http://localhost:9094/")
+	authToken   = flag.String("auth", "", "auth token")
+	configFlag  = flag.String("config", "", "config file (default $XDG_CONFIG_HOME/advfiler/config.json)")
+
+	// Deprecated: see legacyArgs.
+	modeFlag = flag.String("mode", "", "deprecated: use a command instead")
+	dirFlag  = flag.String("dir", "", "deprecated: backup chain directory for -mode backup and restore")
+	fullFlag = flag.Bool("full", false, "deprecated: use backup -full")
+)
+
+// legacyArgs turns the old -mode flags into command arguments.
+func legacyArgs() ([]string, error) {
+	var args []string
+	switch *modeFlag {
+	case "export":
+		args = append([]string{"tar-export"}, flag.Args()...)
+	case "import", "import2":
+		args = []string{"tar-import"}
+	case "backup":
+		args = []string{"backup"}
+		if *fullFlag {
+			args = append(args, "-full")
+		}
+		args = append(args, *dirFlag)
+	case "restore":
+		args = []string{"restore", *dirFlag}
+	default:
+		return nil, fmt.Errorf("unknown mode %q", *modeFlag)
+	}
+	fmt.Fprintf(os.Stderr, "-mode is deprecated, use: %s %s\n", filepath.Base(os.Args[0]), strings.Join(args, " "))
+	return args, nil
 }
 
-func export1(base, path string, fw *tar.Writer) error {
-	req, err := http.NewRequest(http.MethodGet, base+path, nil)
-	if err != nil {
-		return err
-	}
-	if *authToken != "" {
-		req.Header.Add("Authorization", "Bearer "+*authToken)
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	args := flag.Args()
+	if *modeFlag != "" {
+		var err error
+		if args, err = legacyArgs(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
 	}
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
 	}
-	defer resp.Body.Close()
-	sz := resp.Header.Get("X-Fs-Content-Length")
-	isz, err := strconv.ParseInt(sz, 10, 64)
+
+	cfg, err := loadConfig(*configFlag)
 	if err != nil {
-		return fmt.Errorf("getting %q: %v", base+path, err)
-	}
-	fh := tar.Header{
-		Name:     path,
-		Mode:     0666,
-		Size:     isz,
-		Typeflag: tar.TypeReg,
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	if mn := resp.Header.Get("X-Fs-Module-Type"); mn != "" {
-		//fh.Name = fh.Name + "." + mn
-		fh.Xattrs = map[string]string{"user.fs_module_type": mn}
+	backend := firstNonEmpty(*backendFlag, os.Getenv("ADVFILER_BACKEND"), cfg.Backend)
+	if backend == "" {
+		fmt.Fprintln(os.Stderr, "no backend: use -backend, $ADVFILER_BACKEND or the config file")
+		os.Exit(2)
 	}
-	if err = fw.WriteHeader(&fh); err != nil {
-		return err
+	c := client.New(backend, firstNonEmpty(*authToken, os.Getenv("ADVFILER_AUTH_TOKEN"), cfg.Token))
+
+	name := args[0]
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		err := cmd.run(c, args[1:])
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "usage: %s %s\n", cmd.name, cmd.args)
+			os.Exit(2)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			os.Exit(1)
+		}
+		return
 	}
-	_, err = io.Copy(fw, resp.Body)
-	return err
+	fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+	usage()
+	os.Exit(2)
 }
 
-var (
-	backend   = flag.String("backend", "", "")
-	modeFlag  = flag.String("mode", "", "")
-	authToken = flag.String("auth", "", "")
-)
-
-func main() {
-	flag.Parse()
-	var err error
-	switch *modeFlag {
-	case "export":
-		err = exportAll(*backend, flag.Arg(0))
-	case "import":
-		err = importAll(*backend)
-	case "import2":
-		err = import2(*backend)
-	}
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s", err)
+func firstNonEmpty(v ...string) string {
+	for _, s := range v {
+		if s != "" {
+			return s
+		}
 	}
+	return ""
 }
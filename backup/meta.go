@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/contester/advfiler/client"
+)
+
+// readInput reads FILE, or stdin for "" and "-".
+func readInput(name string) ([]byte, error) {
+	if name == "" || name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(name)
+}
+
+func cmdManifest(c *client.Client, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	ctx := context.Background()
+	switch args[0] {
+	case "get":
+		if len(args) < 2 || len(args) > 3 {
+			return errUsage
+		}
+		var rev int
+		if len(args) == 3 {
+			var err error
+			if rev, err = strconv.Atoi(args[2]); err != nil {
+				return errUsage
+			}
+		}
+		ms, err := c.GetManifests(ctx, args[1], rev)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(ms)
+	case "set":
+		if len(args) > 2 {
+			return errUsage
+		}
+		var name string
+		if len(args) == 2 {
+			name = args[1]
+		}
+		body, err := readInput(name)
+		if err != nil {
+			return err
+		}
+		var m client.Manifest
+		if err := json.Unmarshal(body, &m); err != nil {
+			return err
+		}
+		return c.SetManifest(ctx, m)
+	}
+	return errUsage
+}
+
+// cmdXML handles
+//
+//	xml contest get KEY
+//	xml contest set [-timestamp N] KEY [FILE|-]
+//	xml problem get [-revision N] KEY
+//	xml problem set [-timestamp N] KEY REVISION [FILE|-]
+func cmdXML(c *client.Client, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	kind, op := args[0], args[1]
+	if kind != "contest" && kind != "problem" {
+		return errUsage
+	}
+	fl := subcommandFlags("xml")
+	timestamp := fl.Int64("timestamp", 0, "unix timestamp to store (set; default now)")
+	revision := fl.Int64("revision", -1, "problem revision (get; default latest)")
+	fl.Parse(args[2:])
+	ctx := context.Background()
+
+	switch op {
+	case "get":
+		if fl.NArg() != 1 {
+			return errUsage
+		}
+		var data []byte
+		var err error
+		if kind == "contest" {
+			data, _, err = c.GetContestXML(ctx, fl.Arg(0))
+		} else {
+			var rev int64
+			data, rev, _, err = c.GetProblemXML(ctx, fl.Arg(0), *revision)
+			if err == nil {
+				fmt.Fprintf(os.Stderr, "revision %d\n", rev)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	case "set":
+		rest := fl.Args()
+		if len(rest) < 1 {
+			return errUsage
+		}
+		key := rest[0]
+		rest = rest[1:]
+		var rev int64
+		if kind == "problem" {
+			if len(rest) < 1 {
+				return errUsage
+			}
+			var err error
+			if rev, err = strconv.ParseInt(rest[0], 10, 64); err != nil || rev < 0 {
+				return errUsage
+			}
+			rest = rest[1:]
+		}
+		if len(rest) > 1 {
+			return errUsage
+		}
+		var name string
+		if len(rest) == 1 {
+			name = rest[0]
+		}
+		body, err := readInput(name)
+		if err != nil {
+			return err
+		}
+		if kind == "contest" {
+			return c.SetContestXML(ctx, key, body, *timestamp)
+		}
+		return c.SetProblemXML(ctx, key, rev, body, *timestamp)
+	}
+	return errUsage
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/contester/advfiler/client"
+)
+
+type syncOptions struct {
+	down, delete, dryRun bool
+}
+
+func localSHA256(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// localFiles maps slash-separated paths relative to dir to local file names.
+func localFiles(dir string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = name
+		return nil
+	})
+	return files, err
+}
+
+// sameContent tells whether the remote file p has the local file's content,
+// going by SHA-256.
+func sameContent(c *client.Client, p, name string) (bool, error) {
+	fi, err := c.Stat(context.Background(), p)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", p, err)
+	}
+	remote := fi.Digests.SHA256
+	if remote == nil {
+		return false, nil
+	}
+	local, err := localSHA256(name)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(local, remote), nil
+}
+
+// syncDir makes prefix match dir (or dir match prefix when downloading),
+// transferring only files whose content differs.
+func syncDir(c *client.Client, dir, prefix string, opts syncOptions) error {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	local, err := localFiles(dir)
+	if err != nil {
+		return err
+	}
+	names, err := c.List(context.Background(), prefix)
+	if err != nil {
+		return err
+	}
+	remote := make(map[string]bool, len(names))
+	for _, n := range names {
+		remote[strings.TrimPrefix(n, prefix)] = true
+	}
+
+	if opts.down {
+		return syncDown(c, dir, prefix, local, names, opts)
+	}
+
+	rels := make([]string, 0, len(local))
+	for rel := range local {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	for _, rel := range rels {
+		if remote[rel] {
+			same, err := sameContent(c, prefix+rel, local[rel])
+			if err != nil {
+				return err
+			}
+			if same {
+				continue
+			}
+		}
+		fmt.Printf("put %s\n", prefix+rel)
+		if opts.dryRun {
+			continue
+		}
+		f, err := os.Open(local[rel])
+		if err != nil {
+			return err
+		}
+		_, err = upload(c, prefix+rel, f, "")
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if !opts.delete {
+		return nil
+	}
+	for _, n := range names {
+		if _, ok := local[strings.TrimPrefix(n, prefix)]; ok {
+			continue
+		}
+		fmt.Printf("rm %s\n", n)
+		if opts.dryRun {
+			continue
+		}
+		if err := remove(c, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func syncDown(c *client.Client, dir, prefix string, local map[string]string, names []string, opts syncOptions) error {
+	seen := make(map[string]bool, len(names))
+	for _, n := range names {
+		rel := strings.TrimPrefix(n, prefix)
+		if !filepath.IsLocal(filepath.FromSlash(rel)) {
+			return fmt.Errorf("%s: refusing to write outside %s", n, dir)
+		}
+		seen[rel] = true
+		name := filepath.Join(dir, filepath.FromSlash(rel))
+		if _, ok := local[rel]; ok {
+			same, err := sameContent(c, n, name)
+			if err != nil {
+				return err
+			}
+			if same {
+				continue
+			}
+		}
+		fmt.Printf("get %s\n", n)
+		if opts.dryRun {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		if err := downloadFile(c, n, name); err != nil {
+			return err
+		}
+	}
+	if !opts.delete {
+		return nil
+	}
+	for rel, name := range local {
+		if seen[rel] {
+			continue
+		}
+		fmt.Printf("rm %s\n", name)
+		if opts.dryRun {
+			continue
+		}
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdSync(c *client.Client, args []string) error {
+	fl := subcommandFlags("sync")
+	var opts syncOptions
+	fl.BoolVar(&opts.down, "down", false, "download from PREFIX into LOCALDIR instead")
+	fl.BoolVar(&opts.delete, "delete", false, "delete files missing from the source side")
+	fl.BoolVar(&opts.dryRun, "n", false, "only print what would be done")
+	fl.Parse(args)
+	if fl.NArg() != 2 {
+		return errUsage
+	}
+	return syncDir(c, fl.Arg(0), fl.Arg(1), opts)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/contester/advfiler/client"
+	"github.com/contester/advfiler/hashes"
+)
+
+// exportTo writes every file under prefix to w as a tar, verifying each
+// one's digests on the way.
+func exportTo(c *client.Client, w io.Writer, prefix string) error {
+	ctx := context.Background()
+	names, err := c.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	for _, name := range names {
+		if err := export1(ctx, c, tw, name); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return tw.Close()
+}
+
+func export1(ctx context.Context, c *client.Client, tw *tar.Writer, name string) error {
+	f, err := c.Download(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fh := tar.Header{
+		Name:     name,
+		Mode:     0666,
+		Size:     f.Size,
+		ModTime:  f.ModTime,
+		Typeflag: tar.TypeReg,
+	}
+	fh.PAXRecords = make(map[string]string)
+	if f.ModuleType != "" {
+		fh.PAXRecords["SCHILY.xattr.user.fs_module_type"] = f.ModuleType
+	}
+	for k, v := range f.Attributes {
+		fh.PAXRecords["SCHILY.xattr.user.fs_meta."+k] = v
+	}
+	hashes.AddPAXDigests(fh.PAXRecords, f.Digests)
+	if err := tw.WriteHeader(&fh); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+func cmdTarExport(c *client.Client, args []string) error {
+	fl := subcommandFlags("tar-export")
+	out := fl.String("o", "", "write to FILE instead of stdout; it's removed if the export fails")
+	fl.Parse(args)
+	if fl.NArg() > 1 {
+		return errUsage
+	}
+	if *out == "" || *out == "-" {
+		return exportTo(c, os.Stdout, fl.Arg(0))
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	err = exportTo(c, f, fl.Arg(0))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(*out)
+	}
+	return err
+}
+
+const conflictUsage = "what to do with existing paths: overwrite, skip-identical, skip-existing, newer or fail"
+
+// openInput opens name, or returns stdin for "" and "-".
+func openInput(name string) (io.ReadCloser, error) {
+	if name == "" || name == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(name)
+}
+
+// printReport lists the files that failed to import and the totals. It
+// returns an error if anything failed or conflicted.
+func printReport(rep *client.ImportReport) error {
+	var failed int
+	for _, f := range rep.Files {
+		if f.Error != "" {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", f.Path, f.Error)
+			if f.Outcome == "" {
+				failed++
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Files: %d, created: %d, replaced: %d, skipped: %d, conflicted: %d, failed: %d, real size: %d, saved size: %d\n",
+		len(rep.Files), rep.Created, rep.Replaced, rep.Skipped, rep.Conflicted, failed, rep.RealSize, rep.SavedSize)
+	if rep.Error != "" {
+		return fmt.Errorf("archive: %s", rep.Error)
+	}
+	if failed != 0 || rep.Conflicted != 0 {
+		return fmt.Errorf("%d files failed to import, %d conflicted", failed, rep.Conflicted)
+	}
+	return nil
+}
+
+func cmdTarImport(c *client.Client, args []string) error {
+	fl := subcommandFlags("tar-import")
+	conflict := fl.String("conflict", "", conflictUsage)
+	fl.Parse(args)
+	if fl.NArg() > 1 {
+		return errUsage
+	}
+	r, err := openInput(fl.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	// A report comes back with the error when only some files failed.
+	rep, err := c.TarImport(context.Background(), r, *conflict)
+	if rep == nil {
+		return err
+	}
+	return printReport(rep)
+}
+
+func cmdZipImport(c *client.Client, args []string) error {
+	fl := subcommandFlags("zip-import")
+	prefix := fl.String("p", "", "store files under `PREFIX`")
+	conflict := fl.String("conflict", "", conflictUsage)
+	fl.Parse(args)
+	if fl.NArg() > 1 {
+		return errUsage
+	}
+	r, err := openInput(fl.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	rep, err := c.ZipImport(context.Background(), r, *prefix, *conflict)
+	if rep == nil {
+		return err
+	}
+	return printReport(rep)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+func TestBackupRestoreIncremental(t *testing.T) {
+	src := newTestStore(t)
+	ctx := context.Background()
+
+	big := strings.Repeat("z", 500)
+	for _, p := range []string{"f/a", "f/b", "f/c"} {
+		if _, err := src.Upload(ctx, FileInfo{Name: p, ModuleType: "bin", TimestampUnix: 1234}, strings.NewReader(big)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := src.SetManifest(ctx, "m/1", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SetProblem(ctx, "p", 2, []byte("<problem/>"), 55); err != nil {
+		t.Fatal(err)
+	}
+
+	var full bytes.Buffer
+	next, err := src.Backup(&full, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := src.Delete(ctx, "f/a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.Upload(ctx, FileInfo{Name: "f/d"}, strings.NewReader("new")); err != nil {
+		t.Fatal(err)
+	}
+	var incr bytes.Buffer
+	next2, err := src.Backup(&incr, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next2 <= next {
+		t.Fatalf("next since didn't advance: %d -> %d", next, next2)
+	}
+	if incr.Len() >= full.Len() {
+		t.Errorf("incremental backup (%d bytes) not smaller than full (%d bytes)", incr.Len(), full.Len())
+	}
+
+	// An incremental backup with no changes doesn't move the chain backwards.
+	var empty bytes.Buffer
+	if next3, err := src.Backup(&empty, next2); err != nil || next3 < next2 {
+		t.Errorf("empty incremental: next %d, err %v", next3, err)
+	}
+
+	dst := newTestStore(t)
+	if err := dst.Restore(&full); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Restore(&incr); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := dst.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "f/b,f/c,f/d" {
+		t.Errorf("unexpected files after restore: %v", names)
+	}
+	if got := readFile(t, dst, "f/b"); got != big {
+		t.Error("content of f/b not restored")
+	}
+	st, err := dst.Stat(ctx, "f/c")
+	if err != nil || st.ModuleType != "bin" || st.LastModifiedTimestamp != 1234 {
+		t.Errorf("metadata not restored: %+v %v", st, err)
+	}
+	if _, err := dst.Stat(ctx, "f/a"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("deleted file came back: %v", err)
+	}
+	if m, err := dst.GetManifest(ctx, "m/1"); err != nil || string(m) != "{}" {
+		t.Errorf("manifest not restored: %q %v", m, err)
+	}
+	if _, ts, err := dst.GetProblem(ctx, "p", 2); err != nil || ts != 55 {
+		t.Errorf("problem not restored: %d %v", ts, err)
+	}
+	if n := len(collectAudit(t, dst, AuditQuery{})); n != 7 {
+		t.Errorf("expected 7 audit records restored, got %d", n)
+	}
+
+	// Refcounts came along: dropping the remaining links frees the blob.
+	for _, p := range []string{"f/b", "f/c"} {
+		if err := dst.Delete(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dst.ReadBlob(ctx, blake3Sum([]byte(big)), func(DownloadResult) error { return nil }); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("blob still referenced after deleting all paths: %v", err)
+	}
+}
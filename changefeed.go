@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/contester/advfiler/protos"
+	"github.com/dgraph-io/badger/v4"
+	bpb "github.com/dgraph-io/badger/v4/pb"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+// Change event operations.
+const (
+	OpCreate    = "create"
+	OpOverwrite = "overwrite"
+	OpDelete    = "delete"
+)
+
+// ChangeEvent describes one committed change to a directory entry.
+// Seq is the Badger commit version, so it keeps growing across restarts.
+type ChangeEvent struct {
+	Seq        uint64 `json:"seq"`
+	Op         string `json:"op"`
+	Path       string `json:"path"`
+	Blake3     string `json:"blake3,omitempty"`
+	Size       int64  `json:"size"`
+	ModuleType string `json:"moduleType,omitempty"`
+	Timestamp  int64  `json:"timestamp"`
+
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// ChangeFeed follows dirMetaKey writes through Badger's Subscribe and keeps
+// the most recent events in a ring buffer so clients can resume by Seq.
+type ChangeFeed struct {
+	store    *Store
+	capacity int
+
+	mu     sync.Mutex
+	events []ChangeEvent // ring buffer, oldest at head
+	head   int
+	// floor is the highest Seq that is no longer (or never was) in the
+	// buffer. Clients asking for anything at or below it have missed events.
+	floor  uint64
+	last   uint64
+	notify chan struct{}
+
+	cancel   context.CancelFunc
+	doneChan chan struct{}
+}
+
+// NewChangeFeed starts following the store. Changes committed before the
+// feed starts are not reported. A capacity below 1 keeps just the latest
+// event.
+func NewChangeFeed(store *Store, capacity int) *ChangeFeed {
+	capacity = max(capacity, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	start := store.db.MaxVersion()
+	c := &ChangeFeed{
+		store:    store,
+		capacity: capacity,
+		events:   make([]ChangeEvent, 0, capacity),
+		floor:    start,
+		last:     start,
+		notify:   make(chan struct{}),
+		cancel:   cancel,
+		doneChan: make(chan struct{}),
+	}
+	go c.run(ctx)
+	return c
+}
+
+func (c *ChangeFeed) run(ctx context.Context) {
+	defer close(c.doneChan)
+	for {
+		err := c.store.db.Subscribe(ctx, c.handle, []bpb.Match{{Prefix: []byte{prefixDirEntry}}})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Errorf("change feed subscription ended: %v", err)
+		// Whatever happened in between is lost; make resuming clients resync.
+		c.mu.Lock()
+		c.floor = c.store.db.MaxVersion()
+		c.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Close stops the subscription.
+func (c *ChangeFeed) Close() {
+	c.cancel()
+	<-c.doneChan
+}
+
+func (c *ChangeFeed) handle(kvs *badger.KVList) error {
+	var batch []ChangeEvent
+	for _, kv := range kvs.GetKv() {
+		path, err := extractPathFromDirMetaKey(kv.GetKey())
+		if err != nil {
+			continue
+		}
+		ev := ChangeEvent{
+			Seq:  kv.GetVersion(),
+			Path: path,
+		}
+		if len(kv.GetValue()) == 0 {
+			ev.Op = OpDelete
+			ev.Timestamp = time.Now().Unix()
+			batch = append(batch, ev)
+			continue
+		}
+		var meta byte
+		if m := kv.GetMeta(); len(m) > 0 {
+			meta = m[0]
+		}
+		switch meta {
+		case entryMetaRewritten:
+			continue
+		case entryMetaReplaced:
+			ev.Op = OpOverwrite
+		default:
+			ev.Op = OpCreate
+		}
+		var de pb.DirectoryEntry
+		if err := proto.Unmarshal(kv.GetValue(), &de); err != nil {
+			log.Errorf("change feed: decoding %q: %v", path, err)
+			continue
+		}
+		ev.ModuleType = de.GetModuleType()
+		ev.Timestamp = de.GetLastModifiedTimestamp()
+		ev.Attributes = de.GetAttributes()
+		if h := de.GetBlake3Hash(); len(h) > 0 {
+			ev.Blake3 = hex.EncodeToString(h)
+			if de.HasDigestsAndSize() {
+				ev.Size = de.GetDigestsAndSize().GetSize()
+			} else {
+				ev.Size = c.store.blobSize(h)
+			}
+		}
+		batch = append(batch, ev)
+	}
+	if len(batch) != 0 {
+		c.append(batch)
+	}
+	return nil
+}
+
+func (c *ChangeFeed) append(batch []ChangeEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, ev := range batch {
+		if len(c.events) < c.capacity {
+			c.events = append(c.events, ev)
+		} else {
+			c.floor = c.events[c.head].Seq
+			c.events[c.head] = ev
+			c.head = (c.head + 1) % c.capacity
+		}
+		if ev.Seq > c.last {
+			c.last = ev.Seq
+		}
+	}
+	close(c.notify)
+	c.notify = make(chan struct{})
+}
+
+// Since returns buffered events with Seq > since whose path starts with
+// prefix, and the latest Seq seen by the feed. ok is false if events after
+// since were already dropped from the buffer, in which case the caller must
+// resynchronize (e.g. by listing) and continue from last.
+func (c *ChangeFeed) Since(since uint64, prefix string) (events []ChangeEvent, last uint64, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if since < c.floor {
+		return nil, c.last, false
+	}
+	for i := range c.events {
+		ev := c.events[(c.head+i)%len(c.events)]
+		if ev.Seq > since && strings.HasPrefix(ev.Path, prefix) {
+			events = append(events, ev)
+		}
+	}
+	return events, c.last, true
+}
+
+// errFeedClosed is returned by Wait once the feed is closed.
+var errFeedClosed = errors.New("change feed closed")
+
+// Wait blocks until an event with Seq > since arrives, ctx is done or the
+// feed is closed.
+func (c *ChangeFeed) Wait(ctx context.Context, since uint64) error {
+	for {
+		c.mu.Lock()
+		last, ch := c.last, c.notify
+		c.mu.Unlock()
+		if last > since {
+			return nil
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.doneChan:
+			return errFeedClosed
+		}
+	}
+}
+
+// blobSize returns the stored size of an externalized blob, or 0 if unknown.
+func (s *Store) blobSize(hash []byte) int64 {
+	var size int64
+	s.view(func(tx *badger.Txn) error {
+		das, err := getProto[pb.DigestsAndSize](tx, blobDigestsKey(hash))
+		if err == nil {
+			size = das.GetSize()
+		}
+		return nil
+	})
+	return size
+}
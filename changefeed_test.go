@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestFeed(t *testing.T, s *Store, capacity int) *ChangeFeed {
+	t.Helper()
+	c := NewChangeFeed(s, capacity)
+	t.Cleanup(c.Close)
+
+	// Subscribe registers asynchronously; write until the feed sees us.
+	ctx := context.Background()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := s.Upload(ctx, FileInfo{Name: "warmup"}, strings.NewReader("w")); err != nil {
+			t.Fatal(err)
+		}
+		wctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		err := c.Wait(wctx, c.floor)
+		cancel()
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("change feed did not start")
+		}
+	}
+	return c
+}
+
+// waitEvents collects events under prefix after since until n have arrived.
+func waitEvents(t *testing.T, c *ChangeFeed, since uint64, prefix string, n int) []ChangeEvent {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for {
+		events, last, ok := c.Since(since, prefix)
+		if !ok {
+			t.Fatalf("events after %d were dropped", since)
+		}
+		if len(events) >= n {
+			return events
+		}
+		if err := c.Wait(ctx, last); err != nil {
+			t.Fatalf("got %d events, want %d", len(events), n)
+		}
+	}
+}
+
+func TestChangeFeedOps(t *testing.T) {
+	s := newTestStore(t)
+	c := newTestFeed(t, s, 100)
+	ctx := context.Background()
+	_, start, _ := c.Since(0, "")
+
+	if _, err := s.Upload(ctx, FileInfo{Name: "feed/a", ModuleType: "txt"}, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Upload(ctx, FileInfo{Name: "feed/a"}, strings.NewReader("world")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Upload(ctx, FileInfo{Name: "other/b"}, strings.NewReader("x")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "feed/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	events := waitEvents(t, c, start, "feed/", 3)
+	wantOps := []string{OpCreate, OpOverwrite, OpDelete}
+	if len(events) != len(wantOps) {
+		t.Fatalf("expected %d events, got %+v", len(wantOps), events)
+	}
+	for i, ev := range events {
+		if ev.Op != wantOps[i] || ev.Path != "feed/a" {
+			t.Errorf("event %d: expected %s feed/a, got %s %s", i, wantOps[i], ev.Op, ev.Path)
+		}
+		if i > 0 && ev.Seq <= events[i-1].Seq {
+			t.Errorf("event %d: seq %d not after %d", i, ev.Seq, events[i-1].Seq)
+		}
+	}
+	if events[0].Size != 5 || events[0].ModuleType != "txt" || len(events[0].Blake3) != 64 {
+		t.Errorf("unexpected create event: %+v", events[0])
+	}
+
+	// Resuming after the first event yields only the rest.
+	rest := waitEvents(t, c, events[0].Seq, "feed/", 2)
+	if len(rest) != 2 || rest[0].Op != OpOverwrite {
+		t.Errorf("unexpected resumed events: %+v", rest)
+	}
+}
+
+func TestChangeFeedSkipsRewrites(t *testing.T) {
+	s := newTestStore(t)
+	c := newTestFeed(t, s, 100)
+	ctx := context.Background()
+	_, start, _ := c.Since(0, "")
+
+	// The second upload externalizes the first path, rewriting its entry.
+	content := strings.Repeat("x", 100)
+	for _, p := range []string{"dup/a", "dup/b"} {
+		if _, err := s.Upload(ctx, FileInfo{Name: p}, strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Upload(ctx, FileInfo{Name: "dup/z"}, strings.NewReader("z")); err != nil {
+		t.Fatal(err)
+	}
+
+	events := waitEvents(t, c, start, "dup/", 3)
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %+v", events)
+	}
+	for _, ev := range events {
+		if ev.Op != OpCreate {
+			t.Errorf("expected only creates, got %+v", ev)
+		}
+	}
+	if events[1].Size != 100 {
+		t.Errorf("expected externalized size 100, got %d", events[1].Size)
+	}
+}
+
+func TestChangeFeedOverflow(t *testing.T) {
+	s := newTestStore(t)
+	c := newTestFeed(t, s, 2)
+	ctx := context.Background()
+	_, start, _ := c.Since(0, "")
+
+	for _, p := range []string{"o/1", "o/2", "o/3"} {
+		if _, err := s.Upload(ctx, FileInfo{Name: p}, strings.NewReader(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	for {
+		if _, _, ok := c.Since(start, ""); !ok {
+			break
+		}
+		_, last, _ := c.Since(start, "")
+		if err := c.Wait(wctx, last); err != nil {
+			t.Fatal("expected the buffer to overflow")
+		}
+	}
+}
+
+func TestChangeFeedZeroCapacity(t *testing.T) {
+	s := newTestStore(t)
+	c := newTestFeed(t, s, 0)
+	_, start, _ := c.Since(0, "")
+
+	if _, err := s.Upload(context.Background(), FileInfo{Name: "z/1"}, strings.NewReader("z")); err != nil {
+		t.Fatal(err)
+	}
+	if events := waitEvents(t, c, start, "z/", 1); events[0].Path != "z/1" {
+		t.Errorf("expected the latest event, got %+v", events)
+	}
+}
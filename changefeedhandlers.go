@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/contester/advfiler/protos"
+)
+
+const (
+	defaultPollTimeout = 30 * time.Second
+	maxPollTimeout     = 5 * time.Minute
+	sseKeepalive       = 15 * time.Second
+)
+
+type changesServer struct {
+	feed        *ChangeFeed
+	urlPrefix   string
+	authChecker AuthCheck
+}
+
+func NewChangesServer(feed *ChangeFeed, authChecker AuthCheck) *changesServer {
+	return &changesServer{feed: feed, urlPrefix: "/changes/", authChecker: authChecker}
+}
+
+type changesResponse struct {
+	Last   uint64        `json:"last"`
+	Reset  bool          `json:"reset,omitempty"`
+	Events []ChangeEvent `json:"events"`
+}
+
+// parseSince reads the resume point from Last-Event-ID (SSE reconnects) or
+// the since parameter. Without either, the client starts at the live tail.
+func (c *changesServer) parseSince(r *http.Request) (uint64, error) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("since")
+	}
+	if v == "" {
+		_, last, _ := c.feed.Since(^uint64(0), "")
+		return last, nil
+	}
+	return strconv.ParseUint(v, 10, 64)
+}
+
+// handleChanges serves GET /changes/<prefix>. Clients sending
+// Accept: text/event-stream get a Server-Sent Events stream; everyone else
+// gets a long-poll JSON response that returns as soon as there is at least
+// one matching event, or after timeout seconds with an empty list.
+func (c *changesServer) handleChanges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	prefix, err := trimOr(r.URL.Path, c.urlPrefix, "changes url")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if v, _ := c.authChecker.Check(r.Context(), tokenFromHeader(r), pb.AuthAction_A_READ, prefix); !v {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	since, err := c.parseSince(r)
+	if err != nil {
+		http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		c.serveSSE(w, r, prefix, since)
+		return
+	}
+
+	timeout := defaultPollTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs < 0 {
+			http.Error(w, "invalid timeout", http.StatusBadRequest)
+			return
+		}
+		timeout = min(time.Duration(secs)*time.Second, maxPollTimeout)
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	var resp changesResponse
+	for {
+		events, last, ok := c.feed.Since(since, prefix)
+		resp = changesResponse{Last: last, Reset: !ok, Events: events}
+		if !ok || len(events) != 0 {
+			break
+		}
+		// Nothing under our prefix yet: skip what we've seen and wait.
+		since = last
+		if c.feed.Wait(ctx, since) != nil {
+			break
+		}
+	}
+	if resp.Events == nil {
+		resp.Events = []ChangeEvent{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(&resp)
+}
+
+func (c *changesServer) serveSSE(w http.ResponseWriter, r *http.Request, prefix string, since uint64) {
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	ctx := r.Context()
+	for {
+		events, last, ok := c.feed.Since(since, prefix)
+		if !ok {
+			// The client fell out of the buffer: tell it to resync, then carry
+			// on from the current position.
+			fmt.Fprintf(w, "id: %d\nevent: reset\ndata: {\"last\":%d}\n\n", last, last)
+		}
+		for _, ev := range events {
+			b, _ := json.Marshal(&ev)
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Seq, ev.Op, b)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		since = last
+
+		wctx, cancel := context.WithTimeout(ctx, sseKeepalive)
+		err := c.feed.Wait(wctx, since)
+		cancel()
+		if ctx.Err() != nil || errors.Is(err, errFeedClosed) {
+			return
+		}
+		if err != nil {
+			fmt.Fprint(w, ": keepalive\n\n")
+		}
+	}
+}
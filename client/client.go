@@ -0,0 +1,132 @@
+// Package client is a Go client for the advfiler HTTP API.
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrUnauthorized is matched (with errors.Is) by errors for requests the
+// server refused for lack of a valid token.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Error is returned for any non-2xx response. It matches fs.ErrNotExist for
+// 404 and ErrUnauthorized for 401.
+type Error struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Status
+	}
+	return e.Status + ": " + e.Message
+}
+
+func (e *Error) Is(target error) bool {
+	switch target {
+	case fs.ErrNotExist:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	}
+	return false
+}
+
+// Client talks to one advfiler server. It is safe for concurrent use.
+type Client struct {
+	base  string
+	token string
+
+	// HTTPClient is used for requests; http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// New returns a client for the server at baseURL (e.g.
+// "http://localhost:9094/"), authenticating with token if it's not empty.
+func New(baseURL, token string) *Client {
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	return &Client{base: baseURL, token: token}
+}
+
+// fsPath escapes a filer path for use under /fs/.
+func fsPath(path string) string {
+	segs := strings.Split(path, "/")
+	for i, s := range segs {
+		segs[i] = url.PathEscape(s)
+	}
+	return "fs/" + strings.Join(segs, "/")
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// send sends req, whatever the response status.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return hc.Do(req)
+}
+
+// do sends req and turns non-2xx responses into an *Error.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &Error{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Message:    strings.TrimSpace(string(msg)),
+		}
+	}
+	return resp, nil
+}
+
+// call is do for requests whose response body doesn't matter.
+func (c *Client) call(ctx context.Context, method, path string, body io.Reader, h http.Header) error {
+	req, err := c.newRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	for k, v := range h {
+		req.Header[k] = v
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// get returns the body of a successful GET; the caller closes it.
+func (c *Client) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
@@ -0,0 +1,372 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/contester/advfiler/hashes"
+)
+
+// FileInfo is what the server reports about a file.
+type FileInfo struct {
+	Path       string
+	Size       int64
+	ModuleType string
+	ModTime    time.Time
+	Digests    hashes.Digests
+	// Attributes are the user-defined X-Fs-Meta-* attributes, keys lowercase.
+	Attributes map[string]string
+}
+
+const attributeHeaderPrefix = "X-Fs-Meta-"
+
+func fileInfoFromHeader(path string, h http.Header) FileInfo {
+	fi := FileInfo{
+		Path:       path,
+		ModuleType: h.Get("X-Fs-Module-Type"),
+		Digests:    hashes.ParseDigests(h),
+	}
+	for k, v := range h {
+		if name, ok := strings.CutPrefix(k, attributeHeaderPrefix); ok && len(v) != 0 {
+			if fi.Attributes == nil {
+				fi.Attributes = make(map[string]string)
+			}
+			fi.Attributes[strings.ToLower(name)] = v[0]
+		}
+	}
+	fi.Size, _ = strconv.ParseInt(h.Get("X-Fs-Content-Length"), 10, 64)
+	if lm := h.Get("Last-Modified"); lm != "" {
+		fi.ModTime, _ = http.ParseTime(lm)
+	}
+	return fi
+}
+
+// UploadStatus is the server's response to an upload.
+type UploadStatus struct {
+	Digests    map[string]string
+	Size       int64
+	Hardlinked bool
+	// Replaced is set if the upload overwrote an existing file.
+	Replaced bool
+}
+
+// Upload stores the contents of r at path. If r is an io.Seeker its digests
+// are computed up front and sent along, so the server refuses corrupted
+// data; otherwise they're computed on the way and compared with the ones the
+// server reports. r is read from its current offset and is not closed.
+func (c *Client) Upload(ctx context.Context, path string, r io.Reader, moduleType string) (*UploadStatus, error) {
+	var (
+		sent hashes.Digests
+		h    *hashes.Hashes
+		size int64 = -1
+		body       = r
+	)
+	if rs, ok := r.(io.ReadSeeker); ok {
+		start, err := rs.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		hs := hashes.NewHashes()
+		if size, err = io.Copy(hs, rs); err != nil {
+			return nil, err
+		}
+		if _, err := rs.Seek(start, io.SeekStart); err != nil {
+			return nil, err
+		}
+		sent = hs.Digests()
+	} else {
+		h = hashes.NewHashes()
+		body = io.TeeReader(r, h)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPut, fsPath(path), io.NopCloser(body))
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+		hashes.AddDigests(req.Header, sent)
+	}
+	if moduleType != "" {
+		req.Header.Set("X-Fs-Module-Type", moduleType)
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var st UploadStatus
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		return nil, err
+	}
+	if h != nil {
+		sent = h.Digests()
+	}
+	if err := hashes.VerifyDigests(sent, hashes.DigestsFromMap(st.Digests)); err != nil {
+		return &st, fmt.Errorf("%s: %w", path, err)
+	}
+	return &st, nil
+}
+
+// File is a file being downloaded. Read returns an error instead of io.EOF
+// if the content doesn't match the digests the server sent.
+type File struct {
+	FileInfo
+	body io.ReadCloser
+	h    *hashes.Hashes
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	n, err := f.body.Read(p)
+	f.h.Write(p[:n])
+	if err == io.EOF {
+		if verr := hashes.VerifyDigests(f.h.Digests(), f.Digests); verr != nil {
+			return n, fmt.Errorf("%s: %w", f.Path, verr)
+		}
+	}
+	return n, err
+}
+
+func (f *File) Close() error {
+	return f.body.Close()
+}
+
+// Download opens path for reading. The caller must close the returned file.
+func (c *Client) Download(ctx context.Context, path string) (*File, error) {
+	resp, err := c.get(ctx, fsPath(path))
+	if err != nil {
+		return nil, err
+	}
+	return &File{
+		FileInfo: fileInfoFromHeader(path, resp.Header),
+		body:     resp.Body,
+		h:        hashes.NewHashes(),
+	}, nil
+}
+
+// Stat returns the metadata of path without its content.
+func (c *Client) Stat(ctx context.Context, path string) (*FileInfo, error) {
+	req, err := c.newRequest(ctx, http.MethodHead, fsPath(path), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	fi := fileInfoFromHeader(path, resp.Header)
+	return &fi, nil
+}
+
+// List returns the paths of all files under the directory prefix, sorted.
+// A missing trailing slash is added; "" lists everything.
+func (c *Client) List(ctx context.Context, prefix string) ([]string, error) {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	resp, err := c.get(ctx, fsPath(prefix))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var names []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if s := scanner.Text(); s != "" {
+			names = append(names, s)
+		}
+	}
+	return names, scanner.Err()
+}
+
+// SetAttributes merges attrs into the attributes of path without touching
+// its content; an empty value removes the attribute. It returns the
+// resulting attributes.
+func (c *Client) SetAttributes(ctx context.Context, path string, attrs map[string]string) (map[string]string, error) {
+	req, err := c.newRequest(ctx, http.MethodPatch, fsPath(path), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range attrs {
+		req.Header.Set(attributeHeaderPrefix+k, v)
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var result map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Delete removes path.
+func (c *Client) Delete(ctx context.Context, path string) error {
+	return c.call(ctx, http.MethodDelete, fsPath(path), nil, nil)
+}
+
+// ImportedFile is what happened to one member of an imported archive.
+// Outcome is "created", "replaced", "skipped" or "conflicted", and empty if
+// the file failed to import.
+type ImportedFile struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	Hardlinked bool   `json:"hardlinked"`
+	Outcome    string `json:"outcome"`
+	Error      string `json:"error"`
+}
+
+// ImportReport is the server's account of an archive import. Error is set
+// if the archive could not be read to the end. TarImport and ZipImport
+// return the report along with an *Error when anything failed.
+type ImportReport struct {
+	Files      []ImportedFile `json:"files"`
+	RealSize   int64          `json:"realSize"`
+	SavedSize  int64          `json:"savedSize"`
+	Created    int            `json:"created"`
+	Replaced   int            `json:"replaced"`
+	Skipped    int            `json:"skipped"`
+	Conflicted int            `json:"conflicted"`
+	Error      string         `json:"error"`
+}
+
+// TarImport uploads a tar archive, compressed with gzip, zstd or xz or not
+// at all, storing each regular file under its name in the archive. conflict
+// says what to do with paths that exist: "overwrite" (also the default for
+// ""), "skip-identical", "skip-existing", "newer" or "fail".
+func (c *Client) TarImport(ctx context.Context, r io.Reader, conflict string) (*ImportReport, error) {
+	return c.importArchive(ctx, "tar/?conflict="+url.QueryEscape(conflict), r)
+}
+
+// ZipImport uploads a zip archive, storing each regular file under prefix.
+// conflict is as for TarImport.
+func (c *Client) ZipImport(ctx context.Context, r io.Reader, prefix, conflict string) (*ImportReport, error) {
+	return c.importArchive(ctx, "zip/?prefix="+url.QueryEscape(prefix)+"&conflict="+url.QueryEscape(conflict), r)
+}
+
+func (c *Client) importArchive(ctx context.Context, endpoint string, r io.Reader) (*ImportReport, error) {
+	req, err := c.newRequest(ctx, http.MethodPut, endpoint, io.NopCloser(r))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		var rep ImportReport
+		if err := json.NewDecoder(resp.Body).Decode(&rep); err != nil {
+			return nil, err
+		}
+		return &rep, nil
+	}
+	msg, _ := io.ReadAll(resp.Body)
+	e := &Error{StatusCode: resp.StatusCode, Status: resp.Status, Message: strings.TrimSpace(string(msg))}
+	var rep ImportReport
+	if resp.Header.Get("Content-Type") != "application/json" || json.Unmarshal(msg, &rep) != nil {
+		return nil, e
+	}
+	if e.Message = rep.Error; e.Message == "" {
+		e.Message = "some files failed to import"
+	}
+	return &rep, e
+}
+
+// MultiDownloadEntry asks for Source to be stored as Destination in the
+// archive. The server appends ".<module type>" to Destination if the file
+// has one.
+type MultiDownloadEntry struct {
+	Source      string
+	Destination string
+}
+
+// MultiDownload returns a zip archive of the given files, leaving out
+// missing ones. The caller must close it.
+func (c *Client) MultiDownload(ctx context.Context, entries []MultiDownloadEntry) (io.ReadCloser, error) {
+	return c.MultiDownloadWith(ctx, entries, MultiDownloadOptions{})
+}
+
+// MultiDownloadOptions tune MultiDownloadWith.
+type MultiDownloadOptions struct {
+	// Missing says what the server does about sources that don't exist:
+	// "skip" (the default), "fail" the request with a not-found error, or
+	// "manifest" to list them in a JSON member named ErrorManifest
+	// ("errors.json" by default).
+	Missing       string
+	ErrorManifest string
+	// Summary, if set, names a JSON member listing the size and digests of
+	// every entry.
+	Summary string
+	// Tar asks for a tar archive instead of a zip.
+	Tar bool
+}
+
+// MultiDownloadWith returns an archive of the given files. A Source ending
+// in "/" or containing glob characters stands for every file under it or
+// matching it, and Destination is then the directory they go to. The
+// caller must close the archive; reading it fails at the end if the server
+// had to cut it short.
+func (c *Client) MultiDownloadWith(ctx context.Context, entries []MultiDownloadEntry, opts MultiDownloadOptions) (io.ReadCloser, error) {
+	body, err := json.Marshal(struct {
+		Entry                           []MultiDownloadEntry
+		Missing, ErrorManifest, Summary string `json:",omitempty"`
+	}{entries, opts.Missing, opts.ErrorManifest, opts.Summary})
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, "fs/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if opts.Tar {
+		req.Header.Set("Accept", "application/x-tar")
+	} else {
+		req.Header.Set("Accept", "application/zip")
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveBody{resp}, nil
+}
+
+// ErrArchiveTruncated is returned at the end of an archive the server
+// failed to finish.
+var ErrArchiveTruncated = errors.New("archive cut short")
+
+// archiveBody turns the server's X-Fs-Archive-Error trailer into an error.
+type archiveBody struct {
+	resp *http.Response
+}
+
+func (b *archiveBody) Read(p []byte) (int, error) {
+	n, err := b.resp.Body.Read(p)
+	if err == io.EOF {
+		if msg := b.resp.Trailer.Get("X-Fs-Archive-Error"); msg != "" {
+			err = fmt.Errorf("%w: %s", ErrArchiveTruncated, msg)
+		}
+	}
+	return n, err
+}
+
+func (b *archiveBody) Close() error {
+	return b.resp.Body.Close()
+}
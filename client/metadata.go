@@ -0,0 +1,143 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	pb "github.com/contester/advfiler/protos"
+	"google.golang.org/protobuf/proto"
+)
+
+// PackageRequest selects what ProtoPackage returns: the submit's source,
+// and for each test of Problem ("problem/...") that has an output in the
+// testing, its input, answer and output.
+type PackageRequest struct {
+	Contest, Submit, Testing, Problem string
+	// SizeLimit truncates inputs, answers and outputs; the server default
+	// applies if zero.
+	SizeLimit int64
+}
+
+// ProtoPackage fetches a testing record.
+func (c *Client) ProtoPackage(ctx context.Context, pr PackageRequest) (*pb.TestingRecord, error) {
+	q := url.Values{
+		"contest": {pr.Contest},
+		"submit":  {pr.Submit},
+		"testing": {pr.Testing},
+		"problem": {pr.Problem},
+	}
+	if pr.SizeLimit != 0 {
+		q.Set("sizeLimit", strconv.FormatInt(pr.SizeLimit, 10))
+	}
+	resp, err := c.get(ctx, "protopackage?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var result pb.TestingRecord
+	if err := proto.Unmarshal(b, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Manifest is a problem manifest.
+type Manifest struct {
+	Id       string `json:"id"`
+	Revision int    `json:"revision"`
+
+	TestCount       int    `json:"testCount"`
+	TimeLimitMicros int64  `json:"timeLimitMicros"`
+	MemoryLimit     int64  `json:"memoryLimit"`
+	Stdio           bool   `json:"stdio,omitempty"`
+	TesterName      string `json:"testerName"`
+	Answers         []int  `json:"answers,omitempty"`
+	InteractorName  string `json:"interactorName,omitempty"`
+	CombinedHash    string `json:"combinedHash,omitempty"`
+}
+
+// GetManifests returns the manifest of id at revision, or all its revisions
+// newest first if revision is 0. An empty id returns every manifest.
+func (c *Client) GetManifests(ctx context.Context, id string, revision int) ([]Manifest, error) {
+	q := url.Values{"id": {id}}
+	if revision != 0 {
+		q.Set("revision", strconv.Itoa(revision))
+	}
+	resp, err := c.get(ctx, "problem/get/?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var result []Manifest
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, err
+}
+
+// SetManifest stores m under its id and revision.
+func (c *Client) SetManifest(ctx context.Context, m Manifest) error {
+	b, err := json.Marshal(&m)
+	if err != nil {
+		return err
+	}
+	return c.call(ctx, http.MethodPut, "problem/set/", bytes.NewReader(b), nil)
+}
+
+func timestampHeader(ts int64) http.Header {
+	if ts == 0 {
+		return nil
+	}
+	return http.Header{"X-Timestamp": {strconv.FormatInt(ts, 10)}}
+}
+
+// GetContestXML returns the contest XML stored under key and its timestamp.
+func (c *Client) GetContestXML(ctx context.Context, key string) ([]byte, int64, error) {
+	resp, err := c.get(ctx, "xml/contest/?"+url.Values{"key": {key}}.Encode())
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	ts, _ := strconv.ParseInt(resp.Header.Get("X-Timestamp"), 10, 64)
+	return data, ts, err
+}
+
+// SetContestXML stores contest XML under key. A zero timestamp means now.
+func (c *Client) SetContestXML(ctx context.Context, key string, data []byte, timestamp int64) error {
+	return c.call(ctx, http.MethodPut, "xml/contest/?"+url.Values{"key": {key}}.Encode(),
+		bytes.NewReader(data), timestampHeader(timestamp))
+}
+
+// GetProblemXML returns the problem XML stored under key at revision, or
+// the latest revision if revision is negative, along with the revision and
+// timestamp.
+func (c *Client) GetProblemXML(ctx context.Context, key string, revision int64) (data []byte, rev, timestamp int64, err error) {
+	q := url.Values{"key": {key}}
+	if revision >= 0 {
+		q.Set("revision", strconv.FormatInt(revision, 10))
+	}
+	resp, err := c.get(ctx, "xml/problem/?"+q.Encode())
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer resp.Body.Close()
+	data, err = io.ReadAll(resp.Body)
+	rev, _ = strconv.ParseInt(resp.Header.Get("X-Revision"), 10, 64)
+	timestamp, _ = strconv.ParseInt(resp.Header.Get("X-Timestamp"), 10, 64)
+	return data, rev, timestamp, err
+}
+
+// SetProblemXML stores problem XML under key and revision. A zero timestamp
+// means now.
+func (c *Client) SetProblemXML(ctx context.Context, key string, revision int64, data []byte, timestamp int64) error {
+	q := url.Values{"key": {key}, "revision": {strconv.FormatInt(revision, 10)}}
+	return c.call(ctx, http.MethodPut, "xml/problem/?"+q.Encode(), bytes.NewReader(data), timestampHeader(timestamp))
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/contester/advfiler/hashes"
+)
+
+const (
+	defaultChunkSize = 8 << 20
+	// resumableRetries is how many failures in a row UploadResumable takes
+	// before giving up.
+	resumableRetries = 5
+)
+
+// UploadResumable stores the contents of r at path through a resumable
+// upload session, sending chunkSize bytes per request (0 means 8MiB). When
+// a request fails it asks the server how much has arrived and resumes from
+// there. Digests are sent along, so the server refuses corrupted data.
+func (c *Client) UploadResumable(ctx context.Context, path string, r io.ReadSeeker, moduleType string, chunkSize int64) (*UploadStatus, error) {
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	h := hashes.NewHashes()
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := c.createUpload(ctx, size)
+	if err != nil {
+		return nil, err
+	}
+	var offset int64
+	for failures := 0; offset < size; {
+		if _, err := r.Seek(start+offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		next, err := c.patchUpload(ctx, id, offset, io.LimitReader(r, min(chunkSize, size-offset)), min(chunkSize, size-offset))
+		if err == nil {
+			offset, failures = next, 0
+			continue
+		}
+		var e *Error
+		if ctx.Err() != nil || errors.As(err, &e) && e.StatusCode/100 == 4 && e.StatusCode != http.StatusConflict {
+			return nil, err
+		}
+		if failures++; failures > resumableRetries {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Duration(failures) * time.Second):
+		}
+		if next, herr := c.uploadOffset(ctx, id); herr == nil {
+			offset = next
+		}
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPut, "upload/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Fs-Path", path)
+	if moduleType != "" {
+		req.Header.Set("X-Fs-Module-Type", moduleType)
+	}
+	hashes.AddDigests(req.Header, h.Digests())
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var st UploadStatus
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (c *Client) createUpload(ctx context.Context, size int64) (string, error) {
+	req, err := c.newRequest(ctx, http.MethodPost, "upload/", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Upload-Length", strconv.FormatInt(size, 10))
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return "", errors.New("no Location in the upload creation response")
+	}
+	return path.Base(loc), nil
+}
+
+func (c *Client) patchUpload(ctx context.Context, id string, offset int64, body io.Reader, n int64) (int64, error) {
+	req, err := c.newRequest(ctx, http.MethodPatch, "upload/"+id, io.NopCloser(body))
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = n
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+}
+
+func (c *Client) uploadOffset(ctx context.Context, id string) (int64, error) {
+	req, err := c.newRequest(ctx, http.MethodHead, "upload/"+id, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+}
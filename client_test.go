@@ -0,0 +1,240 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/contester/advfiler/client"
+)
+
+// newTestServer serves the filer, metadata and XML endpoints of a fresh
+// store, with "tok" as the only valid token.
+func newTestServer(t *testing.T) (*Store, *httptest.Server) {
+	t.Helper()
+	s := newTestStore(t)
+	ac := NewAuthChecker([]string{"tok"}, nil, nil)
+	f := NewFiler(s, ac)
+	ms := NewMetadataServer(s, ac)
+	xs := NewXMLServer(s, ac)
+	mux := http.NewServeMux()
+	mux.Handle("/fs/", f)
+	mux.HandleFunc("/tar/", f.handleTarUpload)
+	mux.HandleFunc("/zip/", f.handleZipUpload)
+	mux.HandleFunc("/protopackage", f.handleProtoPackage)
+	mux.HandleFunc("/problem/set/", ms.handleSetManifest)
+	mux.HandleFunc("/problem/get/", ms.handleGetManifest)
+	mux.HandleFunc("/xml/contest/", xs.handleContest)
+	mux.HandleFunc("/xml/problem/", xs.handleProblem)
+	us := NewUploadServer(s, ac, time.Hour)
+	t.Cleanup(us.Close)
+	mux.Handle("/upload/", us)
+	srv := httptest.NewServer(withRetryAfter(mux))
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+// newTestRequest returns a client request without credentials.
+func newTestRequest(t *testing.T, method, url string, body io.Reader) *http.Request {
+	t.Helper()
+	r, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// authorized returns a client request carrying the "tok" token.
+func authorized(t *testing.T, method, url string, body io.Reader) *http.Request {
+	t.Helper()
+	r := newTestRequest(t, method, url, body)
+	r.Header.Set("Authorization", "Bearer tok")
+	return r
+}
+
+// setHeaders sets the headers given as name, value pairs on r.
+func setHeaders(r *http.Request, hdr ...string) *http.Request {
+	for i := 0; i+1 < len(hdr); i += 2 {
+		r.Header.Set(hdr[i], hdr[i+1])
+	}
+	return r
+}
+
+// doRequest sends r with the headers given as name, value pairs added, and
+// returns the response with its body read and closed.
+func doRequest(t *testing.T, r *http.Request, hdr ...string) (*http.Response, string) {
+	t.Helper()
+	resp, err := http.DefaultClient.Do(setHeaders(r, hdr...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(b)
+}
+
+func TestClientFiles(t *testing.T) {
+	_, srv := newTestServer(t)
+	c := client.New(srv.URL, "tok")
+	ctx := context.Background()
+
+	big := strings.Repeat("c", 1000)
+	if _, err := c.Upload(ctx, "d/a b", strings.NewReader(big), "txt"); err != nil {
+		t.Fatal(err)
+	}
+	// A non-seekable reader takes the verify-after path.
+	st, err := c.Upload(ctx, "d/b", io.MultiReader(strings.NewReader(big)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Hardlinked || st.Size != 1000 {
+		t.Errorf("unexpected upload status: %+v", st)
+	}
+
+	fi, err := c.Stat(ctx, "d/a b")
+	if err != nil || fi.Size != 1000 || fi.ModuleType != "txt" || len(fi.Digests.SHA256) == 0 {
+		t.Errorf("stat: %+v %v", fi, err)
+	}
+	f, err := c.Download(ctx, "d/a b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(f)
+	f.Close()
+	if err != nil || string(got) != big {
+		t.Errorf("download: %d bytes, %v", len(got), err)
+	}
+
+	names, err := c.List(ctx, "d")
+	if err != nil || strings.Join(names, ",") != "d/a b,d/b" {
+		t.Errorf("list: %v %v", names, err)
+	}
+
+	if err := c.Delete(ctx, "d/b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Stat(ctx, "d/b"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected ErrNotExist, got %v", err)
+	}
+	if _, err := c.Download(ctx, "d/b"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected ErrNotExist, got %v", err)
+	}
+	bad := client.New(srv.URL, "wrong")
+	if _, err := bad.Upload(ctx, "x", strings.NewReader("x"), ""); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+
+	var tb bytes.Buffer
+	tw := tar.NewWriter(&tb)
+	tw.WriteHeader(&tar.Header{Name: "t/1", Size: 3, Mode: 0644, Typeflag: tar.TypeReg})
+	tw.Write([]byte("one"))
+	tw.Close()
+	if _, err := c.TarImport(ctx, &tb, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := c.MultiDownload(ctx, []client.MultiDownloadEntry{
+		{Source: "t/1", Destination: "first"},
+		{Source: "d/a b", Destination: "second"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zb, err := io.ReadAll(zr)
+	zr.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(zb), int64(len(zb)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var znames []string
+	for _, zf := range z.File {
+		znames = append(znames, zf.Name)
+	}
+	if strings.Join(znames, ",") != "first,second.txt" {
+		t.Errorf("unexpected zip members: %v", znames)
+	}
+}
+
+func TestClientDownloadDetectsCorruption(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Digest", "sha-256=47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=")
+		io.WriteString(w, "not empty")
+	}))
+	defer srv.Close()
+	f, err := client.New(srv.URL, "").Download(context.Background(), "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := io.ReadAll(f); err == nil {
+		t.Fatal("expected a digest mismatch")
+	}
+}
+
+func TestClientMetadata(t *testing.T) {
+	s, srv := newTestServer(t)
+	c := client.New(srv.URL, "tok")
+	ctx := context.Background()
+
+	if err := c.SetManifest(ctx, client.Manifest{Id: "p", Revision: 2, TestCount: 5}); err != nil {
+		t.Fatal(err)
+	}
+	ms, err := c.GetManifests(ctx, "p", 0)
+	if err != nil || len(ms) != 1 || ms[0].TestCount != 5 {
+		t.Errorf("manifests: %+v %v", ms, err)
+	}
+
+	if err := c.SetContestXML(ctx, "c", []byte("<contest/>"), 10); err != nil {
+		t.Fatal(err)
+	}
+	if data, ts, err := c.GetContestXML(ctx, "c"); err != nil || string(data) != "<contest/>" || ts != 10 {
+		t.Errorf("contest: %q %d %v", data, ts, err)
+	}
+	if err := c.SetProblemXML(ctx, "pr", 3, []byte("<problem/>"), 20); err != nil {
+		t.Fatal(err)
+	}
+	if data, rev, ts, err := c.GetProblemXML(ctx, "pr", -1); err != nil || string(data) != "<problem/>" || rev != 3 || ts != 20 {
+		t.Errorf("problem: %q %d %d %v", data, rev, ts, err)
+	}
+	if _, _, _, err := c.GetProblemXML(ctx, "pr", 4); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected ErrNotExist, got %v", err)
+	}
+
+	for path, content := range map[string]string{
+		"submit/1/2/sourceModule":          "int main() {}",
+		"problem/p/tests/1/input.txt":      "in",
+		"problem/p/tests/1/answer.txt":     "ans",
+		"submit/1/2/3/1/output":            "out",
+		"problem/p/tests/2/input.txt":      "no output for this one",
+		"problem/p/tests/notanumber/x.txt": "ignored",
+	} {
+		if _, err := s.Upload(ctx, FileInfo{Name: path}, strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec, err := c.ProtoPackage(ctx, client.PackageRequest{Contest: "1", Submit: "2", Testing: "3", Problem: "problem/p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rec.GetSolution().GetData()) != "int main() {}" || len(rec.GetTest()) != 1 {
+		t.Fatalf("unexpected testing record: %v", rec)
+	}
+	if tr := rec.GetTest()[0]; string(tr.GetInput().GetData()) != "in" || string(tr.GetOutput().GetData()) != "out" {
+		t.Errorf("unexpected test record: %v", tr)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	pb "github.com/contester/advfiler/protos"
+)
+
+// ConflictPolicy says what Upload does when the path is already taken.
+// Bulk imports take it as ?conflict=.
+type ConflictPolicy string
+
+const (
+	// ConflictOverwrite replaces the existing file. It's the default.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictSkipIdentical leaves the file alone if the content is the
+	// same, and replaces it otherwise.
+	ConflictSkipIdentical ConflictPolicy = "skip-identical"
+	// ConflictSkipExisting never touches an existing file.
+	ConflictSkipExisting ConflictPolicy = "skip-existing"
+	// ConflictNewer replaces the file only if the upload's timestamp is
+	// later than the stored one.
+	ConflictNewer ConflictPolicy = "newer"
+	// ConflictFail makes Upload return ErrConflict.
+	ConflictFail ConflictPolicy = "fail"
+)
+
+// ErrConflict is returned by Upload under ConflictFail if the path exists.
+var ErrConflict = errors.New("path already exists")
+
+func parseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(s); p {
+	case "":
+		return ConflictOverwrite, nil
+	case ConflictOverwrite, ConflictSkipIdentical, ConflictSkipExisting, ConflictNewer, ConflictFail:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q", s)
+}
+
+type conflictPolicyKey struct{}
+
+// WithConflictPolicy attaches p to ctx for the following Store uploads.
+func WithConflictPolicy(ctx context.Context, p ConflictPolicy) context.Context {
+	return context.WithValue(ctx, conflictPolicyKey{}, p)
+}
+
+// resolveConflict decides, inside Upload's transaction, whether an upload
+// of content hashed blake3 with timestamp ts should skip the existing entry.
+func resolveConflict(ctx context.Context, existing *pb.DirectoryEntry, blake3 []byte, ts int64) (skip bool, err error) {
+	p, _ := ctx.Value(conflictPolicyKey{}).(ConflictPolicy)
+	switch p {
+	case ConflictSkipIdentical:
+		h := existing.GetBlake3Hash()
+		if len(h) == 0 {
+			h = emptyDigests.Blake3
+		}
+		return bytes.Equal(h, blake3), nil
+	case ConflictSkipExisting:
+		return true, nil
+	case ConflictNewer:
+		return ts <= existing.GetLastModifiedTimestamp(), nil
+	case ConflictFail:
+		return false, ErrConflict
+	}
+	return false, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/contester/advfiler/client"
+)
+
+func TestConflictPolicies(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	put := func(ctx context.Context, content string, ts int64) (UploadStatus, error) {
+		return s.Upload(ctx, FileInfo{Name: "f", TimestampUnix: ts}, strings.NewReader(content))
+	}
+	content := func() string {
+		var b []byte
+		s.Download(ctx, "f", func(dr DownloadResult) error {
+			b = make([]byte, dr.Size)
+			_, err := dr.Body.Read(b)
+			return err
+		})
+		return string(b)
+	}
+
+	if st, err := put(WithConflictPolicy(ctx, ConflictFail), "v1", 100); err != nil || st.Replaced || st.Skipped {
+		t.Fatalf("create: %+v %v", st, err)
+	}
+	if _, err := put(WithConflictPolicy(ctx, ConflictFail), "v2", 200); !errors.Is(err, ErrConflict) {
+		t.Errorf("fail: %v", err)
+	}
+	if st, err := put(WithConflictPolicy(ctx, ConflictSkipExisting), "v2", 200); err != nil || !st.Skipped {
+		t.Errorf("skip-existing: %+v %v", st, err)
+	}
+	if st, err := put(WithConflictPolicy(ctx, ConflictSkipIdentical), "v1", 200); err != nil || !st.Skipped {
+		t.Errorf("skip-identical, same: %+v %v", st, err)
+	}
+	if st, err := put(WithConflictPolicy(ctx, ConflictNewer), "v2", 50); err != nil || !st.Skipped {
+		t.Errorf("newer, older upload: %+v %v", st, err)
+	}
+	if content() != "v1" {
+		t.Fatalf("skipped uploads changed the file: %q", content())
+	}
+	if st, err := put(WithConflictPolicy(ctx, ConflictNewer), "v2", 150); err != nil || !st.Replaced {
+		t.Errorf("newer, newer upload: %+v %v", st, err)
+	}
+	if st, err := put(WithConflictPolicy(ctx, ConflictSkipIdentical), "v3", 200); err != nil || !st.Replaced {
+		t.Errorf("skip-identical, different: %+v %v", st, err)
+	}
+	if content() != "v3" {
+		t.Errorf("content: %q", content())
+	}
+}
+
+func TestImportConflicts(t *testing.T) {
+	_, srv := newTestServer(t)
+	ctx := context.Background()
+	c := client.New(srv.URL, "tok")
+	archive := func(files ...string) *bytes.Buffer {
+		var b bytes.Buffer
+		tw := tar.NewWriter(&b)
+		for i := 0; i < len(files); i += 2 {
+			tw.WriteHeader(&tar.Header{Name: files[i], Size: int64(len(files[i+1])), Mode: 0644,
+				Typeflag: tar.TypeReg, ModTime: time.Unix(1000, 0)})
+			tw.Write([]byte(files[i+1]))
+		}
+		tw.Close()
+		return &b
+	}
+	if _, err := c.TarImport(ctx, archive("a", "1", "b", "2"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := c.TarImport(ctx, archive("a", "1", "b", "changed", "c", "3"), "skip-identical")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Skipped != 1 || rep.Replaced != 1 || rep.Created != 1 || rep.Files[0].Outcome != "skipped" || rep.Files[1].Outcome != "replaced" {
+		t.Errorf("skip-identical: %+v", rep)
+	}
+	rep, err = c.TarImport(ctx, archive("a", "x", "d", "4"), "fail")
+	var ce *client.Error
+	if !errors.As(err, &ce) || ce.StatusCode != http.StatusConflict || rep == nil {
+		t.Fatalf("fail: %v", err)
+	}
+	if rep.Conflicted != 1 || rep.Created != 1 || rep.Files[0].Outcome != "conflicted" || rep.Files[0].Error == "" {
+		t.Errorf("fail: %+v", rep)
+	}
+	if _, err := c.TarImport(ctx, archive(), "sometimes"); err == nil {
+		t.Error("an unknown policy was accepted")
+	}
+}
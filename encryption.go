@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// readEncryptionKey reads the Badger encryption key from file or, failing
+// that, from the systemd credential of that name in $CREDENTIALS_DIRECTORY.
+// It returns nil, for no encryption, when neither is there.
+func readEncryptionKey(file, credential string) ([]byte, error) {
+	if file == "" {
+		dir := os.Getenv("CREDENTIALS_DIRECTORY")
+		if dir == "" || credential == "" {
+			return nil, nil
+		}
+		file = filepath.Join(dir, credential)
+		if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parseEncryptionKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return key, nil
+}
+
+func validKeyLength(n int) bool {
+	return n == 16 || n == 24 || n == 32
+}
+
+// parseEncryptionKey takes an AES key as hex, surrounding whitespace
+// allowed, or raw bytes.
+func parseEncryptionKey(b []byte) ([]byte, error) {
+	if key, err := hex.DecodeString(string(bytes.TrimSpace(b))); err == nil && validKeyLength(len(key)) {
+		return key, nil
+	}
+	if !validKeyLength(len(b)) {
+		return nil, fmt.Errorf("encryption key must be 16, 24 or 32 bytes, raw or hex-encoded, not %d bytes", len(b))
+	}
+	return b, nil
+}
+
+// keyMismatch explains badger.ErrEncryptionKeyMismatch for dir, opened with
+// key.
+func keyMismatch(dir string, key []byte) error {
+	if len(key) == 0 {
+		return fmt.Errorf("%s is encrypted and no encryption key is configured", dir)
+	}
+	return fmt.Errorf("the encryption key doesn't match the one %s is encrypted with, or it isn't encrypted (enable encryption with rotate-key)", dir)
+}
+
+// openBadger is badger.Open that says what's wrong when the encryption key
+// doesn't fit.
+func openBadger(opts badger.Options) (*badger.DB, error) {
+	db, err := badger.Open(opts)
+	if errors.Is(err, badger.ErrEncryptionKeyMismatch) {
+		return nil, keyMismatch(opts.Dir, opts.EncryptionKey)
+	}
+	return db, err
+}
+
+// rotateEncryptionKey re-encrypts the data keys of the database in dir,
+// which must not be open, from oldKey to newKey. The files stay as they are:
+// they're encrypted with the data keys. An empty oldKey encrypts a plain
+// database from now on, leaving what's already written in plain text until
+// compaction and value log GC rewrite it.
+func rotateEncryptionKey(dir string, oldKey, newKey []byte, rotation time.Duration) error {
+	if len(newKey) == 0 {
+		return errors.New("no new encryption key")
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if _, err := os.Stat(filepath.Join(dir, badger.KeyRegistryFileName)); err != nil {
+		return fmt.Errorf("%s doesn't hold a Badger database: %w", dir, err)
+	}
+	if err := syscall.Flock(int(d.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		return fmt.Errorf("%s is in use, stop the server first: %w", dir, err)
+	}
+
+	kr, err := badger.OpenKeyRegistry(badger.KeyRegistryOptions{
+		Dir:                           dir,
+		ReadOnly:                      true,
+		EncryptionKey:                 oldKey,
+		EncryptionKeyRotationDuration: rotation,
+	})
+	if errors.Is(err, badger.ErrEncryptionKeyMismatch) {
+		return keyMismatch(dir, oldKey)
+	}
+	if err != nil {
+		return err
+	}
+	defer kr.Close()
+	return badger.WriteKeyRegistry(kr, badger.KeyRegistryOptions{
+		Dir:                           dir,
+		EncryptionKey:                 newKey,
+		EncryptionKeyRotationDuration: rotation,
+	})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func TestReadEncryptionKey(t *testing.T) {
+	dir := t.TempDir()
+	raw := bytes.Repeat([]byte{'k'}, 32)
+	write := func(name string, b []byte) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	t.Setenv("CREDENTIALS_DIRECTORY", "")
+	if key, err := readEncryptionKey("", "cred"); key != nil || err != nil {
+		t.Errorf("no key configured: %x, %v", key, err)
+	}
+	if key, err := readEncryptionKey(write("raw", raw), ""); err != nil || !bytes.Equal(key, raw) {
+		t.Errorf("raw key: %x, %v", key, err)
+	}
+	if key, err := readEncryptionKey(write("hex", []byte(hex.EncodeToString(raw[:16])+"\n")), ""); err != nil || !bytes.Equal(key, raw[:16]) {
+		t.Errorf("hex key: %x, %v", key, err)
+	}
+	if _, err := readEncryptionKey(write("short", []byte("short")), ""); err == nil {
+		t.Error("a 5-byte key was accepted")
+	}
+
+	t.Setenv("CREDENTIALS_DIRECTORY", dir)
+	if key, err := readEncryptionKey("", "raw"); err != nil || !bytes.Equal(key, raw) {
+		t.Errorf("credential: %x, %v", key, err)
+	}
+	if key, err := readEncryptionKey("", "missing"); key != nil || err != nil {
+		t.Errorf("credential not loaded: %x, %v", key, err)
+	}
+}
+
+func TestEncryptionKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldKey, newKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 16)
+	open := func(key []byte) (*badger.DB, error) {
+		return openBadger(badger.DefaultOptions(dir).WithLogger(nil).
+			WithEncryptionKey(key).WithIndexCacheSize(1 << 20))
+	}
+
+	db, err := open(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStore(db)
+	if _, err := s.Upload(context.Background(), FileInfo{Name: "p/secret", ContentLength: -1}, strings.NewReader("submission")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rotateEncryptionKey(dir, oldKey, newKey, time.Hour); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("rotating an open database: %v", err)
+	}
+	s.Close()
+	db.Close()
+
+	if _, err := open(newKey); err == nil || !strings.Contains(err.Error(), "doesn't match") {
+		t.Errorf("opening with the wrong key: %v", err)
+	}
+	if _, err := open(nil); err == nil || !strings.Contains(err.Error(), "no encryption key") {
+		t.Errorf("opening without a key: %v", err)
+	}
+	if err := rotateEncryptionKey(dir, newKey, oldKey, time.Hour); err == nil || !strings.Contains(err.Error(), "doesn't match") {
+		t.Errorf("rotating from the wrong key: %v", err)
+	}
+	if err := rotateEncryptionKey(dir, oldKey, newKey, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := open(oldKey); err == nil {
+		t.Error("the old key still opens the database")
+	}
+
+	db, err = open(newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = NewStore(db)
+	defer func() { s.Close(); db.Close() }()
+	err = s.Download(context.Background(), "p/secret", func(dr DownloadResult) error {
+		if b, _ := io.ReadAll(dr.Body); string(b) != "submission" {
+			t.Errorf("read back %q", b)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
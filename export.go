@@ -0,0 +1,239 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/contester/advfiler/hashes"
+	pb "github.com/contester/advfiler/protos"
+	"github.com/klauspost/compress/zstd"
+)
+
+// archiveErrorTrailer is sent as an HTTP trailer when an archive is cut
+// short. The archive is left without its end marker (tar) or central
+// directory (zip); zip readers notice that, but tar readers often don't, so
+// clients have to check the trailer.
+const archiveErrorTrailer = "X-Fs-Archive-Error"
+
+// paxModuleType holds the module type of tar entries. Digests go to
+// hashes.PAXPrefix records.
+const paxModuleType = "SCHILY.xattr.user.fs_module_type"
+
+// archiveWriter is a tar or zip archive being streamed to a client.
+type archiveWriter interface {
+	add(name string, dr DownloadResult) error
+	// Close finishes the archive. Not calling it leaves the archive
+	// truncated.
+	Close() error
+}
+
+type tarArchive struct {
+	tw *tar.Writer
+	// zw is the compressor under tw, if any.
+	zw io.WriteCloser
+}
+
+func newTarArchive(w io.Writer, compression string) (*tarArchive, error) {
+	var a tarArchive
+	switch compression {
+	case "", "none":
+	case "gzip":
+		a.zw = gzip.NewWriter(w)
+	case "zstd":
+		zw, err := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		a.zw = zw
+	default:
+		return nil, fmt.Errorf("unknown compression %q", compression)
+	}
+	if a.zw != nil {
+		w = a.zw
+	}
+	a.tw = tar.NewWriter(w)
+	return &a, nil
+}
+
+func (a *tarArchive) add(name string, dr DownloadResult) error {
+	fh := tar.Header{
+		Name:       name,
+		Mode:       0666,
+		Size:       dr.Size,
+		Typeflag:   tar.TypeReg,
+		Format:     tar.FormatPAX,
+		PAXRecords: make(map[string]string),
+	}
+	if dr.LastModifiedTimestamp != 0 {
+		fh.ModTime = time.Unix(dr.LastModifiedTimestamp, 0)
+	}
+	if dr.ModuleType != "" {
+		fh.PAXRecords[paxModuleType] = dr.ModuleType
+	}
+	for k, v := range dr.Attributes {
+		fh.PAXRecords["SCHILY.xattr."+attributeXattrPrefix+k] = v
+	}
+	hashes.AddPAXDigests(fh.PAXRecords, dr.Digests)
+	if err := a.tw.WriteHeader(&fh); err != nil {
+		return err
+	}
+	_, err := io.Copy(a.tw, dr.Body)
+	return err
+}
+
+func (a *tarArchive) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	if a.zw != nil {
+		return a.zw.Close()
+	}
+	return nil
+}
+
+type zipArchive struct {
+	zw     *zip.Writer
+	method uint16
+}
+
+func newZipArchive(w io.Writer, compression string) (*zipArchive, error) {
+	a := zipArchive{zw: zip.NewWriter(w)}
+	switch compression {
+	case "", "gzip":
+		a.method = zip.Deflate
+	case "none":
+		a.method = zip.Store
+	case "zstd":
+		a.method = zstd.ZipMethodWinZip
+		a.zw.RegisterCompressor(a.method, zstd.ZipCompressor())
+	default:
+		return nil, fmt.Errorf("unknown compression %q", compression)
+	}
+	return &a, nil
+}
+
+func (a *zipArchive) add(name string, dr DownloadResult) error {
+	fh := zip.FileHeader{
+		Name:               name,
+		UncompressedSize64: uint64(dr.Size),
+		Method:             a.method,
+		Extra:              zipExtra(dr.ModuleType, dr.Attributes, dr.Digests),
+	}
+	if dr.LastModifiedTimestamp != 0 {
+		fh.Modified = time.Unix(dr.LastModifiedTimestamp, 0)
+	}
+	wr, err := a.zw.CreateHeader(&fh)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(wr, dr.Body)
+	return err
+}
+
+func (a *zipArchive) Close() error {
+	return a.zw.Close()
+}
+
+// suffixedArchive names entries <name>.<module type>, the way judges expect
+// packages and multi-downloads to look.
+type suffixedArchive struct {
+	archiveWriter
+}
+
+func (a suffixedArchive) add(name string, dr DownloadResult) error {
+	return a.archiveWriter.add(withTypeSuffix(name, dr.ModuleType), dr)
+}
+
+func withTypeSuffix(name, moduleType string) string {
+	if moduleType == "" {
+		return name
+	}
+	return name + "." + moduleType
+}
+
+// abortArchive reports a failed archive in the trailer.
+func abortArchive(ctx context.Context, w http.ResponseWriter, name string, err error) {
+	requestLog(ctx).Errorf("archive cut short at %q: %v", name, err)
+	w.Header().Set(archiveErrorTrailer, fmt.Sprintf("%s: %v", name, err))
+}
+
+// exportName maps a stored path to its name in an exported archive: the
+// directory strip is removed from the front, then root is put there
+// instead. A file named strip itself keeps its base name.
+func exportName(name, strip, root string) string {
+	if dir := strings.TrimSuffix(strip, "/"); dir != "" {
+		if name == dir {
+			name = path.Base(name)
+		} else if rest, ok := strings.CutPrefix(name, dir+"/"); ok && rest != "" {
+			name = rest
+		}
+	}
+	if root != "" {
+		name = path.Join(root, name)
+	}
+	return name
+}
+
+// handleArchiveDownload serves GET /tar/ and GET /zip/: every file under
+// ?path=, compressed as ?compress= says (none, gzip or zstd), renamed per
+// ?strip= and ?root=.
+func (f *filerServer) handleArchiveDownload(w http.ResponseWriter, r *http.Request, format string) {
+	prefix := r.FormValue("path")
+	if v, _ := f.authChecker.Check(r.Context(), tokenFromHeader(r), pb.AuthAction_A_READ, prefix); !v {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	compression := r.FormValue("compress")
+	var (
+		aw  archiveWriter
+		err error
+	)
+	switch format {
+	case "zip":
+		w.Header().Set("Content-Type", "application/zip")
+		aw, err = newZipArchive(w, compression)
+	default:
+		switch compression {
+		case "gzip":
+			w.Header().Set("Content-Type", "application/gzip")
+		case "zstd":
+			w.Header().Set("Content-Type", "application/zstd")
+		default:
+			w.Header().Set("Content-Type", "application/x-tar")
+		}
+		aw, err = newTarArchive(w, compression)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	names, err := f.store.List(r.Context(), prefix)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sort.Strings(names)
+
+	strip, root := r.FormValue("strip"), strings.Trim(r.FormValue("root"), "/")
+	w.Header().Set("Trailer", archiveErrorTrailer)
+	for _, v := range names {
+		if err := f.writeRemoteFileAs(r.Context(), aw, v, exportName(v, strip, root)); err != nil {
+			abortArchive(r.Context(), w, v, err)
+			return
+		}
+	}
+	if err := aw.Close(); err != nil {
+		abortArchive(r.Context(), w, "", err)
+	}
+}
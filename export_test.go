@@ -0,0 +1,121 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/contester/advfiler/client"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestArchiveExport(t *testing.T) {
+	s, srv := newTestServer(t)
+	ctx := context.Background()
+	for _, name := range []string{"p/a", "p/b/c"} {
+		if _, err := s.Upload(ctx, FileInfo{Name: name, ModuleType: "txt", TimestampUnix: 1700000000}, strings.NewReader(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, b := doRequest(t, authorized(t, http.MethodGet, srv.URL+"/tar/?path=p/&compress=zstd&strip=p/&root=out", nil))
+	if resp.Header.Get("Content-Type") != "application/zstd" || resp.Trailer.Get(archiveErrorTrailer) != "" {
+		t.Fatalf("tar export: %v %v", resp.Header, resp.Trailer)
+	}
+	zr, _ := zstd.NewReader(strings.NewReader(b))
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+	var names []string
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, h.Name)
+		content, _ := io.ReadAll(tr)
+		if !h.ModTime.Equal(time.Unix(1700000000, 0)) || h.PAXRecords[paxModuleType] != "txt" ||
+			h.PAXRecords["ADVFILER.blake3"] != hex.EncodeToString(blake3Sum(content)) || h.PAXRecords["ADVFILER.md5"] == "" {
+			t.Errorf("tar header: %+v", h)
+		}
+	}
+	if strings.Join(names, ",") != "out/a,out/b/c" {
+		t.Errorf("tar names: %v", names)
+	}
+
+	resp, b = doRequest(t, authorized(t, http.MethodGet, srv.URL+"/zip/?path=p/&compress=zstd", nil))
+	if resp.StatusCode != http.StatusOK || resp.Trailer.Get(archiveErrorTrailer) != "" {
+		t.Fatalf("zip export: %s %v", resp.Status, resp.Trailer)
+	}
+	z, err := zip.NewReader(strings.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	z.RegisterDecompressor(zstd.ZipMethodWinZip, zstd.ZipDecompressor())
+	if len(z.File) != 2 || z.File[0].Name != "p/a" || z.File[0].Method != zstd.ZipMethodWinZip ||
+		!z.File[0].Modified.Equal(time.Unix(1700000000, 0)) {
+		t.Fatalf("zip entries: %+v", z.File)
+	}
+	if rc, err := z.File[1].Open(); err != nil {
+		t.Fatal(err)
+	} else if content, err := io.ReadAll(rc); err != nil || string(content) != "p/b/c" {
+		t.Errorf("zip content: %q %v", content, err)
+	}
+
+	// The export imports back with module types and times intact.
+	c := client.New(srv.URL, "tok")
+	if _, err := c.ZipImport(ctx, strings.NewReader(b), "copy", ""); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := c.Stat(ctx, "copy/p/b/c"); err != nil || fi.ModuleType != "txt" || fi.ModTime.Unix() != 1700000000 {
+		t.Errorf("reimported: %+v %v", fi, err)
+	}
+
+	if resp, _ := doRequest(t, authorized(t, http.MethodGet, srv.URL+"/tar/?path=p/&compress=lz4", nil)); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown compression: %s", resp.Status)
+	}
+
+	// Losing a file's data mid-export cuts the archive short.
+	if err := s.db.Update(func(tx *badger.Txn) error { return tx.Delete(dirDataKey("p/b/c")) }); err != nil {
+		t.Fatal(err)
+	}
+	resp, b = doRequest(t, authorized(t, http.MethodGet, srv.URL+"/tar/?path=p/", nil))
+	if !strings.HasPrefix(resp.Trailer.Get(archiveErrorTrailer), "p/b/c: ") {
+		t.Errorf("trailer: %v", resp.Trailer)
+	}
+	if h, err := tar.NewReader(strings.NewReader(b)).Next(); err != nil || h.Name != "p/a" {
+		t.Errorf("cut archive: %+v %v", h, err)
+	}
+	resp, b = doRequest(t, authorized(t, http.MethodGet, srv.URL+"/zip/?path=p/", nil))
+	if resp.Trailer.Get(archiveErrorTrailer) == "" {
+		t.Errorf("zip trailer: %v", resp.Trailer)
+	}
+	if _, err := zip.NewReader(strings.NewReader(b), int64(len(b))); err == nil {
+		t.Error("a cut zip archive reads fine")
+	}
+}
+
+func TestExportName(t *testing.T) {
+	for _, c := range []struct{ name, strip, root, want string }{
+		{"p/a", "", "", "p/a"},
+		{"p/a", "p/", "", "a"},
+		{"p/a", "p", "out", "out/a"},
+		{"problem/p1/x", "problem/p1", "", "x"},
+		{"problem/p10/x", "problem/p1", "", "problem/p10/x"},
+		{"problem/p10/x", "problem/p1/", "", "problem/p10/x"},
+		{"problem/p1", "problem/p1", "", "p1"},
+	} {
+		if got := exportName(c.name, c.strip, c.root); got != c.want {
+			t.Errorf("exportName(%q, %q, %q) = %q, want %q", c.name, c.strip, c.root, got, c.want)
+		}
+	}
+}
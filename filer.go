@@ -1,15 +1,16 @@
 package main
 
 import (
-	"archive/tar"
 	"archive/zip"
 	"bytes"
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"maps"
 	"net/http"
 	"sort"
 	"strconv"
@@ -18,12 +19,13 @@ import (
 
 	"google.golang.org/protobuf/proto"
 
+	"github.com/contester/advfiler/hashes"
 	pb "github.com/contester/advfiler/protos"
-	log "github.com/sirupsen/logrus"
 )
 
 type AuthCheck interface {
 	Check(ctx context.Context, token string, action pb.AuthAction, path string) (bool, error)
+	Identify(token string) string
 }
 
 type filerServer struct {
@@ -49,10 +51,64 @@ func tokenFromHeader(req *http.Request) string {
 
 var errUnauthorized = errors.New("unauthorized")
 
+// storeErrorStatus maps an error from a Store call to an HTTP status.
+func storeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, ErrReadOnly):
+		return http.StatusForbidden
+	case errors.Is(err, hashes.ErrDigestMismatch), errors.Is(err, errInvalidAttributes), errors.Is(err, errLengthMismatch),
+		errors.Is(err, errUnsafeName):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrOverloaded), errors.Is(err, ErrMaintenance):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// listEntry is an element of the JSON listing.
+type listEntry struct {
+	Path         string            `json:"path"`
+	Size         int64             `json:"size"`
+	ModuleType   string            `json:"moduleType,omitempty"`
+	LastModified int64             `json:"lastModified,omitempty"`
+	Digests      map[string]string `json:"digests,omitempty"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+}
+
+func wantsJSON(r *http.Request) bool {
+	return r.FormValue("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
 func (f *filerServer) handleList(ctx context.Context, w http.ResponseWriter, r *http.Request, path string) error {
 	if v, _ := f.authChecker.Check(ctx, tokenFromHeader(r), pb.AuthAction_A_READ, path); !v {
 		return errUnauthorized
 	}
+	if wantsJSON(r) {
+		entries := []listEntry{}
+		if err := f.store.ListStat(ctx, path, func(name string, dr DownloadResult) error {
+			entries = append(entries, listEntry{
+				Path:         name,
+				Size:         dr.Size,
+				ModuleType:   dr.ModuleType,
+				LastModified: dr.LastModifiedTimestamp,
+				Digests:      hashes.DigestsToMap(dr.Digests),
+				Attributes:   dr.Attributes,
+			})
+			return nil
+		}); err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(entries)
+	}
 	names, err := f.store.List(ctx, path)
 	if err != nil {
 		return err
@@ -67,6 +123,11 @@ func (f *filerServer) handleList(ctx context.Context, w http.ResponseWriter, r *
 	return nil
 }
 
+// blake3ETag is the strong entity tag of content with the given blake3 hash.
+func blake3ETag(hash []byte) string {
+	return `"` + hex.EncodeToString(hash) + `"`
+}
+
 func (f *filerServer) handleDownload(ctx context.Context, w http.ResponseWriter, r *http.Request, path string) error {
 	if path == "" || path[len(path)-1] == '/' {
 		return f.handleList(ctx, w, r, path)
@@ -91,29 +152,32 @@ func (f *filerServer) handleDownload(ctx context.Context, w http.ResponseWriter,
 		if result.ModuleType != "" {
 			w.Header().Add("X-Fs-Module-Type", result.ModuleType)
 		}
+		addAttributeHeaders(w.Header(), result.Attributes)
+		var modTime time.Time
 		if result.LastModifiedTimestamp != 0 {
-			t := time.Unix(result.LastModifiedTimestamp, 0)
-			w.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+			modTime = time.Unix(result.LastModifiedTimestamp, 0)
+			w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
 		}
 
-		if r.Method == http.MethodHead {
-			AddDigests(w.Header(), result.Digests)
-			return nil
-		}
-		if limitValue != -1 && limitValue < rsize {
+		// HEAD describes the whole file whatever the limit. A truncated body
+		// is a different representation, so it gets no ETag and can't be
+		// matched by conditional requests for the full file.
+		truncated := r.Method != http.MethodHead && limitValue != -1 && limitValue < rsize
+		if truncated {
 			w.Header().Add("X-Fs-Truncated", "true")
 		} else {
-			AddDigests(w.Header(), result.Digests)
+			hashes.AddDigests(w.Header(), result.Digests)
+			w.Header().Set("ETag", blake3ETag(result.Digests.Blake3))
 		}
-		if limitValue == 0 {
+		if limitValue == 0 && r.Method != http.MethodHead {
 			return nil
 		}
 
 		var xr io.ReadSeeker = result.Body
-		if limitValue != -1 && limitValue < rsize {
+		if truncated {
 			xr = &limitReadSeeker{r: xr, bytesTotal: limitValue, bytesRemaining: limitValue}
 		}
-		http.ServeContent(w, r, "", time.Time{}, xr)
+		http.ServeContent(w, r, "", modTime, xr)
 		return nil
 	})
 }
@@ -189,6 +253,23 @@ func (f *filerServer) handleDelete(ctx context.Context, w http.ResponseWriter, r
 	return f.store.Delete(ctx, path)
 }
 
+// handleUpdateAttributes merges the request's X-Fs-Meta-* headers into the
+// file's attributes; an empty header removes the attribute.
+func (f *filerServer) handleUpdateAttributes(ctx context.Context, w http.ResponseWriter, r *http.Request, path string) error {
+	if path == "" || path[len(path)-1] == '/' {
+		return fmt.Errorf("can't set attributes of a directory")
+	}
+	if v, _ := f.authChecker.Check(ctx, tokenFromHeader(r), pb.AuthAction_A_WRITE, path); !v {
+		return errUnauthorized
+	}
+	attrs, err := f.store.UpdateAttributes(ctx, path, attributesFromHeader(r.Header))
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(attrs)
+}
+
 func (f *filerServer) handleUpload(ctx context.Context, w http.ResponseWriter, r *http.Request, path string) error {
 	if path == "" {
 		return f.handleMultiDownload(ctx, w, r)
@@ -203,7 +284,9 @@ func (f *filerServer) handleUpload(ctx context.Context, w http.ResponseWriter, r
 	fi := FileInfo{
 		ModuleType: r.Header.Get("X-Fs-Module-Type"),
 		Name:       path,
+		Attributes: attributesFromHeader(r.Header),
 	}
+	maps.DeleteFunc(fi.Attributes, func(_, v string) bool { return v == "" })
 	if ch := r.Header.Get("Content-Length"); ch != "" {
 		var err error
 		fi.ContentLength, err = strconv.ParseInt(ch, 10, 64)
@@ -219,90 +302,45 @@ func (f *filerServer) handleUpload(ctx context.Context, w http.ResponseWriter, r
 		}
 	}
 
-	fi.RecvDigests = ParseDigests(r.Header)
+	fi.RecvDigests = hashes.ParseDigests(r.Header)
 
 	result, err := f.store.Upload(ctx, fi, r.Body)
 	if err != nil {
 		return err
 	}
+	w.Header().Set("ETag", blake3ETag(hashes.DigestsFromMap(result.Digests).Blake3))
 
 	return json.NewEncoder(w).Encode(&result)
 }
 
-type singleDownloadEntry struct {
-	Source      string
-	Destination string
-}
-
-type multiDownloadRequest struct {
-	Entry []singleDownloadEntry
+// writeRemoteFileAs adds the file at name to the archive as as.
+func (f *filerServer) writeRemoteFileAs(ctx context.Context, aw archiveWriter, name, as string) error {
+	return f.store.Download(ctx, name, func(result DownloadResult) error {
+		return aw.add(as, result)
+	})
 }
 
-func (f *filerServer) handleMultiDownload(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-	if v, _ := f.authChecker.Check(ctx, tokenFromHeader(r), pb.AuthAction_A_READ, ""); !v {
-		return errUnauthorized
-	}
-	decoder := json.NewDecoder(r.Body)
-	var mdreq multiDownloadRequest
-	if err := decoder.Decode(&mdreq); err != nil {
-		return err
-	}
-	cout := zip.NewWriter(w)
-	defer cout.Close()
-	for _, entry := range mdreq.Entry {
-		f.writeRemoteFileAs(ctx, cout, nil, entry.Source, entry.Destination)
+// writeOptional is writeRemoteFileAs for package members that may be
+// missing.
+func (f *filerServer) writeOptional(ctx context.Context, aw archiveWriter, name, as string) error {
+	if err := f.writeRemoteFileAs(ctx, aw, name, as); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s: %w", name, err)
 	}
 	return nil
 }
 
-func (f *filerServer) writeRemoteFileAs(ctx context.Context, zw *zip.Writer, tw *tar.Writer, name, as string) error {
-	return f.store.Download(ctx, name, func(result DownloadResult) error {
-		if zw != nil {
-			fh := zip.FileHeader{
-				Name:               as,
-				UncompressedSize64: uint64(result.Size),
-				Method:             zip.Deflate,
-			}
-			if result.ModuleType != "" {
-				fh.Name += "." + result.ModuleType
-			}
-			wr, err := zw.CreateHeader(&fh)
-			if err != nil {
-				return err
-			}
-			_, err = io.Copy(wr, result.Body)
-			return err
-		}
-		if tw != nil {
-			fh := tar.Header{
-				Name:     as,
-				Mode:     0666,
-				Size:     result.Size,
-				Typeflag: tar.TypeReg,
-			}
-			if result.LastModifiedTimestamp != 0 {
-				fh.ModTime = time.Unix(result.LastModifiedTimestamp, 0)
-			}
-			if result.ModuleType != "" {
-				fh.Xattrs = map[string]string{"user.fs_module_type": result.ModuleType}
-			}
-			if err := tw.WriteHeader(&fh); err != nil {
-				return err
-			}
-			_, err := io.Copy(tw, result.Body)
-			return err
-		}
-		return nil
-	})
-}
-
-func (f *filerServer) writeProblemData(ctx context.Context, w *zip.Writer, problemID string) error {
+func (f *filerServer) writeProblemData(ctx context.Context, aw archiveWriter, problemID string) error {
 	prefix := "problem/" + problemID + "/"
-	names, _ := f.store.List(ctx, prefix)
+	names, err := f.store.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
 	for _, name := range names {
 		pname := strings.TrimPrefix(name, prefix)
 		if pname == "checker" {
-			f.writeRemoteFileAs(ctx, w, nil, name, "checker")
+			if err := f.writeOptional(ctx, aw, name, "checker"); err != nil {
+				return err
+			}
 			continue
 		}
 		splits := strings.Split(pname, "/")
@@ -319,7 +357,9 @@ func (f *filerServer) writeProblemData(ctx context.Context, w *zip.Writer, probl
 		if dname == "" {
 			continue
 		}
-		f.writeRemoteFileAs(ctx, w, nil, name, dname)
+		if err := f.writeOptional(ctx, aw, name, dname); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -330,34 +370,54 @@ func (f *filerServer) HandlePackage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cout := zip.NewWriter(w)
-	defer cout.Close()
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Trailer", archiveErrorTrailer)
+	aw := suffixedArchive{&zipArchive{zw: zip.NewWriter(w), method: zip.Deflate}}
+	if err := f.writePackage(r, aw); err != nil {
+		abortArchive(r.Context(), w, "", err)
+		return
+	}
+	if err := aw.Close(); err != nil {
+		abortArchive(r.Context(), w, "", err)
+	}
+}
 
+func (f *filerServer) writePackage(r *http.Request, aw archiveWriter) error {
 	contestID := r.FormValue("contest")
 	submitID := r.FormValue("submit")
 	testingID := r.FormValue("testing")
 
 	if contestID != "" && submitID != "" && testingID != "" {
-		names, _ := f.store.List(r.Context(), "submit/"+contestID+"/"+submitID+"/"+testingID+"/")
+		names, err := f.store.List(r.Context(), "submit/"+contestID+"/"+submitID+"/"+testingID+"/")
+		if err != nil {
+			return err
+		}
 		for _, name := range names {
 			splits := strings.Split(name, "/")
 			if len(splits) < 5 || splits[len(splits)-1] != "output" {
 				continue
 			}
-			f.writeRemoteFileAs(r.Context(), cout, nil, name, splits[len(splits)-2]+".o")
+			if err := f.writeOptional(r.Context(), aw, name, splits[len(splits)-2]+".o"); err != nil {
+				return err
+			}
+		}
+		if err := f.writeOptional(r.Context(), aw, "submit/"+contestID+"/"+submitID+"/compiledModule", "solution"); err != nil {
+			return err
+		}
+		if err := f.writeOptional(r.Context(), aw, "submit/"+contestID+"/"+submitID+"/sourceModule", "solution"); err != nil {
+			return err
 		}
-		f.writeRemoteFileAs(r.Context(), cout, nil, "submit/"+contestID+"/"+submitID+"/compiledModule", "solution")
-		f.writeRemoteFileAs(r.Context(), cout, nil, "submit/"+contestID+"/"+submitID+"/sourceModule", "solution")
 	}
 
 	if problemID := r.FormValue("problem"); problemID != "" {
-		f.writeProblemData(r.Context(), cout, problemID)
+		return f.writeProblemData(r.Context(), aw, problemID)
 	}
+	return nil
 }
 
-func (f *filerServer) downloadAsset(ctx context.Context, name, as string, limit int64) (*pb.Asset, error) {
+func downloadAsset(ctx context.Context, store *Store, name, as string, limit int64) (*pb.Asset, error) {
 	var asset *pb.Asset
-	err := f.store.Download(ctx, name, func(result DownloadResult) error {
+	err := store.Download(ctx, name, func(result DownloadResult) error {
 		bb := make([]byte, limit)
 		n, err := result.Body.Read(bb)
 		if err != nil && err != io.EOF {
@@ -374,44 +434,32 @@ func (f *filerServer) downloadAsset(ctx context.Context, name, as string, limit
 	return asset, err
 }
 
-func (f *filerServer) handleProtoPackage(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	if v, _ := f.authChecker.Check(ctx, tokenFromHeader(r), pb.AuthAction_A_READ, ""); !v {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
+const (
+	defaultAssetSizeLimit = 1024
+	solutionSizeLimit     = 128000
+)
 
-	contestID := r.FormValue("contest")
-	submitID := r.FormValue("submit")
-	testingID := r.FormValue("testing")
-	problemID := r.FormValue("problem")
-	sizeLimit := int64(1024)
-	solutionSizeLimit := int64(128000)
+var errInvalidProblemID = errors.New("invalid problem ID")
 
+// buildTestingRecord collects the solution and, for each test of the
+// problem that has an output in the testing, its input, answer and output,
+// each truncated to sizeLimit.
+func buildTestingRecord(ctx context.Context, store *Store, contestID, submitID, testingID, problemID string, sizeLimit int64) (*pb.TestingRecord, error) {
 	if !strings.HasPrefix(problemID, "problem/") {
-		http.Error(w, "invalid problem ID: "+problemID, http.StatusNotFound)
-		return
-	}
-
-	if sz := r.FormValue("sizeLimit"); sz != "" {
-		if isz, err := strconv.ParseInt(sz, 10, 64); err == nil {
-			sizeLimit = isz
-		}
+		return nil, fmt.Errorf("%w: %s", errInvalidProblemID, problemID)
 	}
 
 	var result pb.TestingRecord
-	solution, err := f.downloadAsset(ctx, "submit/"+contestID+"/"+submitID+"/sourceModule", "source", solutionSizeLimit)
+	solution, err := downloadAsset(ctx, store, "submit/"+contestID+"/"+submitID+"/sourceModule", "source", solutionSizeLimit)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		return
+		return nil, err
 	}
 	result.SetSolution(solution)
 
 	prefix := problemID + "/"
-	names, err := f.store.List(ctx, prefix)
+	names, err := store.List(ctx, prefix)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		return
+		return nil, err
 	}
 
 	testSet := make(map[int64]struct{})
@@ -439,17 +487,16 @@ func (f *filerServer) handleProtoPackage(w http.ResponseWriter, r *http.Request)
 	var tests []*pb.TestRecord
 	for _, testID := range testList {
 		outName := "submit/" + contestID + "/" + submitID + "/" + testingID + "/" + strconv.FormatInt(testID, 10) + "/output"
-		out, err := f.downloadAsset(ctx, outName, "output", sizeLimit)
+		out, err := downloadAsset(ctx, store, outName, "output", sizeLimit)
 		if err != nil {
 			continue
 		}
 		testPrefix := prefix + "tests/" + strconv.FormatInt(testID, 10) + "/"
-		input, err := f.downloadAsset(ctx, testPrefix+"input.txt", "input", sizeLimit)
+		input, err := downloadAsset(ctx, store, testPrefix+"input.txt", "input", sizeLimit)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
+			return nil, err
 		}
-		answer, _ := f.downloadAsset(ctx, testPrefix+"answer.txt", "answer", sizeLimit)
+		answer, _ := downloadAsset(ctx, store, testPrefix+"answer.txt", "answer", sizeLimit)
 		tests = append(tests, pb.TestRecord_builder{
 			TestId: proto.Int64(testID),
 			Output: out,
@@ -458,8 +505,31 @@ func (f *filerServer) handleProtoPackage(w http.ResponseWriter, r *http.Request)
 		}.Build())
 	}
 	result.SetTest(tests)
+	return &result, nil
+}
+
+func (f *filerServer) handleProtoPackage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if v, _ := f.authChecker.Check(ctx, tokenFromHeader(r), pb.AuthAction_A_READ, ""); !v {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sizeLimit := int64(defaultAssetSizeLimit)
+	if sz := r.FormValue("sizeLimit"); sz != "" {
+		if isz, err := strconv.ParseInt(sz, 10, 64); err == nil {
+			sizeLimit = isz
+		}
+	}
+
+	result, err := buildTestingRecord(ctx, f.store, r.FormValue("contest"), r.FormValue("submit"),
+		r.FormValue("testing"), r.FormValue("problem"), sizeLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 
-	b, err := proto.Marshal(&result)
+	b, err := proto.Marshal(result)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -473,7 +543,10 @@ func (f *filerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	ctx := r.Context()
+	ctx := auditContext(r, f.authChecker, "")
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		ctx = WithPrecondition(ctx, preconditionFromRequest(r))
+	}
 	switch r.Method {
 	case http.MethodPut, http.MethodPost:
 		err = f.handleUpload(ctx, w, r, path)
@@ -481,6 +554,8 @@ func (f *filerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		err = f.handleDownload(ctx, w, r, path)
 	case http.MethodDelete:
 		err = f.handleDelete(ctx, w, r, path)
+	case http.MethodPatch:
+		err = f.handleUpdateAttributes(ctx, w, r, path)
 	default:
 		http.Error(w, "", http.StatusMethodNotAllowed)
 	}
@@ -489,34 +564,22 @@ func (f *filerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			http.NotFound(w, r)
 			return
 		}
-		log.Errorf("%q: %v", path, err)
-	}
-}
-
-func (f *filerServer) handleTarDownload(w http.ResponseWriter, r *http.Request) {
-	path := r.FormValue("path")
-	if v, _ := f.authChecker.Check(r.Context(), tokenFromHeader(r), pb.AuthAction_A_READ, path); !v {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	names, err := f.store.List(r.Context(), path)
-	if err != nil {
-		http.Error(w, err.Error(), 500)
-		return
-	}
-	sort.Strings(names)
-
-	fw := tar.NewWriter(w)
-	defer fw.Close()
-	for _, v := range names {
-		f.writeRemoteFileAs(r.Context(), nil, fw, v, v)
+		if errors.Is(err, ErrReadOnly) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, errUnauthorized) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		requestLog(ctx).Errorf("%q: %v", path, err)
+		http.Error(w, err.Error(), storeErrorStatus(err))
 	}
 }
 
 func (f *filerServer) handleTarUpload(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		f.handleTarDownload(w, r)
+		f.handleArchiveDownload(w, r, "tar")
 		return
 	}
 	if r.Method != http.MethodPut {
@@ -528,42 +591,16 @@ func (f *filerServer) handleTarUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var realSize, savedSize int64
-	var icnt int
-
-	fr := tar.NewReader(r.Body)
-	for {
-		h, err := fr.Next()
-		if err == io.EOF {
-			break
-		}
-		if h.Typeflag != tar.TypeReg {
-			continue
-		}
-		if h.Name == "" || strings.HasSuffix(h.Name, "/") {
-			continue
-		}
-		fi := FileInfo{
-			ModuleType:    h.Xattrs["user.fs_module_type"],
-			Name:          h.Name,
-			ContentLength: h.Size,
-		}
-		if !h.ModTime.IsZero() {
-			fi.TimestampUnix = h.ModTime.Unix()
-		}
-		res, err := f.store.Upload(r.Context(), fi, fr)
-		if err != nil {
-			http.Error(w, err.Error(), 500)
-			return
-		}
-		icnt++
-		if res.Hardlinked {
-			savedSize += res.Size
-		} else {
-			realSize += res.Size
-		}
+	ctx, err := f.importContext(r, AuditTarImport)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := f.store.checkWritable(ctx); err != nil {
+		http.Error(w, err.Error(), storeErrorStatus(err))
+		return
 	}
-	fmt.Fprintf(w, "Files: %d, real size: %d, saved size: %d\n", icnt, realSize, savedSize)
+	f.importTar(ctx, r.Body).write(w)
 }
 
 func (f *filerServer) handleWipe(w http.ResponseWriter, r *http.Request) {
@@ -576,7 +613,8 @@ func (f *filerServer) handleWipe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	files, err := f.store.List(r.Context(), "")
+	ctx := auditContext(r, f.authChecker, AuditWipe)
+	files, err := f.store.List(ctx, "")
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
@@ -585,8 +623,8 @@ func (f *filerServer) handleWipe(w http.ResponseWriter, r *http.Request) {
 		if v == "" {
 			continue
 		}
-		if err = f.store.Delete(r.Context(), v); err != nil {
-			http.Error(w, err.Error(), 500)
+		if err = f.store.Delete(ctx, v); err != nil {
+			http.Error(w, err.Error(), storeErrorStatus(err))
 			return
 		}
 	}
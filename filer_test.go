@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConditionalDownload(t *testing.T) {
+	s, srv := newTestServer(t)
+	ctx := context.Background()
+	mtime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	content := "0123456789"
+	if _, err := s.Upload(ctx, FileInfo{Name: "tests/1", TimestampUnix: mtime.Unix()}, strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetContest(ctx, "c1", []byte("<contest/>"), mtime.Unix()); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, _ := doRequest(t, authorized(t, http.MethodHead, srv.URL+"/fs/tests/1", nil))
+	etag := resp.Header.Get("ETag")
+	if etag != blake3ETag(blake3Sum([]byte(content))) || resp.Header.Get("Last-Modified") != mtime.Format(http.TimeFormat) {
+		t.Fatalf("head: %v", resp.Header)
+	}
+	later := mtime.Add(time.Hour).Format(http.TimeFormat)
+	earlier := mtime.Add(-time.Hour).Format(http.TimeFormat)
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		hdr    []string
+		status int
+		body   string
+	}{
+		{"if-none-match", http.MethodGet, []string{"If-None-Match", etag}, http.StatusNotModified, ""},
+		{"if-none-match head", http.MethodHead, []string{"If-None-Match", etag}, http.StatusNotModified, ""},
+		{"if-none-match stale", http.MethodGet, []string{"If-None-Match", `"00"`}, http.StatusOK, content},
+		{"if-modified-since", http.MethodGet, []string{"If-Modified-Since", later}, http.StatusNotModified, ""},
+		{"if-modified-since stale", http.MethodGet, []string{"If-Modified-Since", earlier}, http.StatusOK, content},
+		{"range", http.MethodGet, []string{"Range", "bytes=2-4"}, http.StatusPartialContent, "234"},
+		{"range with if-none-match", http.MethodGet, []string{"Range", "bytes=2-4", "If-None-Match", etag}, http.StatusNotModified, ""},
+		{"if-range etag", http.MethodGet, []string{"Range", "bytes=2-4", "If-Range", etag}, http.StatusPartialContent, "234"},
+		{"if-range stale etag", http.MethodGet, []string{"Range", "bytes=2-4", "If-Range", `"00"`}, http.StatusOK, content},
+		{"if-range date", http.MethodGet, []string{"Range", "bytes=2-4", "If-Range", mtime.Format(http.TimeFormat)}, http.StatusPartialContent, "234"},
+		{"if-range stale date", http.MethodGet, []string{"Range", "bytes=2-4", "If-Range", earlier}, http.StatusOK, content},
+	} {
+		resp, body := doRequest(t, authorized(t, tc.method, srv.URL+"/fs/tests/1", nil), tc.hdr...)
+		if resp.StatusCode != tc.status || body != tc.body {
+			t.Errorf("%s: %s %q", tc.name, resp.Status, body)
+		}
+	}
+
+	// A truncated body isn't the file, so it must not match its ETag.
+	resp, body := doRequest(t, authorized(t, http.MethodGet, srv.URL+"/fs/tests/1", nil), "X-Fs-Limit", "3", "If-None-Match", etag)
+	if resp.StatusCode != http.StatusOK || body != "012" || resp.Header.Get("ETag") != "" {
+		t.Errorf("truncated: %s %q %v", resp.Status, body, resp.Header)
+	}
+
+	resp, _ = doRequest(t, authorized(t, http.MethodGet, srv.URL+"/xml/contest/?key=c1", nil))
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == "" {
+		t.Fatalf("xml: %s %v", resp.Status, resp.Header)
+	}
+	if resp, _ := doRequest(t, authorized(t, http.MethodGet, srv.URL+"/xml/contest/?key=c1", nil), "If-None-Match", resp.Header.Get("ETag")); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("xml if-none-match: %s", resp.Status)
+	}
+	if resp, _ := doRequest(t, authorized(t, http.MethodGet, srv.URL+"/xml/contest/?key=c1", nil), "If-Modified-Since", later); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("xml if-modified-since: %s", resp.Status)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/contester/advfiler/hashes"
+	pb "github.com/contester/advfiler/protos"
+)
+
+const (
+	// grpcChunkSize is the size of data messages Download sends.
+	grpcChunkSize = 256 << 10
+
+	defaultListPageSize = 1000
+	maxListPageSize     = 10000
+)
+
+type grpcServer struct {
+	pb.UnimplementedFilerServiceServer
+	store       *Store
+	authChecker AuthCheck
+}
+
+func NewGRPCServer(store *Store, authChecker AuthCheck) *grpcServer {
+	return &grpcServer{store: store, authChecker: authChecker}
+}
+
+func tokenFromMetadata(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if len(v) > 7 && strings.EqualFold(v[0:7], "BEARER ") {
+			return v[7:]
+		}
+	}
+	return ""
+}
+
+// authorize checks the caller's token for action on path and returns ctx
+// carrying the caller's identity for the audit log.
+func (s *grpcServer) authorize(ctx context.Context, action pb.AuthAction, path string) (context.Context, error) {
+	token := tokenFromMetadata(ctx)
+	if v, _ := s.authChecker.Check(ctx, token, action, path); !v {
+		return nil, status.Error(codes.Unauthenticated, errUnauthorized.Error())
+	}
+	a := AuditActor{Identity: s.authChecker.Identify(token)}
+	if p, ok := peer.FromContext(ctx); ok {
+		a.RemoteAddr = p.Addr.String()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("x-request-id"); len(v) != 0 {
+		a.RequestID = v[0]
+	} else {
+		a.RequestID = newRequestID()
+	}
+	return WithAuditActor(withRequestID(ctx, a.RequestID), a), nil
+}
+
+// grpcError maps an error from a Store call to a gRPC status, like
+// storeErrorStatus does for HTTP.
+func grpcError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrReadOnly):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, hashes.ErrDigestMismatch):
+		return status.Error(codes.DataLoss, err.Error())
+	case errors.Is(err, errInvalidProblemID), errors.Is(err, errInvalidAttributes):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, errLengthMismatch):
+		return status.Error(codes.DataLoss, err.Error())
+	case errors.Is(err, ErrTooLarge):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, ErrOverloaded), errors.Is(err, ErrMaintenance):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func fileStat(path string, dr DownloadResult) *pb.FileStat {
+	return pb.FileStat_builder{
+		Path:                  proto.String(path),
+		Size:                  proto.Int64(dr.Size),
+		ModuleType:            proto.String(dr.ModuleType),
+		LastModifiedTimestamp: proto.Int64(dr.LastModifiedTimestamp),
+		Digests:               dr.Digests.ToProto(),
+		Blake3:                dr.Digests.Blake3,
+		Attributes:            dr.Attributes,
+	}.Build()
+}
+
+func validFilePath(path string) error {
+	if path == "" || strings.HasSuffix(path, "/") {
+		return status.Errorf(codes.InvalidArgument, "invalid file path %q", path)
+	}
+	return nil
+}
+
+func (s *grpcServer) Upload(stream pb.FilerService_UploadServer) error {
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return status.Error(codes.InvalidArgument, "empty upload")
+	}
+	if err != nil {
+		return err
+	}
+	fi := FileInfo{Name: first.GetPath(), ModuleType: first.GetModuleType(), Attributes: first.GetAttributes()}
+	if err := validFilePath(fi.Name); err != nil {
+		return err
+	}
+	ctx, err := s.authorize(stream.Context(), pb.AuthAction_A_WRITE, fi.Name)
+	if err != nil {
+		return err
+	}
+
+	// The stream feeds Store.Upload as it arrives, so the upload limits
+	// apply before the data is held in memory.
+	body := &uploadStream{stream: stream}
+	body.take(first)
+	st, err := s.store.Upload(ctx, fi, body)
+	if body.err != nil && body.err != io.EOF {
+		return body.err
+	}
+	if err != nil {
+		return grpcError(err)
+	}
+	d := hashes.DigestsFromMap(st.Digests)
+	return stream.SendAndClose(pb.UploadResponse_builder{
+		Digests:    d.ToProto(),
+		Blake3:     d.Blake3,
+		Size:       proto.Int64(st.Size),
+		Hardlinked: proto.Bool(st.Hardlinked),
+	}.Build())
+}
+
+// uploadStream reads the data of Upload messages; the digests may come in
+// any of them, the last ones win.
+type uploadStream struct {
+	stream  pb.FilerService_UploadServer
+	data    []byte
+	digests hashes.Digests
+	err     error
+}
+
+func (u *uploadStream) take(msg *pb.UploadRequest) {
+	u.data = msg.GetData()
+	if msg.HasDigests() {
+		u.digests = hashes.DigestsFromProto(msg.GetDigests())
+	}
+}
+
+func (u *uploadStream) Read(p []byte) (int, error) {
+	for len(u.data) == 0 {
+		if u.err != nil {
+			return 0, u.err
+		}
+		msg, err := u.stream.Recv()
+		if err != nil {
+			u.err = err
+			continue
+		}
+		u.take(msg)
+	}
+	n := copy(p, u.data)
+	u.data = u.data[n:]
+	return n, nil
+}
+
+func (u *uploadStream) RecvDigests() hashes.Digests { return u.digests }
+
+func (s *grpcServer) Download(req *pb.DownloadRequest, stream pb.FilerService_DownloadServer) error {
+	path := req.GetPath()
+	if err := validFilePath(path); err != nil {
+		return err
+	}
+	ctx, err := s.authorize(stream.Context(), pb.AuthAction_A_READ, path)
+	if err != nil {
+		return err
+	}
+	// The body is a copy, so it can be streamed after the transaction ends
+	// instead of holding it open for as long as the client takes.
+	var dr DownloadResult
+	if err := s.store.Download(ctx, path, func(result DownloadResult) error {
+		dr = result
+		return nil
+	}); err != nil {
+		return grpcError(err)
+	}
+	if req.GetOffset() < 0 || req.GetOffset() > dr.Size {
+		return status.Errorf(codes.OutOfRange, "offset %d is outside of the file (size %d)", req.GetOffset(), dr.Size)
+	}
+	if _, err := dr.Body.Seek(req.GetOffset(), io.SeekStart); err != nil {
+		return grpcError(err)
+	}
+	var body io.Reader = dr.Body
+	if req.GetLimit() > 0 {
+		body = io.LimitReader(body, req.GetLimit())
+	}
+
+	msg := pb.DownloadResponse_builder{Stat: fileStat(path, dr)}.Build()
+	for {
+		// Sent messages must not be modified, so each gets its own chunk.
+		chunk := make([]byte, grpcChunkSize)
+		n, err := io.ReadFull(body, chunk)
+		if n > 0 || msg.HasStat() {
+			msg.SetData(chunk[:n])
+			if serr := stream.Send(msg); serr != nil {
+				return serr
+			}
+			msg = &pb.DownloadResponse{}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return grpcError(err)
+		}
+	}
+}
+
+// List pages through paths in order; the page token is the last path of the
+// previous page.
+func (s *grpcServer) List(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	ctx, err := s.authorize(ctx, pb.AuthAction_A_READ, req.GetPrefix())
+	if err != nil {
+		return nil, err
+	}
+	pageSize := int(req.GetPageSize())
+	if pageSize <= 0 {
+		pageSize = defaultListPageSize
+	}
+	pageSize = min(pageSize, maxListPageSize)
+	var after string
+	if t := req.GetPageToken(); t != "" {
+		b, err := base64.RawURLEncoding.DecodeString(t)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+		after = string(b)
+	}
+
+	names, err := s.store.List(ctx, req.GetPrefix())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	sort.Strings(names)
+	start := sort.SearchStrings(names, after)
+	if start < len(names) && names[start] == after {
+		start++
+	}
+	names = names[start:]
+	resp := &pb.ListResponse{}
+	if len(names) > pageSize {
+		names = names[:pageSize]
+		resp.SetNextPageToken(base64.RawURLEncoding.EncodeToString([]byte(names[pageSize-1])))
+	}
+	resp.SetPaths(names)
+	return resp, nil
+}
+
+func (s *grpcServer) Stat(ctx context.Context, req *pb.StatRequest) (*pb.FileStat, error) {
+	if err := validFilePath(req.GetPath()); err != nil {
+		return nil, err
+	}
+	ctx, err := s.authorize(ctx, pb.AuthAction_A_READ, req.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	dr, err := s.store.Stat(ctx, req.GetPath())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return fileStat(req.GetPath(), dr), nil
+}
+
+func (s *grpcServer) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	if err := validFilePath(req.GetPath()); err != nil {
+		return nil, err
+	}
+	ctx, err := s.authorize(ctx, pb.AuthAction_A_WRITE, req.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.Delete(ctx, req.GetPath()); err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.DeleteResponse{}, nil
+}
+
+func (s *grpcServer) GetTestingRecord(ctx context.Context, req *pb.GetTestingRecordRequest) (*pb.TestingRecord, error) {
+	ctx, err := s.authorize(ctx, pb.AuthAction_A_READ, "")
+	if err != nil {
+		return nil, err
+	}
+	sizeLimit := req.GetSizeLimit()
+	if sizeLimit <= 0 {
+		sizeLimit = defaultAssetSizeLimit
+	}
+	rec, err := buildTestingRecord(ctx, s.store, req.GetContest(), req.GetSubmit(), req.GetTesting(), req.GetProblem(), sizeLimit)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return rec, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/contester/advfiler/protos"
+)
+
+func newTestGRPCClient(t *testing.T, s *Store) pb.FilerServiceClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	pb.RegisterFilerServiceServer(gs, NewGRPCServer(s, NewAuthChecker([]string{"tok"}, nil, nil)))
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewFilerServiceClient(conn)
+}
+
+func grpcUpload(ctx context.Context, c pb.FilerServiceClient, path, content string, digests *pb.Digests) (*pb.UploadResponse, error) {
+	stream, err := c.Upload(ctx)
+	if err != nil {
+		return nil, err
+	}
+	msgs := []*pb.UploadRequest{pb.UploadRequest_builder{Path: proto.String(path), ModuleType: proto.String("txt")}.Build()}
+	for len(content) > 0 {
+		n := min(len(content), 1000)
+		msgs = append(msgs, pb.UploadRequest_builder{Data: []byte(content[:n])}.Build())
+		content = content[n:]
+	}
+	msgs[len(msgs)-1].SetDigests(digests)
+	for _, m := range msgs {
+		if err := stream.Send(m); err != nil {
+			return nil, err
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+func TestGRPC(t *testing.T) {
+	s := newTestStore(t)
+	c := newTestGRPCClient(t, s)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer tok")
+
+	content := strings.Repeat("0123456789", 50000)
+	sum := md5.Sum([]byte(content))
+	st, err := grpcUpload(ctx, c, "d/big", content, pb.Digests_builder{Md5: sum[:]}.Build())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.GetSize() != int64(len(content)) || len(st.GetBlake3()) != 32 {
+		t.Errorf("unexpected upload response: %v", st)
+	}
+	_, err = grpcUpload(ctx, c, "d/bad", "x", pb.Digests_builder{Md5: sum[:]}.Build())
+	if status.Code(err) != codes.DataLoss {
+		t.Errorf("expected DataLoss, got %v", err)
+	}
+	if _, err := grpcUpload(context.Background(), c, "d/anon", "x", nil); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated, got %v", err)
+	}
+
+	stream, err := c.Download(ctx, pb.DownloadRequest_builder{Path: proto.String("d/big"), Offset: proto.Int64(10), Limit: proto.Int64(300000)}.Build())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	var stat *pb.FileStat
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.HasStat() {
+			stat = msg.GetStat()
+		}
+		got = append(got, msg.GetData()...)
+	}
+	if string(got) != content[10:300010] || stat.GetSize() != int64(len(content)) || stat.GetModuleType() != "txt" {
+		t.Errorf("download: %d bytes, stat %v", len(got), stat)
+	}
+
+	if fs, err := c.Stat(ctx, pb.StatRequest_builder{Path: proto.String("d/big")}.Build()); err != nil || len(fs.GetBlake3()) != 32 {
+		t.Errorf("stat: %v %v", fs, err)
+	}
+	if _, err := c.Stat(ctx, pb.StatRequest_builder{Path: proto.String("d/none")}.Build()); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+
+	for _, p := range []string{"d/a", "d/b", "d/c"} {
+		if _, err := grpcUpload(ctx, c, p, p, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var all []string
+	req := pb.ListRequest_builder{Prefix: proto.String("d/"), PageSize: proto.Int32(3)}.Build()
+	for {
+		resp, err := c.List(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, resp.GetPaths()...)
+		if resp.GetNextPageToken() == "" {
+			break
+		}
+		req.SetPageToken(resp.GetNextPageToken())
+	}
+	if strings.Join(all, ",") != "d/a,d/b,d/big,d/c" {
+		t.Errorf("list: %v", all)
+	}
+
+	if _, err := c.Delete(ctx, pb.DeleteRequest_builder{Path: proto.String("d/a")}.Build()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Stat(ctx, "d/a"); err == nil {
+		t.Error("deleted file still exists")
+	}
+
+	if _, err := c.GetTestingRecord(ctx, pb.GetTestingRecordRequest_builder{Problem: proto.String("p")}.Build()); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestGRPCUploadLimits(t *testing.T) {
+	s := newTestStore(t)
+	s.SetUploadLimits(UploadLimits{MaxFileSize: 1000})
+	c := newTestGRPCClient(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer tok")
+
+	// The upload fails once it's over the limit, without waiting for the
+	// rest of the stream.
+	stream, err := c.Upload(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := []byte(strings.Repeat("x", 600))
+	for _, m := range []*pb.UploadRequest{
+		pb.UploadRequest_builder{Path: proto.String("big"), Data: chunk}.Build(),
+		pb.UploadRequest_builder{Data: chunk}.Build(),
+	} {
+		if err := stream.Send(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stream.RecvMsg(new(pb.UploadResponse)); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected ResourceExhausted, got %v", err)
+	}
+	if _, err := grpcUpload(ctx, c, "small", strings.Repeat("x", 1000), nil); err != nil {
+		t.Errorf("upload at the limit: %v", err)
+	}
+}
@@ -1,4 +1,6 @@
-package main
+// Package hashes computes and transports the content digests advfiler keeps
+// for every file.
+package hashes
 
 import (
 	"bytes"
@@ -6,6 +8,7 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"hash"
 	"net/http"
@@ -50,10 +53,6 @@ func (s *Hashes) Digests() Digests {
 	}
 }
 
-// emptyDigests holds the digests of zero-length input, synthesized once.
-// Zero-size files don't store their digests; they're served from here.
-var emptyDigests = NewHashes().Digests()
-
 func DigestsFromProto(s *pb.Digests) Digests {
 	if s == nil {
 		return Digests{}
@@ -88,6 +87,17 @@ func DigestsToMap(d Digests) map[string]string {
 	return r
 }
 
+// DigestsFromMap is the inverse of DigestsToMap. Unknown names and values
+// that aren't valid base64 are ignored.
+func DigestsFromMap(m map[string]string) (result Digests) {
+	for _, v := range result.lstable() {
+		if b, err := base64.StdEncoding.DecodeString(m[strings.ToUpper(v.name)]); err == nil && len(b) > 0 {
+			*v.value = b
+		}
+	}
+	return result
+}
+
 type digestField struct {
 	name  string
 	value *[]byte
@@ -148,6 +158,9 @@ func ParseDigests(h http.Header) (result Digests) {
 	return result
 }
 
+// ErrDigestMismatch is wrapped by VerifyDigests errors.
+var ErrDigestMismatch = errors.New("digest mismatch")
+
 // VerifyDigests checks each non-empty received digest against the computed one.
 func VerifyDigests(computed, received Digests) error {
 	pairs := []struct {
@@ -164,7 +177,7 @@ func VerifyDigests(computed, received Digests) error {
 			continue
 		}
 		if !bytes.Equal(p.comp, p.recv) {
-			return fmt.Errorf("%s digest mismatch: transit corruption detected", p.name)
+			return fmt.Errorf("%s %w: transit corruption detected", p.name, ErrDigestMismatch)
 		}
 	}
 	return nil
@@ -1,7 +1,9 @@
-package main
+package hashes
 
 import (
 	"bytes"
+	"encoding/base64"
+	"errors"
 	"net/http"
 	"testing"
 
@@ -56,6 +58,9 @@ func TestDigestsToMap(t *testing.T) {
 	if m["MD5"] == "" {
 		t.Fatal("expected MD5 in map")
 	}
+	if err := VerifyDigests(d, DigestsFromMap(m)); err != nil {
+		t.Fatalf("map roundtrip: %v", err)
+	}
 }
 
 func TestDigestsHeaderRoundTrip(t *testing.T) {
@@ -96,7 +101,33 @@ func TestVerifyDigests(t *testing.T) {
 	}
 	// A mismatched received digest fails.
 	bad := Digests{SHA256: []byte("not the right hash")}
-	if err := VerifyDigests(d, bad); err == nil {
-		t.Fatal("mismatched digest should fail verification")
+	if err := VerifyDigests(d, bad); !errors.Is(err, ErrDigestMismatch) {
+		t.Fatalf("mismatched digest should fail verification, got %v", err)
+	}
+}
+
+func TestPAXDigests(t *testing.T) {
+	h := NewHashes()
+	h.Write([]byte("pax"))
+	d := h.Digests()
+
+	records := make(map[string]string)
+	AddPAXDigests(records, d)
+	d2, err := ParsePAXDigests(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyDigests(d, d2); err != nil || len(d2.MD5) == 0 || len(d2.Blake3) == 0 {
+		t.Fatalf("PAX roundtrip: %+v %v", d2, err)
+	}
+
+	d3, err := ParsePAXDigests(map[string]string{
+		"SCHILY.xattr.user.checksum.sha256": base64.StdEncoding.EncodeToString(d.SHA256),
+	})
+	if err != nil || !bytes.Equal(d3.SHA256, d.SHA256) {
+		t.Fatalf("SCHILY record: %+v %v", d3, err)
+	}
+	if _, err := ParsePAXDigests(map[string]string{PAXPrefix + "sha1": "abc"}); err == nil {
+		t.Fatal("a short digest was accepted")
 	}
 }
@@ -0,0 +1,63 @@
+package hashes
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// PAXPrefix starts the tar PAX records advfiler writes digests to, as
+// ADVFILER.<algorithm>=<hex>. When reading, the SCHILY.xattr.user.checksum.
+// records some archivers write are accepted as well, in hex or base64.
+const PAXPrefix = "ADVFILER."
+
+var paxReadPrefixes = []string{PAXPrefix, "SCHILY.xattr.user.checksum."}
+
+type paxField struct {
+	name  string
+	size  int
+	value *[]byte
+}
+
+func (d *Digests) paxTable() []paxField {
+	return []paxField{
+		{"md5", 16, &d.MD5},
+		{"sha1", 20, &d.SHA1},
+		{"sha256", 32, &d.SHA256},
+		{"blake3", 32, &d.Blake3},
+	}
+}
+
+// AddPAXDigests adds a record for each present digest to records.
+func AddPAXDigests(records map[string]string, d Digests) {
+	for _, v := range d.paxTable() {
+		if len(*v.value) != 0 {
+			records[PAXPrefix+v.name] = hex.EncodeToString(*v.value)
+		}
+	}
+}
+
+// ParsePAXDigests reads the digests found in records. A record that doesn't
+// decode to a digest of the right length is an error.
+func ParsePAXDigests(records map[string]string) (result Digests, err error) {
+	for _, v := range result.paxTable() {
+		for _, prefix := range paxReadPrefixes {
+			s, ok := records[prefix+v.name]
+			if !ok {
+				continue
+			}
+			var b []byte
+			if len(s) == 2*v.size {
+				b, err = hex.DecodeString(s)
+			} else {
+				b, err = base64.StdEncoding.DecodeString(s)
+			}
+			if err != nil || len(b) != v.size {
+				return Digests{}, fmt.Errorf("bad %s digest in PAX record %s", v.name, prefix+v.name)
+			}
+			*v.value = b
+			break
+		}
+	}
+	return result, nil
+}
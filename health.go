@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	pb "github.com/contester/advfiler/protos"
+	"github.com/coreos/go-systemd/daemon"
+	"github.com/dgraph-io/badger/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// Key prefix for the readiness probe (local, never backed up).
+const prefixHealth byte = 0x0a
+
+var healthProbeKey = []byte{prefixHealth, 'p'}
+
+// ErrMaintenance is returned by mutating Store methods in maintenance mode.
+var ErrMaintenance = errors.New("server is in maintenance mode")
+
+// errRestoring is returned by Probe while a restore has the store.
+var errRestoring = errors.New("restore in progress")
+
+// SetMaintenance makes mutating methods fail with ErrMaintenance, except for
+// replication writes, while reads go on as usual.
+func (s *Store) SetMaintenance(v bool) {
+	s.maintenance.Store(v)
+}
+
+// InMaintenance reports whether the store is in maintenance mode.
+func (s *Store) InMaintenance() bool {
+	return s.maintenance.Load()
+}
+
+// Probe writes a key and reads it back in separate transactions. Rather
+// than wait for a restore to finish, it fails with errRestoring.
+func (s *Store) Probe() error {
+	if !s.loadMu.TryRLock() {
+		return errRestoring
+	}
+	defer s.loadMu.RUnlock()
+	v := []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+	if err := s.db.Update(func(tx *badger.Txn) error {
+		return tx.Set(healthProbeKey, v)
+	}); err != nil {
+		return fmt.Errorf("writing probe: %w", err)
+	}
+	return s.db.View(func(tx *badger.Txn) error {
+		item, err := tx.Get(healthProbeKey)
+		if err != nil {
+			return fmt.Errorf("reading probe: %w", err)
+		}
+		return item.Value(func(b []byte) error {
+			if !bytes.Equal(b, v) {
+				return fmt.Errorf("probe read back %q, wrote %q", b, v)
+			}
+			return nil
+		})
+	})
+}
+
+type healthServer struct {
+	store       *Store
+	authChecker AuthCheck
+	// dirs hold the database; each needs minFree bytes available.
+	dirs    []string
+	minFree uint64
+
+	// probeMu keeps concurrent probes from reading each other's writes.
+	probeMu sync.Mutex
+}
+
+func NewHealthServer(store *Store, authChecker AuthCheck, dirs []string, minFree int64) *healthServer {
+	return &healthServer{store: store, authChecker: authChecker, dirs: dirs, minFree: uint64(max(minFree, 0))}
+}
+
+func (h *healthServer) probe() error {
+	h.probeMu.Lock()
+	defer h.probeMu.Unlock()
+	return h.store.Probe()
+}
+
+func (h *healthServer) checkDisk() error {
+	for _, dir := range h.dirs {
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(dir, &st); err != nil {
+			return fmt.Errorf("%s: %w", dir, err)
+		}
+		if free := st.Bavail * uint64(st.Bsize); free < h.minFree {
+			return fmt.Errorf("%s: %d bytes free, %d needed", dir, free, h.minFree)
+		}
+	}
+	return nil
+}
+
+type readiness struct {
+	Badger      string `json:"badger"`
+	Disk        string `json:"disk"`
+	ReadOnly    bool   `json:"readOnly"`
+	Maintenance bool   `json:"maintenance"`
+}
+
+func checkStatus(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return "ok"
+}
+
+// handleHealthz serves GET /healthz: the process is up.
+func (h *healthServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz serves GET /readyz: Badger takes a write and reads it back,
+// and the disks have room. Maintenance mode doesn't make the server
+// unready since reads still work.
+func (h *healthServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	probeErr, diskErr := h.probe(), h.checkDisk()
+	status := http.StatusOK
+	if probeErr != nil || diskErr != nil {
+		status = http.StatusServiceUnavailable
+		requestLog(r.Context()).Warnf("not ready: badger: %s, disk: %s", checkStatus(probeErr), checkStatus(diskErr))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(readiness{
+		Badger:      checkStatus(probeErr),
+		Disk:        checkStatus(diskErr),
+		ReadOnly:    h.store.readOnly.Load(),
+		Maintenance: h.store.InMaintenance(),
+	})
+}
+
+// handleMaintenance serves /admin/maintenance: GET shows the mode, PUT or
+// POST with ?enabled=true|false sets it.
+func (h *healthServer) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	if v, _ := h.authChecker.Check(r.Context(), tokenFromHeader(r), pb.AuthAction_A_ADMIN, ""); !v {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+		if err != nil {
+			http.Error(w, "invalid enabled", http.StatusBadRequest)
+			return
+		}
+		h.store.SetMaintenance(enabled)
+		requestLog(r.Context()).Infof("maintenance mode set to %v by %s", enabled, h.authChecker.Identify(tokenFromHeader(r)))
+	default:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Maintenance bool `json:"maintenance"`
+	}{h.store.InMaintenance()})
+}
+
+// watchdog pings the systemd watchdog every interval for as long as Badger
+// passes the probe, until ctx is done. Low disk space doesn't stop it: a
+// restart wouldn't help. Neither does a restore, which a restart would
+// leave half done.
+func (h *healthServer) watchdog(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := h.probe(); err != nil && !errors.Is(err, errRestoring) {
+			log.Errorf("watchdog: %v", err)
+			continue
+		}
+		daemon.SdNotify(false, daemon.SdNotifyWatchdog)
+	}
+}
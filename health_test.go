@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	s, srv := newTestServer(t)
+	hs := NewHealthServer(s, NewAuthChecker([]string{"tok"}, []string{"admin"}, nil), []string{t.TempDir()}, 0)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", hs.handleHealthz)
+	mux.HandleFunc("/readyz", hs.handleReadyz)
+	mux.HandleFunc("/admin/maintenance", hs.handleMaintenance)
+	hsrv := httptest.NewServer(mux)
+	defer hsrv.Close()
+
+	if resp, _ := doRequest(t, newTestRequest(t, http.MethodGet, hsrv.URL+"/healthz", nil)); resp.StatusCode != http.StatusOK {
+		t.Errorf("healthz: %s", resp.Status)
+	}
+	var rd readiness
+	resp, body := doRequest(t, newTestRequest(t, http.MethodGet, hsrv.URL+"/readyz", nil))
+	json.Unmarshal([]byte(body), &rd)
+	if resp.StatusCode != http.StatusOK || rd.Badger != "ok" || rd.Disk != "ok" {
+		t.Errorf("readyz: %s %+v", resp.Status, rd)
+	}
+	hs.minFree = math.MaxUint64
+	if resp, _ := doRequest(t, newTestRequest(t, http.MethodGet, hsrv.URL+"/readyz", nil)); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("readyz with a full disk: %s", resp.Status)
+	}
+
+	ctx := context.Background()
+	if _, err := s.Upload(ctx, FileInfo{Name: "a"}, strings.NewReader("a")); err != nil {
+		t.Fatal(err)
+	}
+	if resp, _ := doRequest(t, authorized(t, http.MethodPut, hsrv.URL+"/admin/maintenance?enabled=true", nil)); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("maintenance by a non-admin: %s", resp.Status)
+	}
+	if resp, _ := doRequest(t, newTestRequest(t, http.MethodPut, hsrv.URL+"/admin/maintenance?enabled=true", nil), "Authorization", "Bearer admin"); resp.StatusCode != http.StatusOK || !s.InMaintenance() {
+		t.Fatalf("entering maintenance: %s", resp.Status)
+	}
+	resp, _ = doRequest(t, authorized(t, http.MethodPut, srv.URL+"/fs/b", strings.NewReader("b")))
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("write in maintenance: %s %v", resp.Status, resp.Header)
+	}
+	if err := s.Delete(ctx, "a"); !errors.Is(err, ErrMaintenance) {
+		t.Errorf("delete in maintenance: %v", err)
+	}
+	if resp, _ := doRequest(t, authorized(t, http.MethodGet, srv.URL+"/fs/a", nil)); resp.StatusCode != http.StatusOK {
+		t.Errorf("read in maintenance: %s", resp.Status)
+	}
+	if _, err := s.Upload(withReplicationWrite(ctx), FileInfo{Name: "r"}, strings.NewReader("r")); err != nil {
+		t.Errorf("replication write in maintenance: %v", err)
+	}
+
+	doRequest(t, newTestRequest(t, http.MethodPost, hsrv.URL+"/admin/maintenance?enabled=false", nil), "Authorization", "Bearer admin")
+	if resp, _ := doRequest(t, authorized(t, http.MethodPut, srv.URL+"/fs/b", strings.NewReader("b"))); resp.StatusCode != http.StatusOK {
+		t.Errorf("write after maintenance: %s", resp.Status)
+	}
+}
+
+func TestWatchdogDuringRestore(t *testing.T) {
+	s := newTestStore(t)
+	hs := NewHealthServer(s, NewAuthChecker(nil, nil, nil), nil, 0)
+
+	sock := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sock, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", sock)
+
+	// The restore holds the store until its stream ends.
+	pr, pw := io.Pipe()
+	restored := make(chan error, 1)
+	go func() { restored <- s.Restore(pr) }()
+	for s.loadMu.TryRLock() {
+		s.loadMu.RUnlock()
+		time.Sleep(time.Millisecond)
+	}
+
+	probed := make(chan error, 1)
+	go func() { probed <- s.Probe() }()
+	select {
+	case err := <-probed:
+		if !errors.Is(err, errRestoring) {
+			t.Errorf("probe during a restore: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("probe blocked by the restore")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hs.watchdog(ctx, 10*time.Millisecond)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 64)
+	if n, err := conn.Read(buf); err != nil || string(buf[:n]) != "WATCHDOG=1" {
+		t.Errorf("watchdog during a restore: %q, %v", buf[:n], err)
+	}
+
+	pw.Close()
+	<-restored
+	if err := s.Probe(); err != nil {
+		t.Errorf("probe after the restore: %v", err)
+	}
+}
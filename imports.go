@@ -0,0 +1,383 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/contester/advfiler/hashes"
+	pb "github.com/contester/advfiler/protos"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Import outcomes.
+const (
+	outcomeCreated    = "created"
+	outcomeReplaced   = "replaced"
+	outcomeSkipped    = "skipped"
+	outcomeConflicted = "conflicted"
+)
+
+// importEntry reports what happened to one archive member.
+type importEntry struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	Hardlinked bool   `json:"hardlinked,omitempty"`
+	Outcome    string `json:"outcome,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// importReport is the response to a tar or zip import. Error is set when
+// the archive itself could not be read; files before that point are listed.
+type importReport struct {
+	Files      []importEntry `json:"files"`
+	RealSize   int64         `json:"realSize"`
+	SavedSize  int64         `json:"savedSize"`
+	Created    int           `json:"created"`
+	Replaced   int           `json:"replaced"`
+	Skipped    int           `json:"skipped"`
+	Conflicted int           `json:"conflicted"`
+	Error      string        `json:"error,omitempty"`
+
+	// status answers for the first file that failed or conflicted.
+	status int
+}
+
+func (rep *importReport) add(ctx context.Context, name string, res UploadStatus, err error) {
+	if err != nil && rep.status == 0 {
+		rep.status = storeErrorStatus(err)
+	}
+	if errors.Is(err, ErrConflict) {
+		rep.Files = append(rep.Files, importEntry{Path: name, Outcome: outcomeConflicted, Error: err.Error()})
+		rep.Conflicted++
+		return
+	}
+	if err != nil {
+		requestLog(ctx).Errorf("importing %q: %v", name, err)
+		rep.Files = append(rep.Files, importEntry{Path: name, Error: err.Error()})
+		return
+	}
+	e := importEntry{Path: name, Size: res.Size, Hardlinked: res.Hardlinked}
+	switch {
+	case res.Skipped:
+		e.Outcome = outcomeSkipped
+		rep.Skipped++
+	case res.Replaced:
+		e.Outcome = outcomeReplaced
+		rep.Replaced++
+	default:
+		e.Outcome = outcomeCreated
+		rep.Created++
+	}
+	rep.Files = append(rep.Files, e)
+	if res.Skipped {
+		return
+	}
+	if res.Hardlinked {
+		rep.SavedSize += res.Size
+	} else {
+		rep.RealSize += res.Size
+	}
+}
+
+// importContext is the context bulk imports write with: audited as action,
+// under the ?conflict= policy.
+func (f *filerServer) importContext(r *http.Request, action string) (context.Context, error) {
+	policy, err := parseConflictPolicy(r.FormValue("conflict"))
+	if err != nil {
+		return nil, err
+	}
+	return WithConflictPolicy(auditContext(r, f.authChecker, action), policy), nil
+}
+
+// write sends the report; a broken archive gets a 400, and a file that
+// failed or conflicted the status its error maps to. The files stored
+// before the breakage, or besides the failures, stay.
+func (rep *importReport) write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case rep.Error != "":
+		w.WriteHeader(http.StatusBadRequest)
+	case rep.status != 0:
+		w.WriteHeader(rep.status)
+	}
+	if rep.Files == nil {
+		rep.Files = []importEntry{}
+	}
+	json.NewEncoder(w).Encode(rep)
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// decompressedReader looks at the first bytes of r and unwraps gzip, zstd
+// or xz compression; anything else is returned as is. The returned function
+// releases the decoder.
+func decompressedReader(r io.Reader) (io.Reader, func(), error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(xzMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, func() { zr.Close() }, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr.Close, nil
+	case bytes.HasPrefix(magic, xzMagic):
+		zr, err := xz.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, func() {}, nil
+	}
+	return br, func() {}, nil
+}
+
+// importTar stores every regular file of a possibly compressed tar stream.
+func (f *filerServer) importTar(ctx context.Context, r io.Reader) *importReport {
+	var rep importReport
+	r, done, err := decompressedReader(r)
+	if err != nil {
+		rep.Error = err.Error()
+		return &rep
+	}
+	defer done()
+
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			rep.Error = err.Error()
+			break
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		if h.Name == "" || strings.HasSuffix(h.Name, "/") {
+			continue
+		}
+		digests, err := hashes.ParsePAXDigests(h.PAXRecords)
+		if err != nil {
+			rep.add(ctx, h.Name, UploadStatus{}, err)
+			continue
+		}
+		fi := FileInfo{
+			ModuleType:    h.Xattrs["user.fs_module_type"],
+			Name:          h.Name,
+			ContentLength: h.Size,
+			Attributes:    attributesFromXattrs(h.Xattrs),
+			RecvDigests:   digests,
+		}
+		if !h.ModTime.IsZero() {
+			fi.TimestampUnix = h.ModTime.Unix()
+		}
+		res, err := f.store.Upload(ctx, fi, tr)
+		rep.add(ctx, h.Name, res, err)
+	}
+	return &rep
+}
+
+// zipExtraID tags the advfiler extra field of zip entries. Its payload is a
+// URL-encoded query with what zip has no place for: module_type=<type>,
+// meta.<key>=<value> for each attribute, and sha256=<hex> and blake3=<hex>.
+const zipExtraID = 0x6661
+
+// zipExtra returns the advfiler extra field for a file, or nil if there is
+// nothing to put in it.
+func zipExtra(moduleType string, attrs map[string]string, d hashes.Digests) []byte {
+	q := make(url.Values)
+	if moduleType != "" {
+		q.Set("module_type", moduleType)
+	}
+	for k, v := range attrs {
+		q.Set("meta."+k, v)
+	}
+	if len(d.SHA256) != 0 {
+		q.Set("sha256", hex.EncodeToString(d.SHA256))
+	}
+	if len(d.Blake3) != 0 {
+		q.Set("blake3", hex.EncodeToString(d.Blake3))
+	}
+	if len(q) == 0 {
+		return nil
+	}
+	data := q.Encode()
+	b := binary.LittleEndian.AppendUint16(nil, zipExtraID)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+// parseZipExtra finds the advfiler field among the extra fields of a zip
+// entry.
+func parseZipExtra(extra []byte) (moduleType string, attrs map[string]string, d hashes.Digests) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			return "", nil, d
+		}
+		if id == zipExtraID {
+			q, err := url.ParseQuery(string(extra[4 : 4+size]))
+			if err != nil {
+				return "", nil, d
+			}
+			for k, v := range q {
+				if name, ok := strings.CutPrefix(k, "meta."); ok {
+					if attrs == nil {
+						attrs = make(map[string]string)
+					}
+					attrs[name] = v[0]
+				}
+			}
+			d.SHA256, _ = hex.DecodeString(q.Get("sha256"))
+			d.Blake3, _ = hex.DecodeString(q.Get("blake3"))
+			return q.Get("module_type"), attrs, d
+		}
+		extra = extra[4+size:]
+	}
+	return "", nil, d
+}
+
+var errUnsafeName = errors.New("name escapes the destination")
+
+// zipDestination maps a zip member name to a path under prefix.
+func zipDestination(prefix, name string) (string, error) {
+	name = strings.TrimPrefix(name, "/")
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return "", errUnsafeName
+		}
+	}
+	name = path.Clean(name)
+	if name == "." {
+		return "", errUnsafeName
+	}
+	if prefix == "" {
+		return name, nil
+	}
+	return path.Join(prefix, name), nil
+}
+
+// importZip stores every regular file of a zip archive under prefix.
+func (f *filerServer) importZip(ctx context.Context, zr *zip.Reader, prefix string) *importReport {
+	var rep importReport
+	zr.RegisterDecompressor(zstd.ZipMethodWinZip, zstd.ZipDecompressor())
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() || strings.HasSuffix(zf.Name, "/") {
+			continue
+		}
+		name, err := zipDestination(prefix, zf.Name)
+		if err != nil {
+			rep.add(ctx, zf.Name, UploadStatus{}, err)
+			continue
+		}
+		moduleType, attrs, digests := parseZipExtra(zf.Extra)
+		fi := FileInfo{
+			ModuleType:    moduleType,
+			Name:          name,
+			ContentLength: int64(zf.UncompressedSize64),
+			Attributes:    attrs,
+			RecvDigests:   digests,
+		}
+		if !zf.Modified.IsZero() {
+			fi.TimestampUnix = zf.Modified.Unix()
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			rep.add(ctx, name, UploadStatus{}, err)
+			continue
+		}
+		res, err := f.store.Upload(ctx, fi, rc)
+		rc.Close()
+		rep.add(ctx, name, res, err)
+	}
+	return &rep
+}
+
+// handleZipUpload imports a zip archive sent with PUT /zip/, storing its
+// members under the prefix given as ?prefix=. GET exports one.
+func (f *filerServer) handleZipUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		f.handleArchiveDownload(w, r, "zip")
+		return
+	}
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	prefix := strings.Trim(r.FormValue("prefix"), "/")
+	if v, _ := f.authChecker.Check(r.Context(), tokenFromHeader(r), pb.AuthAction_A_WRITE, prefix); !v {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ctx, err := f.importContext(r, AuditZipImport)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := f.store.checkWritable(ctx); err != nil {
+		http.Error(w, err.Error(), storeErrorStatus(err))
+		return
+	}
+
+	// The central directory is at the end, so the archive has to be
+	// spooled before anything can be read.
+	body := r.Body
+	if limit := f.store.admission.maxArchiveSize(); limit > 0 {
+		if r.ContentLength > limit {
+			http.Error(w, fmt.Sprintf("archive is larger than %d bytes", limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		body = http.MaxBytesReader(w, r.Body, limit)
+	}
+	tmp, err := os.CreateTemp("", "advfiler-import-*.zip")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, body)
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		http.Error(w, fmt.Sprintf("archive is larger than %d bytes", mbe.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("reading the archive: %v", err), http.StatusBadRequest)
+		return
+	}
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		(&importReport{Error: err.Error()}).write(w)
+		return
+	}
+	f.importZip(ctx, zr, prefix).write(w)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/contester/advfiler/client"
+	"github.com/contester/advfiler/hashes"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func TestCompressedTarImport(t *testing.T) {
+	_, srv := newTestServer(t)
+	ctx := context.Background()
+	c := client.New(srv.URL, "tok")
+	mtime := time.Unix(1700000000, 0)
+
+	var tb bytes.Buffer
+	tw := tar.NewWriter(&tb)
+	tw.WriteHeader(&tar.Header{Name: "pkg/1", Size: 3, Mode: 0644, Typeflag: tar.TypeReg, ModTime: mtime,
+		PAXRecords: map[string]string{"SCHILY.xattr.user.fs_module_type": "txt"}})
+	tw.Write([]byte("one"))
+	tw.WriteHeader(&tar.Header{Name: "pkg/2", Size: 3, Mode: 0644, Typeflag: tar.TypeReg, ModTime: mtime})
+	tw.Write([]byte("one"))
+	tw.Close()
+
+	for _, cc := range []struct {
+		name     string
+		compress func(io.Writer) io.WriteCloser
+	}{
+		{"none", func(w io.Writer) io.WriteCloser { return nopWriteCloser{w} }},
+		{"gzip", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+		{"zstd", func(w io.Writer) io.WriteCloser { zw, _ := zstd.NewWriter(w); return zw }},
+		{"xz", func(w io.Writer) io.WriteCloser { zw, _ := xz.NewWriter(w); return zw }},
+	} {
+		name := cc.name
+		var b bytes.Buffer
+		zw := cc.compress(&b)
+		zw.Write(tb.Bytes())
+		zw.Close()
+		if err := c.Delete(ctx, "pkg/1"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			t.Fatal(err)
+		}
+		rep, err := c.TarImport(ctx, &b, "")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(rep.Files) != 2 || rep.Files[0].Path != "pkg/1" || rep.Files[0].Size != 3 || rep.Files[1].Error != "" {
+			t.Errorf("%s: report %+v", name, rep)
+		}
+		fi, err := c.Stat(ctx, "pkg/1")
+		if err != nil || fi.ModuleType != "txt" || !fi.ModTime.Equal(mtime) {
+			t.Errorf("%s: stat %+v %v", name, fi, err)
+		}
+	}
+
+	// A truncated archive keeps what came before the damage and says so.
+	resp, err := http.DefaultClient.Do(authorized(t, http.MethodPut, srv.URL+"/tar/", bytes.NewReader(tb.Bytes()[:2200])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var rep importReport
+	json.NewDecoder(resp.Body).Decode(&rep)
+	if resp.StatusCode != http.StatusBadRequest || rep.Error == "" || len(rep.Files) != 1 {
+		t.Errorf("truncated archive: %s %+v", resp.Status, rep)
+	}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestZipImport(t *testing.T) {
+	s, srv := newTestServer(t)
+	ctx := context.Background()
+	c := client.New(srv.URL, "tok")
+	mtime := time.Unix(1700000000, 0)
+
+	var zb bytes.Buffer
+	zw := zip.NewWriter(&zb)
+	add := func(fh *zip.FileHeader, content string) {
+		w, err := zw.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, content)
+	}
+	add(&zip.FileHeader{Name: "tests/"}, "")
+	add(&zip.FileHeader{Name: "tests/01", Method: zip.Deflate, Modified: mtime,
+		Extra: zipExtra("txt", map[string]string{"gen": "gen 1"}, hashes.Digests{})}, "input")
+	add(&zip.FileHeader{Name: "checker.cpp", Method: zip.Store, Modified: mtime}, "int main() {}")
+	add(&zip.FileHeader{Name: "../escape"}, "x")
+	zw.Close()
+
+	// The escaping entry fails the request, but the others are stored.
+	rep, err := c.ZipImport(ctx, &zb, "problem/p1/", "")
+	var ce *client.Error
+	if !errors.As(err, &ce) || ce.StatusCode != http.StatusBadRequest || rep == nil {
+		t.Fatalf("import with a failed entry: %v", err)
+	}
+	var paths []string
+	for _, f := range rep.Files {
+		paths = append(paths, f.Path)
+	}
+	if strings.Join(paths, ",") != "problem/p1/tests/01,problem/p1/checker.cpp,../escape" ||
+		rep.Files[2].Error == "" || rep.RealSize != int64(len("input")+len("int main() {}")) {
+		t.Errorf("report: %+v", rep)
+	}
+	fi, err := c.Stat(ctx, "problem/p1/tests/01")
+	if err != nil || fi.ModuleType != "txt" || fi.Attributes["gen"] != "gen 1" || !fi.ModTime.Equal(mtime) {
+		t.Errorf("stat: %+v %v", fi, err)
+	}
+	if names, err := c.List(ctx, ""); err != nil || len(names) != 2 {
+		t.Errorf("list: %v %v", names, err)
+	}
+
+	if _, err := c.ZipImport(ctx, strings.NewReader("not a zip"), "", ""); err == nil {
+		t.Error("importing garbage succeeded")
+	}
+
+	// Archives over the limit aren't spooled, whether or not their length
+	// is declared.
+	s.SetUploadLimits(UploadLimits{MaxArchiveSize: 100})
+	big := strings.Repeat("x", 101)
+	for _, r := range []io.Reader{strings.NewReader(big), io.MultiReader(strings.NewReader(big))} {
+		if _, err := c.ZipImport(ctx, r, "", ""); !errors.As(err, &ce) || ce.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Errorf("archive over the limit: %v", err)
+		}
+	}
+}
+
+func TestImportVerifiesDigests(t *testing.T) {
+	_, srv := newTestServer(t)
+	ctx := context.Background()
+	c := client.New(srv.URL, "tok")
+
+	good := hashes.NewHashes()
+	good.Write([]byte("one"))
+	records := make(map[string]string)
+	hashes.AddPAXDigests(records, good.Digests())
+	var tb bytes.Buffer
+	tw := tar.NewWriter(&tb)
+	tw.WriteHeader(&tar.Header{Name: "ok", Size: 3, Mode: 0644, Typeflag: tar.TypeReg, PAXRecords: records})
+	tw.Write([]byte("one"))
+	tw.WriteHeader(&tar.Header{Name: "corrupt", Size: 3, Mode: 0644, Typeflag: tar.TypeReg, PAXRecords: records})
+	tw.Write([]byte("two"))
+	tw.WriteHeader(&tar.Header{Name: "schily", Size: 3, Mode: 0644, Typeflag: tar.TypeReg,
+		PAXRecords: map[string]string{"SCHILY.xattr.user.checksum.sha256": "bm90IGEgZGlnZXN0"}})
+	tw.Write([]byte("one"))
+	tw.Close()
+
+	rep, err := c.TarImport(ctx, &tb, "")
+	if err == nil || rep == nil {
+		t.Fatalf("import with corrupt files: %v", err)
+	}
+	if len(rep.Files) != 3 || rep.Files[0].Error != "" || !strings.Contains(rep.Files[1].Error, "digest mismatch") ||
+		!strings.Contains(rep.Files[2].Error, "bad sha256 digest") {
+		t.Errorf("report: %+v", rep)
+	}
+	if names, err := c.List(ctx, ""); err != nil || len(names) != 1 {
+		t.Errorf("stored: %v %v", names, err)
+	}
+
+	// Zip entries carry their digests in the advfiler extra field.
+	var zb bytes.Buffer
+	zw := zip.NewWriter(&zb)
+	w, _ := zw.CreateHeader(&zip.FileHeader{Name: "z", Extra: zipExtra("", nil, good.Digests())})
+	io.WriteString(w, "two")
+	zw.Close()
+	if rep, err := c.ZipImport(ctx, &zb, "", ""); err == nil || rep == nil || len(rep.Files) != 1 || !strings.Contains(rep.Files[0].Error, "digest mismatch") {
+		t.Errorf("zip: %+v %v", rep, err)
+	}
+}
+
+func TestZipDestination(t *testing.T) {
+	for _, c := range []struct{ prefix, name, want string }{
+		{"", "a/b", "a/b"},
+		{"", "./a//b", "a/b"},
+		{"", "/a/./b/", "a/b"},
+		{"p/", "./a//b", "p/a/b"},
+		{"", "..", ""},
+		{"", "a/../../b", ""},
+		{"p", "a/../b", ""},
+		{"", "./", ""},
+	} {
+		got, err := zipDestination(c.prefix, c.name)
+		if c.want == "" {
+			if !errors.Is(err, errUnsafeName) {
+				t.Errorf("zipDestination(%q, %q) = %q, %v; want errUnsafeName", c.prefix, c.name, got, err)
+			}
+		} else if got != c.want || err != nil {
+			t.Errorf("zipDestination(%q, %q) = %q, %v; want %q", c.prefix, c.name, got, err, c.want)
+		}
+	}
+}
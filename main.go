@@ -1,15 +1,21 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net"
 	"net/http"
 	"os"
+	"time"
 
+	pb "github.com/contester/advfiler/protos"
 	"github.com/coreos/go-systemd/daemon"
 	"github.com/dgraph-io/badger/v4"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/trace"
+	"google.golang.org/grpc"
 	"stingr.net/go/systemdutil"
 
 	_ "net/http/pprof"
@@ -17,9 +23,83 @@ import (
 
 type config struct {
 	ListenHTTP      []string `envconfig:"LISTEN_HTTP"`
+	ListenGRPC      []string `envconfig:"LISTEN_GRPC"`
 	BadgerDir       string   `envconfig:"BADGER_DIR"`
 	BadgerValueDir  string   `envconfig:"BADGER_VALUE_DIR"`
 	ValidAuthTokens []string `envconfig:"VALID_AUTH_TOKENS"`
+	AdminAuthTokens []string `envconfig:"ADMIN_AUTH_TOKENS"`
+	// NamedAuthTokens maps identity names to tokens (name:token,...); named
+	// tokens are valid too, and show up by name in the audit log.
+	NamedAuthTokens map[string]string `envconfig:"NAMED_AUTH_TOKENS"`
+
+	ChangeFeedBuffer int `envconfig:"CHANGE_FEED_BUFFER" default:"10000"`
+
+	// ReplicateFrom, if set, runs this instance as a read-only replica of
+	// the advfiler at that base URL.
+	ReplicateFrom         string        `envconfig:"REPLICATE_FROM"`
+	ReplicaAuthToken      string        `envconfig:"REPLICA_AUTH_TOKEN"`
+	ReplicaInterval       time.Duration `envconfig:"REPLICA_INTERVAL" default:"2s"`
+	ReplicaResyncInterval time.Duration `envconfig:"REPLICA_RESYNC_INTERVAL" default:"6h"`
+
+	// S3Keys maps S3 access key IDs to secret keys (id:secret,...) and
+	// enables the S3 API under /s3/. Each secret must also be a valid token.
+	S3Keys map[string]string `envconfig:"S3_KEYS"`
+
+	// UploadTTL is how long a resumable upload may sit idle before it's
+	// discarded.
+	UploadTTL time.Duration `envconfig:"UPLOAD_TTL" default:"24h"`
+
+	// MaxFileSize caps the size of a stored file; MaxFileSizes overrides it
+	// for path prefixes (prefix:bytes,...). MaxUploads and UploadMemory
+	// bound the uploads in flight and the memory they hold, MaxArchiveSize
+	// the zip archives spooled to disk for import. Zero is no limit.
+	MaxFileSize    int64            `envconfig:"MAX_FILE_SIZE"`
+	MaxFileSizes   map[string]int64 `envconfig:"MAX_FILE_SIZES"`
+	MaxUploads     int              `envconfig:"MAX_UPLOADS"`
+	UploadMemory   int64            `envconfig:"UPLOAD_MEMORY"`
+	MaxArchiveSize int64            `envconfig:"MAX_ARCHIVE_SIZE" default:"4294967296"`
+
+	// Timeouts of the HTTP listeners. Reading and writing are unbounded by
+	// default since archives and change feeds stream for a long time.
+	ReadHeaderTimeout time.Duration `envconfig:"READ_HEADER_TIMEOUT" default:"30s"`
+	ReadTimeout       time.Duration `envconfig:"READ_TIMEOUT"`
+	WriteTimeout      time.Duration `envconfig:"WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `envconfig:"IDLE_TIMEOUT" default:"2m"`
+
+	// RateLimits (requests/s) and BandwidthLimits (bytes/s) apply to each
+	// token identity, or client address without a valid token, by URL path
+	// prefix (prefix:limit,...); the longest matching prefix is the endpoint
+	// group. /healthz, /readyz and /metrics aren't limited.
+	RateLimits      map[string]float64 `envconfig:"RATE_LIMITS"`
+	BandwidthLimits map[string]int64   `envconfig:"BANDWIDTH_LIMITS"`
+
+	// AccessLog is the file the JSON access log is appended to; it goes to
+	// stderr by default.
+	AccessLog string `envconfig:"ACCESS_LOG"`
+
+	// TraceExporter sends OpenTelemetry spans to "otlp", set up by the
+	// standard OTEL_EXPORTER_OTLP_* variables, or "stdout".
+	TraceExporter string `envconfig:"TRACE_EXPORTER"`
+
+	// MinFreeSpace is the space, in bytes, /readyz wants left on the
+	// Badger directories.
+	MinFreeSpace int64 `envconfig:"MIN_FREE_SPACE" default:"1073741824"`
+
+	// ShutdownTimeout is how long shutdown waits for requests in flight
+	// before cutting them off.
+	ShutdownTimeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"30s"`
+
+	// EncryptionKeyFile holds the key Badger encrypts the database with:
+	// 16, 24 or 32 bytes, raw or hex-encoded. Without it the key comes from
+	// the systemd credential named EncryptionKeyCredential, if loaded.
+	// Badger wraps a fresh data key in it every EncryptionKeyRotation.
+	EncryptionKeyFile       string        `envconfig:"ENCRYPTION_KEY_FILE"`
+	EncryptionKeyCredential string        `envconfig:"ENCRYPTION_KEY_CREDENTIAL" default:"advfiler-encryption-key"`
+	EncryptionKeyRotation   time.Duration `envconfig:"ENCRYPTION_KEY_ROTATION" default:"240h"`
+	// IndexCacheSize bounds the memory, in bytes, table indexes are cached
+	// in; zero keeps them all in memory. Worth setting with encryption,
+	// where indexes are decrypted on load.
+	IndexCacheSize int64 `envconfig:"INDEX_CACHE_SIZE"`
 }
 
 func main() {
@@ -39,12 +119,7 @@ func main() {
 
 	_, httpSockets, _ := systemdutil.ListenSystemd(systemdutil.ActivationFiles())
 
-	authCheck := AuthChecker{
-		validTokens: make(map[string]struct{}, len(cfg.ValidAuthTokens)),
-	}
-	for _, v := range cfg.ValidAuthTokens {
-		authCheck.validTokens[v] = struct{}{}
-	}
+	authCheck := NewAuthChecker(cfg.ValidAuthTokens, cfg.AdminAuthTokens, cfg.NamedAuthTokens)
 
 	httpSockets = append(httpSockets, systemdutil.MustListenTCPSlice(cfg.ListenHTTP)...)
 
@@ -58,31 +133,164 @@ func main() {
 	if err := os.MkdirAll(opts.ValueDir, os.ModePerm); err != nil {
 		log.Fatalf("can't create badger value dir: %v", err)
 	}
+	key, err := readEncryptionKey(cfg.EncryptionKeyFile, cfg.EncryptionKeyCredential)
+	if err != nil {
+		log.Fatalf("can't read encryption key: %v", err)
+	}
+	opts = opts.WithEncryptionKey(key).
+		WithEncryptionKeyRotationDuration(cfg.EncryptionKeyRotation).
+		WithIndexCacheSize(cfg.IndexCacheSize)
 
-	db, err := badger.Open(opts)
+	// contester-advfiler rotate-key NEWKEYFILE re-encrypts the stopped
+	// database's data keys with the key in NEWKEYFILE.
+	if args := os.Args[1:]; len(args) == 2 && args[0] == "rotate-key" {
+		b, err := os.ReadFile(args[1])
+		if err != nil {
+			log.Fatalf("can't read new encryption key: %v", err)
+		}
+		newKey, err := parseEncryptionKey(b)
+		if err != nil {
+			log.Fatalf("%s: %v", args[1], err)
+		}
+		if err := rotateEncryptionKey(opts.Dir, key, newKey, opts.EncryptionKeyRotationDuration); err != nil {
+			log.Fatalf("can't rotate encryption key: %v", err)
+		}
+		log.Infof("%s is now encrypted with the key in %s", opts.Dir, args[1])
+		return
+	}
+
+	db, err := openBadger(opts)
 	if err != nil {
 		log.Fatalf("can't open badger: %v", err)
 	}
-	defer db.Close()
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Errorf("closing badger: %v", err)
+		}
+	}()
 
 	store := NewStore(db)
 	defer store.Close()
+	store.SetUploadLimits(UploadLimits{
+		MaxFileSize:       cfg.MaxFileSize,
+		PrefixMaxFileSize: cfg.MaxFileSizes,
+		MaxUploads:        cfg.MaxUploads,
+		MaxMemory:         cfg.UploadMemory,
+		MaxArchiveSize:    cfg.MaxArchiveSize,
+	})
+
+	feed := NewChangeFeed(store, cfg.ChangeFeedBuffer)
+	defer feed.Close()
+
+	var replica *Replica
+	if cfg.ReplicateFrom != "" {
+		promoted, err := store.IsPromoted()
+		if err != nil {
+			log.Fatalf("can't read replication state: %v", err)
+		}
+		if promoted {
+			log.Warnf("this store was promoted to primary; ignoring ADVFILER_REPLICATE_FROM=%s", cfg.ReplicateFrom)
+		} else {
+			replica = NewReplica(store, ReplicaConfig{
+				Primary:        cfg.ReplicateFrom,
+				AuthToken:      cfg.ReplicaAuthToken,
+				Interval:       cfg.ReplicaInterval,
+				ResyncInterval: cfg.ReplicaResyncInterval,
+			})
+			defer replica.Close()
+		}
+	}
 
-	f := NewFiler(store, &authCheck)
-	ms := NewMetadataServer(store)
-	xs := NewXMLServer(store, &authCheck)
+	f := NewFiler(store, authCheck)
+	ms := NewMetadataServer(store, authCheck)
+	xs := NewXMLServer(store, authCheck)
+	cs := NewChangesServer(feed, authCheck)
+	as := NewAuditServer(store, authCheck)
+	rs := NewReplicationServer(store, authCheck, replica)
+	bs := NewBackupServer(store, authCheck)
+	hs := NewHealthServer(store, authCheck, []string{opts.Dir, opts.ValueDir}, cfg.MinFreeSpace)
 	http.Handle("/fs/", f)
 	http.HandleFunc("/fs2/", f.HandlePackage)
 	http.HandleFunc("/problem/set/", ms.handleSetManifest)
 	http.HandleFunc("/problem/get/", ms.handleGetManifest)
 	http.HandleFunc("/tar/", f.handleTarUpload)
+	http.HandleFunc("/zip/", f.handleZipUpload)
 	http.HandleFunc("/wipe/", f.handleWipe)
 	http.HandleFunc("/protopackage/", f.handleProtoPackage)
 	http.HandleFunc("/protopackage", f.handleProtoPackage)
 	http.HandleFunc("/xml/contest/", xs.handleContest)
 	http.HandleFunc("/xml/problem/", xs.handleProblem)
-	systemdutil.ServeAll(nil, httpSockets, nil)
+	http.HandleFunc("/changes/", cs.handleChanges)
+	http.HandleFunc("/audit/", as.handleAudit)
+	http.HandleFunc("/replication/log", rs.handleLog)
+	http.HandleFunc("/replication/blob/", rs.handleBlob)
+	http.HandleFunc("/replication/promote", rs.handlePromote)
+	http.HandleFunc("/admin/backup", bs.handleBackup)
+	http.HandleFunc("/admin/restore", bs.handleRestore)
+	http.HandleFunc("/healthz", hs.handleHealthz)
+	http.HandleFunc("/readyz", hs.handleReadyz)
+	http.HandleFunc("/admin/maintenance", hs.handleMaintenance)
+	http.Handle("/dav/", NewDAVServer(store, authCheck))
+	us := NewUploadServer(store, authCheck, cfg.UploadTTL)
+	defer us.Close()
+	http.Handle("/upload/", us)
+	if len(cfg.S3Keys) != 0 {
+		s3 := NewS3Server(store, authCheck, cfg.S3Keys)
+		http.Handle("/s3", s3)
+		http.Handle("/s3/", s3)
+	}
+	calls := newInflight()
+	var gs *grpc.Server
+	if len(cfg.ListenGRPC) != 0 {
+		gs = grpc.NewServer(grpc.ChainUnaryInterceptor(calls.unary), grpc.ChainStreamInterceptor(calls.stream))
+		pb.RegisterFilerServiceServer(gs, NewGRPCServer(store, authCheck))
+		for _, l := range systemdutil.MustListenTCPSlice(cfg.ListenGRPC) {
+			go gs.Serve(l)
+		}
+	}
+	accessLog, err := newAccessLogger(cfg.AccessLog)
+	if err != nil {
+		log.Fatalf("can't open access log: %v", err)
+	}
+	shutdownTracing, err := setupTracing(context.Background(), cfg.TraceExporter)
+	if err != nil {
+		log.Fatalf("can't set up tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+	var handler http.Handler = withTracing(http.DefaultServeMux)
+	if len(cfg.RateLimits) != 0 || len(cfg.BandwidthLimits) != 0 {
+		handler = newRateLimiter(authCheck, cfg.RateLimits, cfg.BandwidthLimits).wrap(handler)
+	}
+	base, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+	srv := &http.Server{
+		Handler:           withAccessLog(calls.wrap(withRetryAfter(handler)), authCheck, accessLog),
+		BaseContext:       func(net.Listener) context.Context { return base },
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	// Long polls and event streams on the change feed end with it.
+	srv.RegisterOnShutdown(feed.Close)
+	for _, l := range httpSockets {
+		go func() {
+			if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+				log.Errorf("serving HTTP on %s: %v", l.Addr(), err)
+			}
+		}()
+	}
 	daemon.SdNotify(false, daemon.SdNotifyReady)
-	defer daemon.SdNotify(false, daemon.SdNotifyStopping)
+	if interval, err := daemon.SdWatchdogEnabled(false); err == nil && interval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go hs.watchdog(ctx, interval/2)
+	}
 	systemdutil.WaitSigint()
+
+	// Drain the servers, then let the deferred calls stop the background
+	// workers and the Store before closing Badger.
+	daemon.SdNotify(false, daemon.SdNotifyStopping)
+	log.Infof("shutting down, waiting up to %v for requests in flight", cfg.ShutdownTimeout)
+	shutdown(srv, cancelBase, gs, calls, cfg.ShutdownTimeout)
 }
@@ -11,11 +11,12 @@ import (
 )
 
 type metadataServer struct {
-	store *Store
+	store       *Store
+	authChecker AuthCheck
 }
 
-func NewMetadataServer(store *Store) *metadataServer {
-	return &metadataServer{store: store}
+func NewMetadataServer(store *Store, authChecker AuthCheck) *metadataServer {
+	return &metadataServer{store: store, authChecker: authChecker}
 }
 
 type problemManifest struct {
@@ -54,9 +55,12 @@ func (f *metadataServer) handleSetManifest(w http.ResponseWriter, r *http.Reques
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if err = f.store.SetManifest(r.Context(), revKey(mf.Id, mf.Revision), mb); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	ctx := WithPrecondition(auditContext(r, f.authChecker, ""), preconditionFromRequest(r))
+	if err = f.store.SetManifest(ctx, revKey(mf.Id, mf.Revision), mb); err != nil {
+		http.Error(w, err.Error(), storeErrorStatus(err))
+		return
 	}
+	w.Header().Set("ETag", blake3ETag(blake3Sum(mb)))
 }
 
 func revKey(id string, rev int) string {
@@ -148,5 +152,13 @@ func (f *metadataServer) handleGetManifest(w http.ResponseWriter, r *http.Reques
 		http.NotFound(w, r)
 		return
 	}
+	// A single revision carries the ETag its PUT returned, for If-Match.
+	// Manifests are stored as marshalled, so marshalling again gives the
+	// same bytes.
+	if pk.Revision != 0 && len(revs) == 1 {
+		if mb, err := json.Marshal(&revs[0]); err == nil {
+			w.Header().Set("ETag", blake3ETag(blake3Sum(mb)))
+		}
+	}
 	json.NewEncoder(w).Encode(revs)
 }
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/contester/advfiler/hashes"
+	pb "github.com/contester/advfiler/protos"
+)
+
+// Missing-entry policies of a multi-download.
+const (
+	missingSkip     = "skip"
+	missingFail     = "fail"
+	missingManifest = "manifest"
+)
+
+const defaultErrorManifest = "errors.json"
+
+// singleDownloadEntry asks for Source to be stored as Destination. A Source
+// ending in "/" takes every file under it, and one with glob characters
+// every file it matches; Destination is then the directory they go to,
+// keeping their paths below the Source's fixed leading directories.
+type singleDownloadEntry struct {
+	Source      string
+	Destination string
+}
+
+type multiDownloadRequest struct {
+	Entry []singleDownloadEntry
+	// Missing is what to do about sources that don't exist: skip them (the
+	// default), fail the request, or list them in the ErrorManifest member.
+	Missing       string
+	ErrorManifest string
+	// Summary, if set, names a JSON member listing every entry with its
+	// size and digests.
+	Summary string
+}
+
+// multiDownloadResult is an element of the summary and the error manifest.
+type multiDownloadResult struct {
+	Source  string            `json:"source"`
+	Name    string            `json:"name,omitempty"`
+	Size    int64             `json:"size"`
+	Digests map[string]string `json:"digests,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+type multiDownloadItem struct {
+	source, name string
+}
+
+func hasGlob(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// expandEntries resolves prefixes and globs. Those that match nothing are
+// returned as missing; plain sources are checked later, when read.
+func (f *filerServer) expandEntries(ctx context.Context, entries []singleDownloadEntry) (items []multiDownloadItem, missing []string, err error) {
+	for _, e := range entries {
+		var dir string
+		switch {
+		case hasGlob(e.Source):
+			if _, err := path.Match(e.Source, ""); err != nil {
+				return nil, nil, fmt.Errorf("%w: %q", err, e.Source)
+			}
+			dir = e.Source[:strings.LastIndex(e.Source[:strings.IndexAny(e.Source, "*?[")], "/")+1]
+		case strings.HasSuffix(e.Source, "/"):
+			dir = e.Source
+		default:
+			dest := e.Destination
+			if dest == "" {
+				dest = e.Source
+			}
+			items = append(items, multiDownloadItem{e.Source, dest})
+			continue
+		}
+		names, err := f.store.List(ctx, dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		var found bool
+		for _, name := range names {
+			if ok, _ := path.Match(e.Source, name); ok || !hasGlob(e.Source) {
+				items = append(items, multiDownloadItem{name, path.Join(e.Destination, strings.TrimPrefix(name, dir))})
+				found = true
+			}
+		}
+		if !found {
+			missing = append(missing, e.Source)
+		}
+	}
+	return items, missing, nil
+}
+
+// addGenerated adds a member made up by the server, such as the summary.
+func addGenerated(aw archiveWriter, name string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return aw.add(name, DownloadResult{
+		Size:                  int64(len(b)),
+		LastModifiedTimestamp: time.Now().Unix(),
+		Body:                  bytes.NewReader(b),
+	})
+}
+
+// handleMultiDownload serves POST /fs/ with a JSON multiDownloadRequest:
+// a tar if the client accepts application/x-tar, a zip otherwise. Members
+// are named <Destination>.<module type>.
+func (f *filerServer) handleMultiDownload(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if v, _ := f.authChecker.Check(ctx, tokenFromHeader(r), pb.AuthAction_A_READ, ""); !v {
+		return errUnauthorized
+	}
+	decoder := json.NewDecoder(r.Body)
+	var mdreq multiDownloadRequest
+	if err := decoder.Decode(&mdreq); err != nil {
+		return err
+	}
+	switch mdreq.Missing {
+	case "":
+		mdreq.Missing = missingSkip
+	case missingSkip, missingFail, missingManifest:
+	default:
+		http.Error(w, fmt.Sprintf("unknown missing-entry policy %q", mdreq.Missing), http.StatusBadRequest)
+		return nil
+	}
+	if mdreq.ErrorManifest == "" {
+		mdreq.ErrorManifest = defaultErrorManifest
+	}
+
+	items, missing, err := f.expandEntries(ctx, mdreq.Entry)
+	if err != nil {
+		return err
+	}
+	if mdreq.Missing == missingFail {
+		for _, it := range items {
+			if _, err := f.store.Stat(ctx, it.source); errors.Is(err, fs.ErrNotExist) {
+				missing = append(missing, it.source)
+			}
+		}
+		if len(missing) != 0 {
+			http.Error(w, "not found: "+strings.Join(missing, ", "), http.StatusNotFound)
+			return nil
+		}
+	}
+
+	var aw archiveWriter
+	w.Header().Set("Trailer", archiveErrorTrailer)
+	if strings.Contains(r.Header.Get("Accept"), "application/x-tar") {
+		w.Header().Set("Content-Type", "application/x-tar")
+		aw = &tarArchive{tw: tar.NewWriter(w)}
+	} else {
+		w.Header().Set("Content-Type", "application/zip")
+		aw = &zipArchive{zw: zip.NewWriter(w), method: zip.Deflate}
+	}
+
+	var results, failed []multiDownloadResult
+	for _, src := range missing {
+		failed = append(failed, multiDownloadResult{Source: src, Error: fs.ErrNotExist.Error()})
+	}
+	for _, it := range items {
+		res := multiDownloadResult{Source: it.source}
+		err := f.store.Download(ctx, it.source, func(dr DownloadResult) error {
+			res.Name = withTypeSuffix(it.name, dr.ModuleType)
+			res.Size = dr.Size
+			res.Digests = hashes.DigestsToMap(dr.Digests)
+			return aw.add(res.Name, dr)
+		})
+		switch {
+		case err == nil:
+			results = append(results, res)
+		case errors.Is(err, fs.ErrNotExist) && mdreq.Missing != missingFail:
+			res.Error = err.Error()
+			failed = append(failed, res)
+		default:
+			abortArchive(ctx, w, it.source, err)
+			return nil
+		}
+	}
+
+	if mdreq.Missing == missingManifest && len(failed) != 0 {
+		if err := addGenerated(aw, mdreq.ErrorManifest, failed); err != nil {
+			abortArchive(ctx, w, mdreq.ErrorManifest, err)
+			return nil
+		}
+	}
+	if mdreq.Summary != "" {
+		if err := addGenerated(aw, mdreq.Summary, append(results, failed...)); err != nil {
+			abortArchive(ctx, w, mdreq.Summary, err)
+			return nil
+		}
+	}
+	if err := aw.Close(); err != nil {
+		abortArchive(ctx, w, "", err)
+	}
+	return nil
+}
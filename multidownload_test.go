@@ -0,0 +1,118 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/contester/advfiler/client"
+	"github.com/dgraph-io/badger/v4"
+)
+
+func TestMultiDownload(t *testing.T) {
+	s, srv := newTestServer(t)
+	ctx := context.Background()
+	for _, name := range []string{"p/tests/1/input.txt", "p/tests/1/answer.txt", "p/tests/2/input.txt", "p/checker"} {
+		if _, err := s.Upload(ctx, FileInfo{Name: name}, strings.NewReader(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Upload(ctx, FileInfo{Name: "s/source", ModuleType: "cpp"}, strings.NewReader("int main() {}")); err != nil {
+		t.Fatal(err)
+	}
+	c := client.New(srv.URL, "tok")
+	entries := []client.MultiDownloadEntry{
+		{Source: "p/tests/*/input.txt", Destination: "in"},
+		{Source: "p/tests/", Destination: "all"},
+		{Source: "s/source", Destination: "solution"},
+		{Source: "s/missing", Destination: "gone"},
+		{Source: "q/*"},
+	}
+	readZip := func(rc io.ReadCloser) map[string]string {
+		t.Helper()
+		defer rc.Close()
+		b, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		z, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files := make(map[string]string)
+		for _, zf := range z.File {
+			r, _ := zf.Open()
+			content, _ := io.ReadAll(r)
+			files[zf.Name] = string(content)
+		}
+		return files
+	}
+
+	rc, err := c.MultiDownloadWith(ctx, entries, client.MultiDownloadOptions{Missing: "manifest", Summary: "summary.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := readZip(rc)
+	for _, name := range []string{"in/1/input.txt", "in/2/input.txt", "all/1/answer.txt", "all/2/input.txt", "solution.cpp", "errors.json", "summary.json"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("no %s among %d members", name, len(files))
+		}
+	}
+	if files["solution.cpp"] != "int main() {}" {
+		t.Errorf("solution: %q", files["solution.cpp"])
+	}
+	var failed, summary []multiDownloadResult
+	json.Unmarshal([]byte(files["errors.json"]), &failed)
+	if len(failed) != 2 || failed[0].Source != "q/*" || failed[1].Source != "s/missing" {
+		t.Errorf("error manifest: %+v", failed)
+	}
+	json.Unmarshal([]byte(files["summary.json"]), &summary)
+	if len(summary) != 8 || summary[0].Name != "in/1/input.txt" || summary[0].Size != int64(len("p/tests/1/input.txt")) ||
+		summary[0].Digests["BLAKE3"] == "" {
+		t.Errorf("summary: %+v", summary)
+	}
+
+	// Skipping is the default, as before.
+	rc, err = c.MultiDownload(ctx, entries[2:4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := readZip(rc); len(files) != 1 {
+		t.Errorf("skip: %v", files)
+	}
+
+	if _, err := c.MultiDownloadWith(ctx, entries, client.MultiDownloadOptions{Missing: "fail"}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("fail: %v", err)
+	}
+
+	rc, err = c.MultiDownloadWith(ctx, entries[2:3], client.MultiDownloadOptions{Tar: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := tar.NewReader(rc).Next()
+	rc.Close()
+	if err != nil || h.Name != "solution.cpp" {
+		t.Errorf("tar: %+v %v", h, err)
+	}
+
+	// Data lost on the server shows up as an error at the end of the archive.
+	if err := s.db.Update(func(tx *badger.Txn) error { return tx.Delete(dirDataKey("p/checker")) }); err != nil {
+		t.Fatal(err)
+	}
+	rc, err = c.MultiDownload(ctx, []client.MultiDownloadEntry{{Source: "p/checker"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(rc)
+	rc.Close()
+	if !errors.Is(err, client.ErrArchiveTruncated) {
+		t.Errorf("truncated archive: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	pb "github.com/contester/advfiler/protos"
+)
+
+// ErrPreconditionFailed is returned by mutating Store methods when the
+// request's Precondition doesn't hold for the current state.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// Precondition is the optimistic-concurrency part of a write: If-Match,
+// If-None-Match and If-Unmodified-Since. Store methods evaluate it inside
+// the write transaction, so the check and the write are atomic.
+type Precondition struct {
+	// IfMatch and IfNoneMatch hold entity tags (quoted hex blake3, as in
+	// ETag), bare blake3 hashes in hex or base64, or "*".
+	IfMatch, IfNoneMatch []string
+	// IfUnmodifiedSince is ignored when zero, when IfMatch is set, and for
+	// records without a timestamp.
+	IfUnmodifiedSince time.Time
+}
+
+type preconditionKey struct{}
+
+// WithPrecondition attaches p to ctx for the next Store write to check.
+func WithPrecondition(ctx context.Context, p *Precondition) context.Context {
+	if p == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, preconditionKey{}, p)
+}
+
+// splitTags splits a list-valued header, keeping quoted tags intact.
+func splitTags(h http.Header, name string) []string {
+	var tags []string
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tags = append(tags, t)
+			}
+		}
+	}
+	return tags
+}
+
+// preconditionFromRequest reads the conditional headers of a write request.
+// Returns nil if there are none.
+func preconditionFromRequest(r *http.Request) *Precondition {
+	p := Precondition{
+		IfMatch:     splitTags(r.Header, "If-Match"),
+		IfNoneMatch: splitTags(r.Header, "If-None-Match"),
+	}
+	if v := r.Header.Get("If-Unmodified-Since"); v != "" {
+		p.IfUnmodifiedSince, _ = http.ParseTime(v)
+	}
+	if len(p.IfMatch) == 0 && len(p.IfNoneMatch) == 0 && p.IfUnmodifiedSince.IsZero() {
+		return nil
+	}
+	return &p
+}
+
+// tagMatches compares a tag to a blake3 hash. Weak tags never match, as
+// If-Match requires strong comparison and every tag we issue is strong.
+func tagMatches(tag string, hash []byte) bool {
+	if strings.HasPrefix(tag, "W/") {
+		return false
+	}
+	tag = strings.Trim(tag, `"`)
+	if b, err := hex.DecodeString(tag); err == nil {
+		return bytes.Equal(b, hash)
+	}
+	if b, err := base64.StdEncoding.DecodeString(tag); err == nil {
+		return bytes.Equal(b, hash)
+	}
+	return false
+}
+
+func anyTagMatches(tags []string, exists bool, hash []byte) bool {
+	for _, t := range tags {
+		if t == "*" {
+			if exists {
+				return true
+			}
+			continue
+		}
+		if exists && tagMatches(t, hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// check evaluates p against the current record: whether it exists, the
+// blake3 of its content and its timestamp (unix seconds, 0 if it has none).
+func (p *Precondition) check(exists bool, hash []byte, ts int64) error {
+	if len(p.IfMatch) != 0 {
+		if !anyTagMatches(p.IfMatch, exists, hash) {
+			return ErrPreconditionFailed
+		}
+	} else if !p.IfUnmodifiedSince.IsZero() && exists && ts != 0 && ts > p.IfUnmodifiedSince.Unix() {
+		return ErrPreconditionFailed
+	}
+	if len(p.IfNoneMatch) != 0 && anyTagMatches(p.IfNoneMatch, exists, hash) {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// checkPrecondition checks the Precondition attached to ctx, if any.
+func checkPrecondition(ctx context.Context, exists bool, hash []byte, ts int64) error {
+	p, _ := ctx.Value(preconditionKey{}).(*Precondition)
+	if p == nil {
+		return nil
+	}
+	return p.check(exists, hash, ts)
+}
+
+// checkEntryPrecondition is checkPrecondition for a directory entry, which
+// is nil if the file doesn't exist.
+func checkEntryPrecondition(ctx context.Context, de *pb.DirectoryEntry) error {
+	if de == nil {
+		return checkPrecondition(ctx, false, nil, 0)
+	}
+	hash := de.GetBlake3Hash()
+	if len(hash) == 0 {
+		hash = emptyDigests.Blake3
+	}
+	return checkPrecondition(ctx, true, hash, de.GetLastModifiedTimestamp())
+}
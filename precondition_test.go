@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreconditionStore(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	with := func(p Precondition) context.Context { return WithPrecondition(ctx, &p) }
+	put := func(ctx context.Context, content string) error {
+		_, err := s.Upload(ctx, FileInfo{Name: "f", TimestampUnix: 1000}, strings.NewReader(content))
+		return err
+	}
+
+	if err := put(with(Precondition{IfMatch: []string{"*"}}), "v1"); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("If-Match: * on a missing file: %v", err)
+	}
+	if err := put(with(Precondition{IfNoneMatch: []string{"*"}}), "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := put(with(Precondition{IfNoneMatch: []string{"*"}}), "v2"); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("If-None-Match: * on an existing file: %v", err)
+	}
+
+	v1 := blake3Sum([]byte("v1"))
+	for _, tag := range []string{blake3ETag(v1), strings.Trim(blake3ETag(v1), `"`), base64.StdEncoding.EncodeToString(v1)} {
+		if err := checkPrecondition(with(Precondition{IfMatch: []string{`"00"`, tag}}), true, v1, 0); err != nil {
+			t.Errorf("If-Match %s: %v", tag, err)
+		}
+	}
+	if err := put(with(Precondition{IfMatch: []string{"W/" + blake3ETag(v1)}}), "v2"); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("weak If-Match: %v", err)
+	}
+	if err := put(with(Precondition{IfUnmodifiedSince: time.Unix(999, 0)}), "v2"); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("If-Unmodified-Since: %v", err)
+	}
+	if err := put(with(Precondition{IfMatch: []string{blake3ETag(v1)}}), "v2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Delete(with(Precondition{IfMatch: []string{blake3ETag(v1)}}), "f"); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("delete with a stale If-Match: %v", err)
+	}
+	if _, err := s.Stat(ctx, "f"); err != nil {
+		t.Fatalf("failed delete removed the file: %v", err)
+	}
+	if err := s.Delete(with(Precondition{IfMatch: []string{blake3ETag(blake3Sum([]byte("v2")))}}), "f"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(with(Precondition{IfMatch: []string{"*"}}), "f"); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("delete of a missing file with If-Match: %v", err)
+	}
+
+	if err := s.SetContest(with(Precondition{IfNoneMatch: []string{"*"}}), "c", []byte("a"), 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetContest(with(Precondition{IfUnmodifiedSince: time.Unix(50, 0)}), "c", []byte("b"), 0); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("contest If-Unmodified-Since: %v", err)
+	}
+	if err := s.SetProblem(with(Precondition{IfMatch: []string{"*"}}), "p", 1, []byte("a"), 0); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("problem If-Match: %v", err)
+	}
+	if err := s.SetManifest(with(Precondition{IfNoneMatch: []string{"*"}}), "m/1", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetManifest(with(Precondition{IfNoneMatch: []string{blake3ETag(blake3Sum([]byte("{}")))}}), "m/1", []byte("{}")); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("manifest If-None-Match: %v", err)
+	}
+}
+
+func TestPreconditionHTTP(t *testing.T) {
+	_, srv := newTestServer(t)
+
+	// Two setters start from the same version; the second one loses.
+	resp, _ := doRequest(t, authorized(t, http.MethodPut, srv.URL+"/fs/answer", strings.NewReader("v1")), "If-None-Match", "*")
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" {
+		t.Fatalf("create: %s %q", resp.Status, etag)
+	}
+	if resp, _ := doRequest(t, authorized(t, http.MethodPut, srv.URL+"/fs/answer", strings.NewReader("v2")), "If-Match", etag); resp.StatusCode != http.StatusOK {
+		t.Errorf("first update: %s", resp.Status)
+	}
+	if resp, _ := doRequest(t, authorized(t, http.MethodPut, srv.URL+"/fs/answer", strings.NewReader("v3")), "If-Match", etag); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("second update: %s", resp.Status)
+	}
+	if resp, _ := doRequest(t, authorized(t, http.MethodDelete, srv.URL+"/fs/answer", nil), "If-Unmodified-Since", time.Unix(0, 0).UTC().Format(http.TimeFormat)); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("delete: %s", resp.Status)
+	}
+
+	resp, _ = doRequest(t, authorized(t, http.MethodPut, srv.URL+"/xml/contest/?key=c", strings.NewReader("<a/>")), "If-None-Match", "*")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != blake3ETag(blake3Sum([]byte("<a/>"))) {
+		t.Errorf("xml create: %s %v", resp.Status, resp.Header)
+	}
+	if resp, _ := doRequest(t, authorized(t, http.MethodPut, srv.URL+"/xml/contest/?key=c", strings.NewReader("<b/>")), "If-None-Match", "*"); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("xml overwrite: %s", resp.Status)
+	}
+	if resp, _ := doRequest(t, authorized(t, http.MethodPut, srv.URL+"/problem/set/", strings.NewReader(`{"id":"p","revision":1}`)), "If-Match", "*"); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("manifest: %s", resp.Status)
+	}
+	resp, _ = doRequest(t, authorized(t, http.MethodPut, srv.URL+"/problem/set/", strings.NewReader(`{"id":"p","revision":1,"testCount":3}`)), "If-None-Match", "*")
+	etag = resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" {
+		t.Fatalf("manifest create: %s %q", resp.Status, etag)
+	}
+	if resp, _ := doRequest(t, authorized(t, http.MethodGet, srv.URL+"/problem/get/?id=p&revision=1", nil)); resp.Header.Get("ETag") != etag {
+		t.Errorf("manifest GET ETag %q, PUT returned %q", resp.Header.Get("ETag"), etag)
+	}
+	if resp, _ := doRequest(t, authorized(t, http.MethodPut, srv.URL+"/problem/set/", strings.NewReader(`{"id":"p","revision":1,"testCount":4}`)), "If-Match", etag); resp.StatusCode != http.StatusOK {
+		t.Errorf("manifest update with the GET ETag: %s", resp.Status)
+	}
+}
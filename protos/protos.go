@@ -1,3 +1,3 @@
 package protos
 
-//go:generate protoc --go_out=. --go_opt=paths=source_relative protos.proto
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative protos.proto
@@ -27,6 +27,7 @@ const (
 	AuthAction_A_NONE  AuthAction = 0
 	AuthAction_A_READ  AuthAction = 1
 	AuthAction_A_WRITE AuthAction = 2
+	AuthAction_A_ADMIN AuthAction = 3
 )
 
 // Enum value maps for AuthAction.
@@ -35,11 +36,13 @@ var (
 		0: "A_NONE",
 		1: "A_READ",
 		2: "A_WRITE",
+		3: "A_ADMIN",
 	}
 	AuthAction_value = map[string]int32{
 		"A_NONE":  0,
 		"A_READ":  1,
 		"A_WRITE": 2,
+		"A_ADMIN": 3,
 	}
 )
 
@@ -561,6 +564,7 @@ type DirectoryEntry struct {
 	xxx_hidden_ModuleType            *string                `protobuf:"bytes,2,opt,name=module_type,json=moduleType"`
 	xxx_hidden_LastModifiedTimestamp int64                  `protobuf:"varint,3,opt,name=last_modified_timestamp,json=lastModifiedTimestamp"`
 	xxx_hidden_DigestsAndSize        *DigestsAndSize        `protobuf:"bytes,4,opt,name=digests_and_size,json=digestsAndSize"`
+	xxx_hidden_Attributes            map[string]string      `protobuf:"bytes,5,rep,name=attributes" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 	XXX_raceDetectHookData           protoimpl.RaceDetectHookData
 	XXX_presence                     [1]uint32
 	unknownFields                    protoimpl.UnknownFields
@@ -623,28 +627,39 @@ func (x *DirectoryEntry) GetDigestsAndSize() *DigestsAndSize {
 	return nil
 }
 
+func (x *DirectoryEntry) GetAttributes() map[string]string {
+	if x != nil {
+		return x.xxx_hidden_Attributes
+	}
+	return nil
+}
+
 func (x *DirectoryEntry) SetBlake3Hash(v []byte) {
 	if v == nil {
 		v = []byte{}
 	}
 	x.xxx_hidden_Blake3Hash = v
-	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 0, 4)
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 0, 5)
 }
 
 func (x *DirectoryEntry) SetModuleType(v string) {
 	x.xxx_hidden_ModuleType = &v
-	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 1, 4)
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 1, 5)
 }
 
 func (x *DirectoryEntry) SetLastModifiedTimestamp(v int64) {
 	x.xxx_hidden_LastModifiedTimestamp = v
-	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 2, 4)
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 2, 5)
 }
 
 func (x *DirectoryEntry) SetDigestsAndSize(v *DigestsAndSize) {
 	x.xxx_hidden_DigestsAndSize = v
 }
 
+func (x *DirectoryEntry) SetAttributes(v map[string]string) {
+	x.xxx_hidden_Attributes = v
+}
+
 func (x *DirectoryEntry) HasBlake3Hash() bool {
 	if x == nil {
 		return false
@@ -702,6 +717,8 @@ type DirectoryEntry_builder struct {
 	// (the data lives in a blob and DigestsAndSize is under blobDigestsKey) and
 	// for zero-size entries (no blob, digests synthesized on read).
 	DigestsAndSize *DigestsAndSize
+	// User-defined attributes (X-Fs-Meta-* on the HTTP API), keys lowercase.
+	Attributes map[string]string
 }
 
 func (b0 DirectoryEntry_builder) Build() *DirectoryEntry {
@@ -709,18 +726,326 @@ func (b0 DirectoryEntry_builder) Build() *DirectoryEntry {
 	b, x := &b0, m0
 	_, _ = b, x
 	if b.Blake3Hash != nil {
-		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 0, 4)
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 0, 5)
 		x.xxx_hidden_Blake3Hash = b.Blake3Hash
 	}
 	if b.ModuleType != nil {
-		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 1, 4)
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 1, 5)
 		x.xxx_hidden_ModuleType = b.ModuleType
 	}
 	if b.LastModifiedTimestamp != nil {
-		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 2, 4)
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 2, 5)
 		x.xxx_hidden_LastModifiedTimestamp = *b.LastModifiedTimestamp
 	}
 	x.xxx_hidden_DigestsAndSize = b.DigestsAndSize
+	x.xxx_hidden_Attributes = b.Attributes
+	return m0
+}
+
+// One mutating operation. Stored under 0x07 + be64(timestamp) + be32(seq).
+type AuditRecord struct {
+	state                        protoimpl.MessageState `protogen:"opaque.v1"`
+	xxx_hidden_TimestampUnixNano int64                  `protobuf:"varint,1,opt,name=timestamp_unix_nano,json=timestampUnixNano"`
+	xxx_hidden_Identity          *string                `protobuf:"bytes,2,opt,name=identity"`
+	xxx_hidden_Action            *string                `protobuf:"bytes,3,opt,name=action"`
+	xxx_hidden_Path              *string                `protobuf:"bytes,4,opt,name=path"`
+	xxx_hidden_OldBlake3         []byte                 `protobuf:"bytes,5,opt,name=old_blake3,json=oldBlake3"`
+	xxx_hidden_NewBlake3         []byte                 `protobuf:"bytes,6,opt,name=new_blake3,json=newBlake3"`
+	xxx_hidden_RemoteAddr        *string                `protobuf:"bytes,7,opt,name=remote_addr,json=remoteAddr"`
+	xxx_hidden_RequestId         *string                `protobuf:"bytes,8,opt,name=request_id,json=requestId"`
+	XXX_raceDetectHookData       protoimpl.RaceDetectHookData
+	XXX_presence                 [1]uint32
+	unknownFields                protoimpl.UnknownFields
+	sizeCache                    protoimpl.SizeCache
+}
+
+func (x *AuditRecord) Reset() {
+	*x = AuditRecord{}
+	mi := &file_protos_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuditRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuditRecord) ProtoMessage() {}
+
+func (x *AuditRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (x *AuditRecord) GetTimestampUnixNano() int64 {
+	if x != nil {
+		return x.xxx_hidden_TimestampUnixNano
+	}
+	return 0
+}
+
+func (x *AuditRecord) GetIdentity() string {
+	if x != nil {
+		if x.xxx_hidden_Identity != nil {
+			return *x.xxx_hidden_Identity
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *AuditRecord) GetAction() string {
+	if x != nil {
+		if x.xxx_hidden_Action != nil {
+			return *x.xxx_hidden_Action
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *AuditRecord) GetPath() string {
+	if x != nil {
+		if x.xxx_hidden_Path != nil {
+			return *x.xxx_hidden_Path
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *AuditRecord) GetOldBlake3() []byte {
+	if x != nil {
+		return x.xxx_hidden_OldBlake3
+	}
+	return nil
+}
+
+func (x *AuditRecord) GetNewBlake3() []byte {
+	if x != nil {
+		return x.xxx_hidden_NewBlake3
+	}
+	return nil
+}
+
+func (x *AuditRecord) GetRemoteAddr() string {
+	if x != nil {
+		if x.xxx_hidden_RemoteAddr != nil {
+			return *x.xxx_hidden_RemoteAddr
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *AuditRecord) GetRequestId() string {
+	if x != nil {
+		if x.xxx_hidden_RequestId != nil {
+			return *x.xxx_hidden_RequestId
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *AuditRecord) SetTimestampUnixNano(v int64) {
+	x.xxx_hidden_TimestampUnixNano = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 0, 8)
+}
+
+func (x *AuditRecord) SetIdentity(v string) {
+	x.xxx_hidden_Identity = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 1, 8)
+}
+
+func (x *AuditRecord) SetAction(v string) {
+	x.xxx_hidden_Action = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 2, 8)
+}
+
+func (x *AuditRecord) SetPath(v string) {
+	x.xxx_hidden_Path = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 3, 8)
+}
+
+func (x *AuditRecord) SetOldBlake3(v []byte) {
+	if v == nil {
+		v = []byte{}
+	}
+	x.xxx_hidden_OldBlake3 = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 4, 8)
+}
+
+func (x *AuditRecord) SetNewBlake3(v []byte) {
+	if v == nil {
+		v = []byte{}
+	}
+	x.xxx_hidden_NewBlake3 = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 5, 8)
+}
+
+func (x *AuditRecord) SetRemoteAddr(v string) {
+	x.xxx_hidden_RemoteAddr = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 6, 8)
+}
+
+func (x *AuditRecord) SetRequestId(v string) {
+	x.xxx_hidden_RequestId = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 7, 8)
+}
+
+func (x *AuditRecord) HasTimestampUnixNano() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 0)
+}
+
+func (x *AuditRecord) HasIdentity() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 1)
+}
+
+func (x *AuditRecord) HasAction() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 2)
+}
+
+func (x *AuditRecord) HasPath() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 3)
+}
+
+func (x *AuditRecord) HasOldBlake3() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 4)
+}
+
+func (x *AuditRecord) HasNewBlake3() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 5)
+}
+
+func (x *AuditRecord) HasRemoteAddr() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 6)
+}
+
+func (x *AuditRecord) HasRequestId() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 7)
+}
+
+func (x *AuditRecord) ClearTimestampUnixNano() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 0)
+	x.xxx_hidden_TimestampUnixNano = 0
+}
+
+func (x *AuditRecord) ClearIdentity() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 1)
+	x.xxx_hidden_Identity = nil
+}
+
+func (x *AuditRecord) ClearAction() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 2)
+	x.xxx_hidden_Action = nil
+}
+
+func (x *AuditRecord) ClearPath() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 3)
+	x.xxx_hidden_Path = nil
+}
+
+func (x *AuditRecord) ClearOldBlake3() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 4)
+	x.xxx_hidden_OldBlake3 = nil
+}
+
+func (x *AuditRecord) ClearNewBlake3() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 5)
+	x.xxx_hidden_NewBlake3 = nil
+}
+
+func (x *AuditRecord) ClearRemoteAddr() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 6)
+	x.xxx_hidden_RemoteAddr = nil
+}
+
+func (x *AuditRecord) ClearRequestId() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 7)
+	x.xxx_hidden_RequestId = nil
+}
+
+type AuditRecord_builder struct {
+	_ [0]func() // Prevents comparability and use of unkeyed literals for the builder.
+
+	TimestampUnixNano *int64
+	Identity          *string
+	Action            *string
+	Path              *string
+	OldBlake3         []byte
+	NewBlake3         []byte
+	RemoteAddr        *string
+	RequestId         *string
+}
+
+func (b0 AuditRecord_builder) Build() *AuditRecord {
+	m0 := &AuditRecord{}
+	b, x := &b0, m0
+	_, _ = b, x
+	if b.TimestampUnixNano != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 0, 8)
+		x.xxx_hidden_TimestampUnixNano = *b.TimestampUnixNano
+	}
+	if b.Identity != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 1, 8)
+		x.xxx_hidden_Identity = b.Identity
+	}
+	if b.Action != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 2, 8)
+		x.xxx_hidden_Action = b.Action
+	}
+	if b.Path != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 3, 8)
+		x.xxx_hidden_Path = b.Path
+	}
+	if b.OldBlake3 != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 4, 8)
+		x.xxx_hidden_OldBlake3 = b.OldBlake3
+	}
+	if b.NewBlake3 != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 5, 8)
+		x.xxx_hidden_NewBlake3 = b.NewBlake3
+	}
+	if b.RemoteAddr != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 6, 8)
+		x.xxx_hidden_RemoteAddr = b.RemoteAddr
+	}
+	if b.RequestId != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 7, 8)
+		x.xxx_hidden_RequestId = b.RequestId
+	}
 	return m0
 }
 
@@ -733,7 +1058,7 @@ type PathList struct {
 
 func (x *PathList) Reset() {
 	*x = PathList{}
-	mi := &file_protos_proto_msgTypes[5]
+	mi := &file_protos_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -745,7 +1070,7 @@ func (x *PathList) String() string {
 func (*PathList) ProtoMessage() {}
 
 func (x *PathList) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_proto_msgTypes[5]
+	mi := &file_protos_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -790,7 +1115,7 @@ type HashEntry struct {
 
 func (x *HashEntry) Reset() {
 	*x = HashEntry{}
-	mi := &file_protos_proto_msgTypes[6]
+	mi := &file_protos_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -802,7 +1127,7 @@ func (x *HashEntry) String() string {
 func (*HashEntry) ProtoMessage() {}
 
 func (x *HashEntry) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_proto_msgTypes[6]
+	mi := &file_protos_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -925,7 +1250,7 @@ func (b0 HashEntry_builder) Build() *HashEntry {
 type case_HashEntry_State protoreflect.FieldNumber
 
 func (x case_HashEntry_State) String() string {
-	md := file_protos_proto_msgTypes[6].Descriptor()
+	md := file_protos_proto_msgTypes[7].Descriptor()
 	if x == 0 {
 		return "not set"
 	}
@@ -948,33 +1273,36 @@ func (*hashEntry_InlinePaths) isHashEntry_State() {}
 
 func (*hashEntry_Refcount) isHashEntry_State() {}
 
-type Asset struct {
-	state                   protoimpl.MessageState `protogen:"opaque.v1"`
-	xxx_hidden_Name         *string                `protobuf:"bytes,1,opt,name=name"`
-	xxx_hidden_Truncated    bool                   `protobuf:"varint,2,opt,name=truncated"`
-	xxx_hidden_Data         []byte                 `protobuf:"bytes,3,opt,name=data"`
-	xxx_hidden_OriginalSize int64                  `protobuf:"varint,4,opt,name=original_size,json=originalSize"`
-	XXX_raceDetectHookData  protoimpl.RaceDetectHookData
-	XXX_presence            [1]uint32
-	unknownFields           protoimpl.UnknownFields
-	sizeCache               protoimpl.SizeCache
+// A resumable upload in progress. Stored under 0x09 + id + 0x00; the data
+// received so far is under 0x09 + id + 0x01 + be64(offset), one key per chunk.
+type UploadSession struct {
+	state                  protoimpl.MessageState `protogen:"opaque.v1"`
+	xxx_hidden_Owner       *string                `protobuf:"bytes,1,opt,name=owner"`
+	xxx_hidden_Length      int64                  `protobuf:"varint,2,opt,name=length"`
+	xxx_hidden_Offset      int64                  `protobuf:"varint,3,opt,name=offset"`
+	xxx_hidden_CreatedUnix int64                  `protobuf:"varint,4,opt,name=created_unix,json=createdUnix"`
+	xxx_hidden_ExpiresUnix int64                  `protobuf:"varint,5,opt,name=expires_unix,json=expiresUnix"`
+	XXX_raceDetectHookData protoimpl.RaceDetectHookData
+	XXX_presence           [1]uint32
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
 }
 
-func (x *Asset) Reset() {
-	*x = Asset{}
-	mi := &file_protos_proto_msgTypes[7]
+func (x *UploadSession) Reset() {
+	*x = UploadSession{}
+	mi := &file_protos_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Asset) String() string {
+func (x *UploadSession) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Asset) ProtoMessage() {}
+func (*UploadSession) ProtoMessage() {}
 
-func (x *Asset) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_proto_msgTypes[7]
+func (x *UploadSession) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -985,64 +1313,263 @@ func (x *Asset) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-func (x *Asset) GetName() string {
+func (x *UploadSession) GetOwner() string {
 	if x != nil {
-		if x.xxx_hidden_Name != nil {
-			return *x.xxx_hidden_Name
+		if x.xxx_hidden_Owner != nil {
+			return *x.xxx_hidden_Owner
 		}
 		return ""
 	}
 	return ""
 }
 
-func (x *Asset) GetTruncated() bool {
+func (x *UploadSession) GetLength() int64 {
 	if x != nil {
-		return x.xxx_hidden_Truncated
+		return x.xxx_hidden_Length
 	}
-	return false
+	return 0
 }
 
-func (x *Asset) GetData() []byte {
+func (x *UploadSession) GetOffset() int64 {
 	if x != nil {
-		return x.xxx_hidden_Data
+		return x.xxx_hidden_Offset
 	}
-	return nil
+	return 0
 }
 
-func (x *Asset) GetOriginalSize() int64 {
+func (x *UploadSession) GetCreatedUnix() int64 {
 	if x != nil {
-		return x.xxx_hidden_OriginalSize
+		return x.xxx_hidden_CreatedUnix
 	}
 	return 0
 }
 
-func (x *Asset) SetName(v string) {
-	x.xxx_hidden_Name = &v
-	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 0, 4)
+func (x *UploadSession) GetExpiresUnix() int64 {
+	if x != nil {
+		return x.xxx_hidden_ExpiresUnix
+	}
+	return 0
 }
 
-func (x *Asset) SetTruncated(v bool) {
-	x.xxx_hidden_Truncated = v
-	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 1, 4)
+func (x *UploadSession) SetOwner(v string) {
+	x.xxx_hidden_Owner = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 0, 5)
 }
 
-func (x *Asset) SetData(v []byte) {
-	if v == nil {
-		v = []byte{}
-	}
-	x.xxx_hidden_Data = v
-	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 2, 4)
+func (x *UploadSession) SetLength(v int64) {
+	x.xxx_hidden_Length = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 1, 5)
 }
 
-func (x *Asset) SetOriginalSize(v int64) {
-	x.xxx_hidden_OriginalSize = v
-	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 3, 4)
+func (x *UploadSession) SetOffset(v int64) {
+	x.xxx_hidden_Offset = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 2, 5)
 }
 
-func (x *Asset) HasName() bool {
-	if x == nil {
-		return false
-	}
+func (x *UploadSession) SetCreatedUnix(v int64) {
+	x.xxx_hidden_CreatedUnix = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 3, 5)
+}
+
+func (x *UploadSession) SetExpiresUnix(v int64) {
+	x.xxx_hidden_ExpiresUnix = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 4, 5)
+}
+
+func (x *UploadSession) HasOwner() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 0)
+}
+
+func (x *UploadSession) HasLength() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 1)
+}
+
+func (x *UploadSession) HasOffset() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 2)
+}
+
+func (x *UploadSession) HasCreatedUnix() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 3)
+}
+
+func (x *UploadSession) HasExpiresUnix() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 4)
+}
+
+func (x *UploadSession) ClearOwner() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 0)
+	x.xxx_hidden_Owner = nil
+}
+
+func (x *UploadSession) ClearLength() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 1)
+	x.xxx_hidden_Length = 0
+}
+
+func (x *UploadSession) ClearOffset() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 2)
+	x.xxx_hidden_Offset = 0
+}
+
+func (x *UploadSession) ClearCreatedUnix() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 3)
+	x.xxx_hidden_CreatedUnix = 0
+}
+
+func (x *UploadSession) ClearExpiresUnix() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 4)
+	x.xxx_hidden_ExpiresUnix = 0
+}
+
+type UploadSession_builder struct {
+	_ [0]func() // Prevents comparability and use of unkeyed literals for the builder.
+
+	// owner is the identity of the token that created the session.
+	Owner *string
+	// length is the announced total size; absent if not known yet.
+	Length      *int64
+	Offset      *int64
+	CreatedUnix *int64
+	ExpiresUnix *int64
+}
+
+func (b0 UploadSession_builder) Build() *UploadSession {
+	m0 := &UploadSession{}
+	b, x := &b0, m0
+	_, _ = b, x
+	if b.Owner != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 0, 5)
+		x.xxx_hidden_Owner = b.Owner
+	}
+	if b.Length != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 1, 5)
+		x.xxx_hidden_Length = *b.Length
+	}
+	if b.Offset != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 2, 5)
+		x.xxx_hidden_Offset = *b.Offset
+	}
+	if b.CreatedUnix != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 3, 5)
+		x.xxx_hidden_CreatedUnix = *b.CreatedUnix
+	}
+	if b.ExpiresUnix != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 4, 5)
+		x.xxx_hidden_ExpiresUnix = *b.ExpiresUnix
+	}
+	return m0
+}
+
+type Asset struct {
+	state                   protoimpl.MessageState `protogen:"opaque.v1"`
+	xxx_hidden_Name         *string                `protobuf:"bytes,1,opt,name=name"`
+	xxx_hidden_Truncated    bool                   `protobuf:"varint,2,opt,name=truncated"`
+	xxx_hidden_Data         []byte                 `protobuf:"bytes,3,opt,name=data"`
+	xxx_hidden_OriginalSize int64                  `protobuf:"varint,4,opt,name=original_size,json=originalSize"`
+	XXX_raceDetectHookData  protoimpl.RaceDetectHookData
+	XXX_presence            [1]uint32
+	unknownFields           protoimpl.UnknownFields
+	sizeCache               protoimpl.SizeCache
+}
+
+func (x *Asset) Reset() {
+	*x = Asset{}
+	mi := &file_protos_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Asset) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Asset) ProtoMessage() {}
+
+func (x *Asset) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (x *Asset) GetName() string {
+	if x != nil {
+		if x.xxx_hidden_Name != nil {
+			return *x.xxx_hidden_Name
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *Asset) GetTruncated() bool {
+	if x != nil {
+		return x.xxx_hidden_Truncated
+	}
+	return false
+}
+
+func (x *Asset) GetData() []byte {
+	if x != nil {
+		return x.xxx_hidden_Data
+	}
+	return nil
+}
+
+func (x *Asset) GetOriginalSize() int64 {
+	if x != nil {
+		return x.xxx_hidden_OriginalSize
+	}
+	return 0
+}
+
+func (x *Asset) SetName(v string) {
+	x.xxx_hidden_Name = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 0, 4)
+}
+
+func (x *Asset) SetTruncated(v bool) {
+	x.xxx_hidden_Truncated = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 1, 4)
+}
+
+func (x *Asset) SetData(v []byte) {
+	if v == nil {
+		v = []byte{}
+	}
+	x.xxx_hidden_Data = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 2, 4)
+}
+
+func (x *Asset) SetOriginalSize(v int64) {
+	x.xxx_hidden_OriginalSize = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 3, 4)
+}
+
+func (x *Asset) HasName() bool {
+	if x == nil {
+		return false
+	}
 	return protoimpl.X.Present(&(x.XXX_presence[0]), 0)
 }
 
@@ -1134,7 +1661,7 @@ type TestRecord struct {
 
 func (x *TestRecord) Reset() {
 	*x = TestRecord{}
-	mi := &file_protos_proto_msgTypes[8]
+	mi := &file_protos_proto_msgTypes[10]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1146,7 +1673,7 @@ func (x *TestRecord) String() string {
 func (*TestRecord) ProtoMessage() {}
 
 func (x *TestRecord) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_proto_msgTypes[8]
+	mi := &file_protos_proto_msgTypes[10]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1304,7 +1831,7 @@ type TestingRecord struct {
 
 func (x *TestingRecord) Reset() {
 	*x = TestingRecord{}
-	mi := &file_protos_proto_msgTypes[9]
+	mi := &file_protos_proto_msgTypes[11]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1316,7 +1843,7 @@ func (x *TestingRecord) String() string {
 func (*TestingRecord) ProtoMessage() {}
 
 func (x *TestingRecord) ProtoReflect() protoreflect.Message {
-	mi := &file_protos_proto_msgTypes[9]
+	mi := &file_protos_proto_msgTypes[11]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1378,91 +1905,1690 @@ func (b0 TestingRecord_builder) Build() *TestingRecord {
 	return m0
 }
 
-var File_protos_proto protoreflect.FileDescriptor
+type FileStat struct {
+	state                            protoimpl.MessageState `protogen:"opaque.v1"`
+	xxx_hidden_Path                  *string                `protobuf:"bytes,1,opt,name=path"`
+	xxx_hidden_Size                  int64                  `protobuf:"varint,2,opt,name=size"`
+	xxx_hidden_ModuleType            *string                `protobuf:"bytes,3,opt,name=module_type,json=moduleType"`
+	xxx_hidden_LastModifiedTimestamp int64                  `protobuf:"varint,4,opt,name=last_modified_timestamp,json=lastModifiedTimestamp"`
+	xxx_hidden_Digests               *Digests               `protobuf:"bytes,5,opt,name=digests"`
+	xxx_hidden_Blake3                []byte                 `protobuf:"bytes,6,opt,name=blake3"`
+	xxx_hidden_Attributes            map[string]string      `protobuf:"bytes,7,rep,name=attributes" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	XXX_raceDetectHookData           protoimpl.RaceDetectHookData
+	XXX_presence                     [1]uint32
+	unknownFields                    protoimpl.UnknownFields
+	sizeCache                        protoimpl.SizeCache
+}
 
-const file_protos_proto_rawDesc = "" +
-	"\n" +
-	"\fprotos.proto\x12\x06protos\x1a!google/protobuf/go_features.proto\"G\n" +
-	"\aDigests\x12\x12\n" +
-	"\x04sha1\x18\x01 \x01(\fR\x04sha1\x12\x10\n" +
-	"\x03md5\x18\x02 \x01(\fR\x03md5\x12\x16\n" +
-	"\x06sha256\x18\x03 \x01(\fR\x06sha256\"O\n" +
-	"\x0eDigestsAndSize\x12)\n" +
-	"\adigests\x18\x01 \x01(\v2\x0f.protos.DigestsR\adigests\x12\x12\n" +
-	"\x04size\x18\x02 \x01(\x03R\x04size\"P\n" +
-	"\rContestRecord\x12\x18\n" +
-	"\acontent\x18\x01 \x01(\fR\acontent\x12%\n" +
-	"\x0etimestamp_unix\x18\x02 \x01(\x03R\rtimestampUnix\"l\n" +
-	"\rProblemRecord\x12\x18\n" +
-	"\acontent\x18\x01 \x01(\fR\acontent\x12%\n" +
-	"\x0etimestamp_unix\x18\x02 \x01(\x03R\rtimestampUnix\x12\x1a\n" +
-	"\brevision\x18\x03 \x01(\x03R\brevision\"\xcc\x01\n" +
-	"\x0eDirectoryEntry\x12\x1f\n" +
-	"\vblake3_hash\x18\x01 \x01(\fR\n" +
-	"blake3Hash\x12\x1f\n" +
-	"\vmodule_type\x18\x02 \x01(\tR\n" +
-	"moduleType\x126\n" +
-	"\x17last_modified_timestamp\x18\x03 \x01(\x03R\x15lastModifiedTimestamp\x12@\n" +
-	"\x10digests_and_size\x18\x04 \x01(\v2\x16.protos.DigestsAndSizeR\x0edigestsAndSize\" \n" +
-	"\bPathList\x12\x14\n" +
-	"\x05paths\x18\x01 \x03(\tR\x05paths\"i\n" +
-	"\tHashEntry\x125\n" +
-	"\finline_paths\x18\x01 \x01(\v2\x10.protos.PathListH\x00R\vinlinePaths\x12\x1c\n" +
-	"\brefcount\x18\x02 \x01(\x03H\x00R\brefcountB\a\n" +
-	"\x05state\"r\n" +
-	"\x05Asset\x12\x12\n" +
-	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1c\n" +
-	"\ttruncated\x18\x02 \x01(\bR\ttruncated\x12\x12\n" +
-	"\x04data\x18\x03 \x01(\fR\x04data\x12#\n" +
-	"\roriginal_size\x18\x04 \x01(\x03R\foriginalSize\"\xcc\x01\n" +
-	"\n" +
-	"TestRecord\x12\x17\n" +
-	"\atest_id\x18\x01 \x01(\x03R\x06testId\x12#\n" +
-	"\x05input\x18\x02 \x01(\v2\r.protos.AssetR\x05input\x12%\n" +
-	"\x06output\x18\x03 \x01(\v2\r.protos.AssetR\x06output\x12%\n" +
-	"\x06answer\x18\x04 \x01(\v2\r.protos.AssetR\x06answer\x122\n" +
-	"\rtester_output\x18\x05 \x01(\v2\r.protos.AssetR\ftesterOutput\"b\n" +
-	"\rTestingRecord\x12)\n" +
-	"\bsolution\x18\x01 \x01(\v2\r.protos.AssetR\bsolution\x12&\n" +
-	"\x04test\x18\x02 \x03(\v2\x12.protos.TestRecordR\x04test*1\n" +
+func (x *FileStat) Reset() {
+	*x = FileStat{}
+	mi := &file_protos_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileStat) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileStat) ProtoMessage() {}
+
+func (x *FileStat) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (x *FileStat) GetPath() string {
+	if x != nil {
+		if x.xxx_hidden_Path != nil {
+			return *x.xxx_hidden_Path
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *FileStat) GetSize() int64 {
+	if x != nil {
+		return x.xxx_hidden_Size
+	}
+	return 0
+}
+
+func (x *FileStat) GetModuleType() string {
+	if x != nil {
+		if x.xxx_hidden_ModuleType != nil {
+			return *x.xxx_hidden_ModuleType
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *FileStat) GetLastModifiedTimestamp() int64 {
+	if x != nil {
+		return x.xxx_hidden_LastModifiedTimestamp
+	}
+	return 0
+}
+
+func (x *FileStat) GetDigests() *Digests {
+	if x != nil {
+		return x.xxx_hidden_Digests
+	}
+	return nil
+}
+
+func (x *FileStat) GetBlake3() []byte {
+	if x != nil {
+		return x.xxx_hidden_Blake3
+	}
+	return nil
+}
+
+func (x *FileStat) GetAttributes() map[string]string {
+	if x != nil {
+		return x.xxx_hidden_Attributes
+	}
+	return nil
+}
+
+func (x *FileStat) SetPath(v string) {
+	x.xxx_hidden_Path = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 0, 7)
+}
+
+func (x *FileStat) SetSize(v int64) {
+	x.xxx_hidden_Size = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 1, 7)
+}
+
+func (x *FileStat) SetModuleType(v string) {
+	x.xxx_hidden_ModuleType = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 2, 7)
+}
+
+func (x *FileStat) SetLastModifiedTimestamp(v int64) {
+	x.xxx_hidden_LastModifiedTimestamp = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 3, 7)
+}
+
+func (x *FileStat) SetDigests(v *Digests) {
+	x.xxx_hidden_Digests = v
+}
+
+func (x *FileStat) SetBlake3(v []byte) {
+	if v == nil {
+		v = []byte{}
+	}
+	x.xxx_hidden_Blake3 = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 5, 7)
+}
+
+func (x *FileStat) SetAttributes(v map[string]string) {
+	x.xxx_hidden_Attributes = v
+}
+
+func (x *FileStat) HasPath() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 0)
+}
+
+func (x *FileStat) HasSize() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 1)
+}
+
+func (x *FileStat) HasModuleType() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 2)
+}
+
+func (x *FileStat) HasLastModifiedTimestamp() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 3)
+}
+
+func (x *FileStat) HasDigests() bool {
+	if x == nil {
+		return false
+	}
+	return x.xxx_hidden_Digests != nil
+}
+
+func (x *FileStat) HasBlake3() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 5)
+}
+
+func (x *FileStat) ClearPath() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 0)
+	x.xxx_hidden_Path = nil
+}
+
+func (x *FileStat) ClearSize() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 1)
+	x.xxx_hidden_Size = 0
+}
+
+func (x *FileStat) ClearModuleType() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 2)
+	x.xxx_hidden_ModuleType = nil
+}
+
+func (x *FileStat) ClearLastModifiedTimestamp() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 3)
+	x.xxx_hidden_LastModifiedTimestamp = 0
+}
+
+func (x *FileStat) ClearDigests() {
+	x.xxx_hidden_Digests = nil
+}
+
+func (x *FileStat) ClearBlake3() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 5)
+	x.xxx_hidden_Blake3 = nil
+}
+
+type FileStat_builder struct {
+	_ [0]func() // Prevents comparability and use of unkeyed literals for the builder.
+
+	Path                  *string
+	Size                  *int64
+	ModuleType            *string
+	LastModifiedTimestamp *int64
+	Digests               *Digests
+	Blake3                []byte
+	Attributes            map[string]string
+}
+
+func (b0 FileStat_builder) Build() *FileStat {
+	m0 := &FileStat{}
+	b, x := &b0, m0
+	_, _ = b, x
+	if b.Path != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 0, 7)
+		x.xxx_hidden_Path = b.Path
+	}
+	if b.Size != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 1, 7)
+		x.xxx_hidden_Size = *b.Size
+	}
+	if b.ModuleType != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 2, 7)
+		x.xxx_hidden_ModuleType = b.ModuleType
+	}
+	if b.LastModifiedTimestamp != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 3, 7)
+		x.xxx_hidden_LastModifiedTimestamp = *b.LastModifiedTimestamp
+	}
+	x.xxx_hidden_Digests = b.Digests
+	if b.Blake3 != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 5, 7)
+		x.xxx_hidden_Blake3 = b.Blake3
+	}
+	x.xxx_hidden_Attributes = b.Attributes
+	return m0
+}
+
+type UploadRequest struct {
+	state                  protoimpl.MessageState `protogen:"opaque.v1"`
+	xxx_hidden_Path        *string                `protobuf:"bytes,1,opt,name=path"`
+	xxx_hidden_ModuleType  *string                `protobuf:"bytes,2,opt,name=module_type,json=moduleType"`
+	xxx_hidden_Data        []byte                 `protobuf:"bytes,3,opt,name=data"`
+	xxx_hidden_Digests     *Digests               `protobuf:"bytes,4,opt,name=digests"`
+	xxx_hidden_Attributes  map[string]string      `protobuf:"bytes,5,rep,name=attributes" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	XXX_raceDetectHookData protoimpl.RaceDetectHookData
+	XXX_presence           [1]uint32
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
+}
+
+func (x *UploadRequest) Reset() {
+	*x = UploadRequest{}
+	mi := &file_protos_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadRequest) ProtoMessage() {}
+
+func (x *UploadRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (x *UploadRequest) GetPath() string {
+	if x != nil {
+		if x.xxx_hidden_Path != nil {
+			return *x.xxx_hidden_Path
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *UploadRequest) GetModuleType() string {
+	if x != nil {
+		if x.xxx_hidden_ModuleType != nil {
+			return *x.xxx_hidden_ModuleType
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *UploadRequest) GetData() []byte {
+	if x != nil {
+		return x.xxx_hidden_Data
+	}
+	return nil
+}
+
+func (x *UploadRequest) GetDigests() *Digests {
+	if x != nil {
+		return x.xxx_hidden_Digests
+	}
+	return nil
+}
+
+func (x *UploadRequest) GetAttributes() map[string]string {
+	if x != nil {
+		return x.xxx_hidden_Attributes
+	}
+	return nil
+}
+
+func (x *UploadRequest) SetPath(v string) {
+	x.xxx_hidden_Path = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 0, 5)
+}
+
+func (x *UploadRequest) SetModuleType(v string) {
+	x.xxx_hidden_ModuleType = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 1, 5)
+}
+
+func (x *UploadRequest) SetData(v []byte) {
+	if v == nil {
+		v = []byte{}
+	}
+	x.xxx_hidden_Data = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 2, 5)
+}
+
+func (x *UploadRequest) SetDigests(v *Digests) {
+	x.xxx_hidden_Digests = v
+}
+
+func (x *UploadRequest) SetAttributes(v map[string]string) {
+	x.xxx_hidden_Attributes = v
+}
+
+func (x *UploadRequest) HasPath() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 0)
+}
+
+func (x *UploadRequest) HasModuleType() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 1)
+}
+
+func (x *UploadRequest) HasData() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 2)
+}
+
+func (x *UploadRequest) HasDigests() bool {
+	if x == nil {
+		return false
+	}
+	return x.xxx_hidden_Digests != nil
+}
+
+func (x *UploadRequest) ClearPath() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 0)
+	x.xxx_hidden_Path = nil
+}
+
+func (x *UploadRequest) ClearModuleType() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 1)
+	x.xxx_hidden_ModuleType = nil
+}
+
+func (x *UploadRequest) ClearData() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 2)
+	x.xxx_hidden_Data = nil
+}
+
+func (x *UploadRequest) ClearDigests() {
+	x.xxx_hidden_Digests = nil
+}
+
+type UploadRequest_builder struct {
+	_ [0]func() // Prevents comparability and use of unkeyed literals for the builder.
+
+	Path       *string
+	ModuleType *string
+	Data       []byte
+	Digests    *Digests
+	Attributes map[string]string
+}
+
+func (b0 UploadRequest_builder) Build() *UploadRequest {
+	m0 := &UploadRequest{}
+	b, x := &b0, m0
+	_, _ = b, x
+	if b.Path != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 0, 5)
+		x.xxx_hidden_Path = b.Path
+	}
+	if b.ModuleType != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 1, 5)
+		x.xxx_hidden_ModuleType = b.ModuleType
+	}
+	if b.Data != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 2, 5)
+		x.xxx_hidden_Data = b.Data
+	}
+	x.xxx_hidden_Digests = b.Digests
+	x.xxx_hidden_Attributes = b.Attributes
+	return m0
+}
+
+type UploadResponse struct {
+	state                  protoimpl.MessageState `protogen:"opaque.v1"`
+	xxx_hidden_Digests     *Digests               `protobuf:"bytes,1,opt,name=digests"`
+	xxx_hidden_Blake3      []byte                 `protobuf:"bytes,2,opt,name=blake3"`
+	xxx_hidden_Size        int64                  `protobuf:"varint,3,opt,name=size"`
+	xxx_hidden_Hardlinked  bool                   `protobuf:"varint,4,opt,name=hardlinked"`
+	XXX_raceDetectHookData protoimpl.RaceDetectHookData
+	XXX_presence           [1]uint32
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
+}
+
+func (x *UploadResponse) Reset() {
+	*x = UploadResponse{}
+	mi := &file_protos_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadResponse) ProtoMessage() {}
+
+func (x *UploadResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (x *UploadResponse) GetDigests() *Digests {
+	if x != nil {
+		return x.xxx_hidden_Digests
+	}
+	return nil
+}
+
+func (x *UploadResponse) GetBlake3() []byte {
+	if x != nil {
+		return x.xxx_hidden_Blake3
+	}
+	return nil
+}
+
+func (x *UploadResponse) GetSize() int64 {
+	if x != nil {
+		return x.xxx_hidden_Size
+	}
+	return 0
+}
+
+func (x *UploadResponse) GetHardlinked() bool {
+	if x != nil {
+		return x.xxx_hidden_Hardlinked
+	}
+	return false
+}
+
+func (x *UploadResponse) SetDigests(v *Digests) {
+	x.xxx_hidden_Digests = v
+}
+
+func (x *UploadResponse) SetBlake3(v []byte) {
+	if v == nil {
+		v = []byte{}
+	}
+	x.xxx_hidden_Blake3 = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 1, 4)
+}
+
+func (x *UploadResponse) SetSize(v int64) {
+	x.xxx_hidden_Size = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 2, 4)
+}
+
+func (x *UploadResponse) SetHardlinked(v bool) {
+	x.xxx_hidden_Hardlinked = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 3, 4)
+}
+
+func (x *UploadResponse) HasDigests() bool {
+	if x == nil {
+		return false
+	}
+	return x.xxx_hidden_Digests != nil
+}
+
+func (x *UploadResponse) HasBlake3() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 1)
+}
+
+func (x *UploadResponse) HasSize() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 2)
+}
+
+func (x *UploadResponse) HasHardlinked() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 3)
+}
+
+func (x *UploadResponse) ClearDigests() {
+	x.xxx_hidden_Digests = nil
+}
+
+func (x *UploadResponse) ClearBlake3() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 1)
+	x.xxx_hidden_Blake3 = nil
+}
+
+func (x *UploadResponse) ClearSize() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 2)
+	x.xxx_hidden_Size = 0
+}
+
+func (x *UploadResponse) ClearHardlinked() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 3)
+	x.xxx_hidden_Hardlinked = false
+}
+
+type UploadResponse_builder struct {
+	_ [0]func() // Prevents comparability and use of unkeyed literals for the builder.
+
+	Digests    *Digests
+	Blake3     []byte
+	Size       *int64
+	Hardlinked *bool
+}
+
+func (b0 UploadResponse_builder) Build() *UploadResponse {
+	m0 := &UploadResponse{}
+	b, x := &b0, m0
+	_, _ = b, x
+	x.xxx_hidden_Digests = b.Digests
+	if b.Blake3 != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 1, 4)
+		x.xxx_hidden_Blake3 = b.Blake3
+	}
+	if b.Size != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 2, 4)
+		x.xxx_hidden_Size = *b.Size
+	}
+	if b.Hardlinked != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 3, 4)
+		x.xxx_hidden_Hardlinked = *b.Hardlinked
+	}
+	return m0
+}
+
+type DownloadRequest struct {
+	state                  protoimpl.MessageState `protogen:"opaque.v1"`
+	xxx_hidden_Path        *string                `protobuf:"bytes,1,opt,name=path"`
+	xxx_hidden_Offset      int64                  `protobuf:"varint,2,opt,name=offset"`
+	xxx_hidden_Limit       int64                  `protobuf:"varint,3,opt,name=limit"`
+	XXX_raceDetectHookData protoimpl.RaceDetectHookData
+	XXX_presence           [1]uint32
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
+}
+
+func (x *DownloadRequest) Reset() {
+	*x = DownloadRequest{}
+	mi := &file_protos_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DownloadRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DownloadRequest) ProtoMessage() {}
+
+func (x *DownloadRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (x *DownloadRequest) GetPath() string {
+	if x != nil {
+		if x.xxx_hidden_Path != nil {
+			return *x.xxx_hidden_Path
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *DownloadRequest) GetOffset() int64 {
+	if x != nil {
+		return x.xxx_hidden_Offset
+	}
+	return 0
+}
+
+func (x *DownloadRequest) GetLimit() int64 {
+	if x != nil {
+		return x.xxx_hidden_Limit
+	}
+	return 0
+}
+
+func (x *DownloadRequest) SetPath(v string) {
+	x.xxx_hidden_Path = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 0, 3)
+}
+
+func (x *DownloadRequest) SetOffset(v int64) {
+	x.xxx_hidden_Offset = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 1, 3)
+}
+
+func (x *DownloadRequest) SetLimit(v int64) {
+	x.xxx_hidden_Limit = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 2, 3)
+}
+
+func (x *DownloadRequest) HasPath() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 0)
+}
+
+func (x *DownloadRequest) HasOffset() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 1)
+}
+
+func (x *DownloadRequest) HasLimit() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 2)
+}
+
+func (x *DownloadRequest) ClearPath() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 0)
+	x.xxx_hidden_Path = nil
+}
+
+func (x *DownloadRequest) ClearOffset() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 1)
+	x.xxx_hidden_Offset = 0
+}
+
+func (x *DownloadRequest) ClearLimit() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 2)
+	x.xxx_hidden_Limit = 0
+}
+
+type DownloadRequest_builder struct {
+	_ [0]func() // Prevents comparability and use of unkeyed literals for the builder.
+
+	Path   *string
+	Offset *int64
+	// limit, if positive, caps the number of bytes sent.
+	Limit *int64
+}
+
+func (b0 DownloadRequest_builder) Build() *DownloadRequest {
+	m0 := &DownloadRequest{}
+	b, x := &b0, m0
+	_, _ = b, x
+	if b.Path != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 0, 3)
+		x.xxx_hidden_Path = b.Path
+	}
+	if b.Offset != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 1, 3)
+		x.xxx_hidden_Offset = *b.Offset
+	}
+	if b.Limit != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 2, 3)
+		x.xxx_hidden_Limit = *b.Limit
+	}
+	return m0
+}
+
+type DownloadResponse struct {
+	state                  protoimpl.MessageState `protogen:"opaque.v1"`
+	xxx_hidden_Stat        *FileStat              `protobuf:"bytes,1,opt,name=stat"`
+	xxx_hidden_Data        []byte                 `protobuf:"bytes,2,opt,name=data"`
+	XXX_raceDetectHookData protoimpl.RaceDetectHookData
+	XXX_presence           [1]uint32
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
+}
+
+func (x *DownloadResponse) Reset() {
+	*x = DownloadResponse{}
+	mi := &file_protos_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DownloadResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DownloadResponse) ProtoMessage() {}
+
+func (x *DownloadResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (x *DownloadResponse) GetStat() *FileStat {
+	if x != nil {
+		return x.xxx_hidden_Stat
+	}
+	return nil
+}
+
+func (x *DownloadResponse) GetData() []byte {
+	if x != nil {
+		return x.xxx_hidden_Data
+	}
+	return nil
+}
+
+func (x *DownloadResponse) SetStat(v *FileStat) {
+	x.xxx_hidden_Stat = v
+}
+
+func (x *DownloadResponse) SetData(v []byte) {
+	if v == nil {
+		v = []byte{}
+	}
+	x.xxx_hidden_Data = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 1, 2)
+}
+
+func (x *DownloadResponse) HasStat() bool {
+	if x == nil {
+		return false
+	}
+	return x.xxx_hidden_Stat != nil
+}
+
+func (x *DownloadResponse) HasData() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 1)
+}
+
+func (x *DownloadResponse) ClearStat() {
+	x.xxx_hidden_Stat = nil
+}
+
+func (x *DownloadResponse) ClearData() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 1)
+	x.xxx_hidden_Data = nil
+}
+
+type DownloadResponse_builder struct {
+	_ [0]func() // Prevents comparability and use of unkeyed literals for the builder.
+
+	Stat *FileStat
+	Data []byte
+}
+
+func (b0 DownloadResponse_builder) Build() *DownloadResponse {
+	m0 := &DownloadResponse{}
+	b, x := &b0, m0
+	_, _ = b, x
+	x.xxx_hidden_Stat = b.Stat
+	if b.Data != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 1, 2)
+		x.xxx_hidden_Data = b.Data
+	}
+	return m0
+}
+
+type ListRequest struct {
+	state                  protoimpl.MessageState `protogen:"opaque.v1"`
+	xxx_hidden_Prefix      *string                `protobuf:"bytes,1,opt,name=prefix"`
+	xxx_hidden_PageSize    int32                  `protobuf:"varint,2,opt,name=page_size,json=pageSize"`
+	xxx_hidden_PageToken   *string                `protobuf:"bytes,3,opt,name=page_token,json=pageToken"`
+	XXX_raceDetectHookData protoimpl.RaceDetectHookData
+	XXX_presence           [1]uint32
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
+}
+
+func (x *ListRequest) Reset() {
+	*x = ListRequest{}
+	mi := &file_protos_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRequest) ProtoMessage() {}
+
+func (x *ListRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (x *ListRequest) GetPrefix() string {
+	if x != nil {
+		if x.xxx_hidden_Prefix != nil {
+			return *x.xxx_hidden_Prefix
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *ListRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.xxx_hidden_PageSize
+	}
+	return 0
+}
+
+func (x *ListRequest) GetPageToken() string {
+	if x != nil {
+		if x.xxx_hidden_PageToken != nil {
+			return *x.xxx_hidden_PageToken
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *ListRequest) SetPrefix(v string) {
+	x.xxx_hidden_Prefix = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 0, 3)
+}
+
+func (x *ListRequest) SetPageSize(v int32) {
+	x.xxx_hidden_PageSize = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 1, 3)
+}
+
+func (x *ListRequest) SetPageToken(v string) {
+	x.xxx_hidden_PageToken = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 2, 3)
+}
+
+func (x *ListRequest) HasPrefix() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 0)
+}
+
+func (x *ListRequest) HasPageSize() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 1)
+}
+
+func (x *ListRequest) HasPageToken() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 2)
+}
+
+func (x *ListRequest) ClearPrefix() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 0)
+	x.xxx_hidden_Prefix = nil
+}
+
+func (x *ListRequest) ClearPageSize() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 1)
+	x.xxx_hidden_PageSize = 0
+}
+
+func (x *ListRequest) ClearPageToken() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 2)
+	x.xxx_hidden_PageToken = nil
+}
+
+type ListRequest_builder struct {
+	_ [0]func() // Prevents comparability and use of unkeyed literals for the builder.
+
+	Prefix    *string
+	PageSize  *int32
+	PageToken *string
+}
+
+func (b0 ListRequest_builder) Build() *ListRequest {
+	m0 := &ListRequest{}
+	b, x := &b0, m0
+	_, _ = b, x
+	if b.Prefix != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 0, 3)
+		x.xxx_hidden_Prefix = b.Prefix
+	}
+	if b.PageSize != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 1, 3)
+		x.xxx_hidden_PageSize = *b.PageSize
+	}
+	if b.PageToken != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 2, 3)
+		x.xxx_hidden_PageToken = b.PageToken
+	}
+	return m0
+}
+
+type ListResponse struct {
+	state                    protoimpl.MessageState `protogen:"opaque.v1"`
+	xxx_hidden_Paths         []string               `protobuf:"bytes,1,rep,name=paths"`
+	xxx_hidden_NextPageToken *string                `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken"`
+	XXX_raceDetectHookData   protoimpl.RaceDetectHookData
+	XXX_presence             [1]uint32
+	unknownFields            protoimpl.UnknownFields
+	sizeCache                protoimpl.SizeCache
+}
+
+func (x *ListResponse) Reset() {
+	*x = ListResponse{}
+	mi := &file_protos_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListResponse) ProtoMessage() {}
+
+func (x *ListResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (x *ListResponse) GetPaths() []string {
+	if x != nil {
+		return x.xxx_hidden_Paths
+	}
+	return nil
+}
+
+func (x *ListResponse) GetNextPageToken() string {
+	if x != nil {
+		if x.xxx_hidden_NextPageToken != nil {
+			return *x.xxx_hidden_NextPageToken
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *ListResponse) SetPaths(v []string) {
+	x.xxx_hidden_Paths = v
+}
+
+func (x *ListResponse) SetNextPageToken(v string) {
+	x.xxx_hidden_NextPageToken = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 1, 2)
+}
+
+func (x *ListResponse) HasNextPageToken() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 1)
+}
+
+func (x *ListResponse) ClearNextPageToken() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 1)
+	x.xxx_hidden_NextPageToken = nil
+}
+
+type ListResponse_builder struct {
+	_ [0]func() // Prevents comparability and use of unkeyed literals for the builder.
+
+	Paths         []string
+	NextPageToken *string
+}
+
+func (b0 ListResponse_builder) Build() *ListResponse {
+	m0 := &ListResponse{}
+	b, x := &b0, m0
+	_, _ = b, x
+	x.xxx_hidden_Paths = b.Paths
+	if b.NextPageToken != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 1, 2)
+		x.xxx_hidden_NextPageToken = b.NextPageToken
+	}
+	return m0
+}
+
+type StatRequest struct {
+	state                  protoimpl.MessageState `protogen:"opaque.v1"`
+	xxx_hidden_Path        *string                `protobuf:"bytes,1,opt,name=path"`
+	XXX_raceDetectHookData protoimpl.RaceDetectHookData
+	XXX_presence           [1]uint32
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
+}
+
+func (x *StatRequest) Reset() {
+	*x = StatRequest{}
+	mi := &file_protos_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatRequest) ProtoMessage() {}
+
+func (x *StatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (x *StatRequest) GetPath() string {
+	if x != nil {
+		if x.xxx_hidden_Path != nil {
+			return *x.xxx_hidden_Path
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *StatRequest) SetPath(v string) {
+	x.xxx_hidden_Path = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 0, 1)
+}
+
+func (x *StatRequest) HasPath() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 0)
+}
+
+func (x *StatRequest) ClearPath() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 0)
+	x.xxx_hidden_Path = nil
+}
+
+type StatRequest_builder struct {
+	_ [0]func() // Prevents comparability and use of unkeyed literals for the builder.
+
+	Path *string
+}
+
+func (b0 StatRequest_builder) Build() *StatRequest {
+	m0 := &StatRequest{}
+	b, x := &b0, m0
+	_, _ = b, x
+	if b.Path != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 0, 1)
+		x.xxx_hidden_Path = b.Path
+	}
+	return m0
+}
+
+type DeleteRequest struct {
+	state                  protoimpl.MessageState `protogen:"opaque.v1"`
+	xxx_hidden_Path        *string                `protobuf:"bytes,1,opt,name=path"`
+	XXX_raceDetectHookData protoimpl.RaceDetectHookData
+	XXX_presence           [1]uint32
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
+}
+
+func (x *DeleteRequest) Reset() {
+	*x = DeleteRequest{}
+	mi := &file_protos_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRequest) ProtoMessage() {}
+
+func (x *DeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (x *DeleteRequest) GetPath() string {
+	if x != nil {
+		if x.xxx_hidden_Path != nil {
+			return *x.xxx_hidden_Path
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *DeleteRequest) SetPath(v string) {
+	x.xxx_hidden_Path = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 0, 1)
+}
+
+func (x *DeleteRequest) HasPath() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 0)
+}
+
+func (x *DeleteRequest) ClearPath() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 0)
+	x.xxx_hidden_Path = nil
+}
+
+type DeleteRequest_builder struct {
+	_ [0]func() // Prevents comparability and use of unkeyed literals for the builder.
+
+	Path *string
+}
+
+func (b0 DeleteRequest_builder) Build() *DeleteRequest {
+	m0 := &DeleteRequest{}
+	b, x := &b0, m0
+	_, _ = b, x
+	if b.Path != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 0, 1)
+		x.xxx_hidden_Path = b.Path
+	}
+	return m0
+}
+
+type DeleteResponse struct {
+	state         protoimpl.MessageState `protogen:"opaque.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteResponse) Reset() {
+	*x = DeleteResponse{}
+	mi := &file_protos_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteResponse) ProtoMessage() {}
+
+func (x *DeleteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+type DeleteResponse_builder struct {
+	_ [0]func() // Prevents comparability and use of unkeyed literals for the builder.
+
+}
+
+func (b0 DeleteResponse_builder) Build() *DeleteResponse {
+	m0 := &DeleteResponse{}
+	b, x := &b0, m0
+	_, _ = b, x
+	return m0
+}
+
+type GetTestingRecordRequest struct {
+	state                  protoimpl.MessageState `protogen:"opaque.v1"`
+	xxx_hidden_Contest     *string                `protobuf:"bytes,1,opt,name=contest"`
+	xxx_hidden_Submit      *string                `protobuf:"bytes,2,opt,name=submit"`
+	xxx_hidden_Testing     *string                `protobuf:"bytes,3,opt,name=testing"`
+	xxx_hidden_Problem     *string                `protobuf:"bytes,4,opt,name=problem"`
+	xxx_hidden_SizeLimit   int64                  `protobuf:"varint,5,opt,name=size_limit,json=sizeLimit"`
+	XXX_raceDetectHookData protoimpl.RaceDetectHookData
+	XXX_presence           [1]uint32
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
+}
+
+func (x *GetTestingRecordRequest) Reset() {
+	*x = GetTestingRecordRequest{}
+	mi := &file_protos_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetTestingRecordRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTestingRecordRequest) ProtoMessage() {}
+
+func (x *GetTestingRecordRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protos_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (x *GetTestingRecordRequest) GetContest() string {
+	if x != nil {
+		if x.xxx_hidden_Contest != nil {
+			return *x.xxx_hidden_Contest
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *GetTestingRecordRequest) GetSubmit() string {
+	if x != nil {
+		if x.xxx_hidden_Submit != nil {
+			return *x.xxx_hidden_Submit
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *GetTestingRecordRequest) GetTesting() string {
+	if x != nil {
+		if x.xxx_hidden_Testing != nil {
+			return *x.xxx_hidden_Testing
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *GetTestingRecordRequest) GetProblem() string {
+	if x != nil {
+		if x.xxx_hidden_Problem != nil {
+			return *x.xxx_hidden_Problem
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *GetTestingRecordRequest) GetSizeLimit() int64 {
+	if x != nil {
+		return x.xxx_hidden_SizeLimit
+	}
+	return 0
+}
+
+func (x *GetTestingRecordRequest) SetContest(v string) {
+	x.xxx_hidden_Contest = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 0, 5)
+}
+
+func (x *GetTestingRecordRequest) SetSubmit(v string) {
+	x.xxx_hidden_Submit = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 1, 5)
+}
+
+func (x *GetTestingRecordRequest) SetTesting(v string) {
+	x.xxx_hidden_Testing = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 2, 5)
+}
+
+func (x *GetTestingRecordRequest) SetProblem(v string) {
+	x.xxx_hidden_Problem = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 3, 5)
+}
+
+func (x *GetTestingRecordRequest) SetSizeLimit(v int64) {
+	x.xxx_hidden_SizeLimit = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 4, 5)
+}
+
+func (x *GetTestingRecordRequest) HasContest() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 0)
+}
+
+func (x *GetTestingRecordRequest) HasSubmit() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 1)
+}
+
+func (x *GetTestingRecordRequest) HasTesting() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 2)
+}
+
+func (x *GetTestingRecordRequest) HasProblem() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 3)
+}
+
+func (x *GetTestingRecordRequest) HasSizeLimit() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 4)
+}
+
+func (x *GetTestingRecordRequest) ClearContest() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 0)
+	x.xxx_hidden_Contest = nil
+}
+
+func (x *GetTestingRecordRequest) ClearSubmit() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 1)
+	x.xxx_hidden_Submit = nil
+}
+
+func (x *GetTestingRecordRequest) ClearTesting() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 2)
+	x.xxx_hidden_Testing = nil
+}
+
+func (x *GetTestingRecordRequest) ClearProblem() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 3)
+	x.xxx_hidden_Problem = nil
+}
+
+func (x *GetTestingRecordRequest) ClearSizeLimit() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 4)
+	x.xxx_hidden_SizeLimit = 0
+}
+
+type GetTestingRecordRequest_builder struct {
+	_ [0]func() // Prevents comparability and use of unkeyed literals for the builder.
+
+	Contest *string
+	Submit  *string
+	Testing *string
+	Problem *string
+	// size_limit caps test assets; 0 means the default.
+	SizeLimit *int64
+}
+
+func (b0 GetTestingRecordRequest_builder) Build() *GetTestingRecordRequest {
+	m0 := &GetTestingRecordRequest{}
+	b, x := &b0, m0
+	_, _ = b, x
+	if b.Contest != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 0, 5)
+		x.xxx_hidden_Contest = b.Contest
+	}
+	if b.Submit != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 1, 5)
+		x.xxx_hidden_Submit = b.Submit
+	}
+	if b.Testing != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 2, 5)
+		x.xxx_hidden_Testing = b.Testing
+	}
+	if b.Problem != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 3, 5)
+		x.xxx_hidden_Problem = b.Problem
+	}
+	if b.SizeLimit != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 4, 5)
+		x.xxx_hidden_SizeLimit = *b.SizeLimit
+	}
+	return m0
+}
+
+var File_protos_proto protoreflect.FileDescriptor
+
+const file_protos_proto_rawDesc = "" +
+	"\n" +
+	"\fprotos.proto\x12\x06protos\x1a!google/protobuf/go_features.proto\"G\n" +
+	"\aDigests\x12\x12\n" +
+	"\x04sha1\x18\x01 \x01(\fR\x04sha1\x12\x10\n" +
+	"\x03md5\x18\x02 \x01(\fR\x03md5\x12\x16\n" +
+	"\x06sha256\x18\x03 \x01(\fR\x06sha256\"O\n" +
+	"\x0eDigestsAndSize\x12)\n" +
+	"\adigests\x18\x01 \x01(\v2\x0f.protos.DigestsR\adigests\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x03R\x04size\"P\n" +
+	"\rContestRecord\x12\x18\n" +
+	"\acontent\x18\x01 \x01(\fR\acontent\x12%\n" +
+	"\x0etimestamp_unix\x18\x02 \x01(\x03R\rtimestampUnix\"l\n" +
+	"\rProblemRecord\x12\x18\n" +
+	"\acontent\x18\x01 \x01(\fR\acontent\x12%\n" +
+	"\x0etimestamp_unix\x18\x02 \x01(\x03R\rtimestampUnix\x12\x1a\n" +
+	"\brevision\x18\x03 \x01(\x03R\brevision\"\xd3\x02\n" +
+	"\x0eDirectoryEntry\x12\x1f\n" +
+	"\vblake3_hash\x18\x01 \x01(\fR\n" +
+	"blake3Hash\x12\x1f\n" +
+	"\vmodule_type\x18\x02 \x01(\tR\n" +
+	"moduleType\x126\n" +
+	"\x17last_modified_timestamp\x18\x03 \x01(\x03R\x15lastModifiedTimestamp\x12@\n" +
+	"\x10digests_and_size\x18\x04 \x01(\v2\x16.protos.DigestsAndSizeR\x0edigestsAndSize\x12F\n" +
+	"\n" +
+	"attributes\x18\x05 \x03(\v2&.protos.DirectoryEntry.AttributesEntryR\n" +
+	"attributes\x1a=\n" +
+	"\x0fAttributesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x83\x02\n" +
+	"\vAuditRecord\x12.\n" +
+	"\x13timestamp_unix_nano\x18\x01 \x01(\x03R\x11timestampUnixNano\x12\x1a\n" +
+	"\bidentity\x18\x02 \x01(\tR\bidentity\x12\x16\n" +
+	"\x06action\x18\x03 \x01(\tR\x06action\x12\x12\n" +
+	"\x04path\x18\x04 \x01(\tR\x04path\x12\x1d\n" +
+	"\n" +
+	"old_blake3\x18\x05 \x01(\fR\toldBlake3\x12\x1d\n" +
+	"\n" +
+	"new_blake3\x18\x06 \x01(\fR\tnewBlake3\x12\x1f\n" +
+	"\vremote_addr\x18\a \x01(\tR\n" +
+	"remoteAddr\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\b \x01(\tR\trequestId\" \n" +
+	"\bPathList\x12\x14\n" +
+	"\x05paths\x18\x01 \x03(\tR\x05paths\"i\n" +
+	"\tHashEntry\x125\n" +
+	"\finline_paths\x18\x01 \x01(\v2\x10.protos.PathListH\x00R\vinlinePaths\x12\x1c\n" +
+	"\brefcount\x18\x02 \x01(\x03H\x00R\brefcountB\a\n" +
+	"\x05state\"\x9b\x01\n" +
+	"\rUploadSession\x12\x14\n" +
+	"\x05owner\x18\x01 \x01(\tR\x05owner\x12\x16\n" +
+	"\x06length\x18\x02 \x01(\x03R\x06length\x12\x16\n" +
+	"\x06offset\x18\x03 \x01(\x03R\x06offset\x12!\n" +
+	"\fcreated_unix\x18\x04 \x01(\x03R\vcreatedUnix\x12!\n" +
+	"\fexpires_unix\x18\x05 \x01(\x03R\vexpiresUnix\"r\n" +
+	"\x05Asset\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1c\n" +
+	"\ttruncated\x18\x02 \x01(\bR\ttruncated\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data\x12#\n" +
+	"\roriginal_size\x18\x04 \x01(\x03R\foriginalSize\"\xcc\x01\n" +
+	"\n" +
+	"TestRecord\x12\x17\n" +
+	"\atest_id\x18\x01 \x01(\x03R\x06testId\x12#\n" +
+	"\x05input\x18\x02 \x01(\v2\r.protos.AssetR\x05input\x12%\n" +
+	"\x06output\x18\x03 \x01(\v2\r.protos.AssetR\x06output\x12%\n" +
+	"\x06answer\x18\x04 \x01(\v2\r.protos.AssetR\x06answer\x122\n" +
+	"\rtester_output\x18\x05 \x01(\v2\r.protos.AssetR\ftesterOutput\"b\n" +
+	"\rTestingRecord\x12)\n" +
+	"\bsolution\x18\x01 \x01(\v2\r.protos.AssetR\bsolution\x12&\n" +
+	"\x04test\x18\x02 \x03(\v2\x12.protos.TestRecordR\x04test\"\xcf\x02\n" +
+	"\bFileStat\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x03R\x04size\x12\x1f\n" +
+	"\vmodule_type\x18\x03 \x01(\tR\n" +
+	"moduleType\x126\n" +
+	"\x17last_modified_timestamp\x18\x04 \x01(\x03R\x15lastModifiedTimestamp\x12)\n" +
+	"\adigests\x18\x05 \x01(\v2\x0f.protos.DigestsR\adigests\x12\x16\n" +
+	"\x06blake3\x18\x06 \x01(\fR\x06blake3\x12@\n" +
+	"\n" +
+	"attributes\x18\a \x03(\v2 .protos.FileStat.AttributesEntryR\n" +
+	"attributes\x1a=\n" +
+	"\x0fAttributesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x89\x02\n" +
+	"\rUploadRequest\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x1f\n" +
+	"\vmodule_type\x18\x02 \x01(\tR\n" +
+	"moduleType\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data\x12)\n" +
+	"\adigests\x18\x04 \x01(\v2\x0f.protos.DigestsR\adigests\x12E\n" +
+	"\n" +
+	"attributes\x18\x05 \x03(\v2%.protos.UploadRequest.AttributesEntryR\n" +
+	"attributes\x1a=\n" +
+	"\x0fAttributesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x87\x01\n" +
+	"\x0eUploadResponse\x12)\n" +
+	"\adigests\x18\x01 \x01(\v2\x0f.protos.DigestsR\adigests\x12\x16\n" +
+	"\x06blake3\x18\x02 \x01(\fR\x06blake3\x12\x12\n" +
+	"\x04size\x18\x03 \x01(\x03R\x04size\x12\x1e\n" +
+	"\n" +
+	"hardlinked\x18\x04 \x01(\bR\n" +
+	"hardlinked\"S\n" +
+	"\x0fDownloadRequest\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x16\n" +
+	"\x06offset\x18\x02 \x01(\x03R\x06offset\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\x03R\x05limit\"L\n" +
+	"\x10DownloadResponse\x12$\n" +
+	"\x04stat\x18\x01 \x01(\v2\x10.protos.FileStatR\x04stat\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\"a\n" +
+	"\vListRequest\x12\x16\n" +
+	"\x06prefix\x18\x01 \x01(\tR\x06prefix\x12\x1b\n" +
+	"\tpage_size\x18\x02 \x01(\x05R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x03 \x01(\tR\tpageToken\"L\n" +
+	"\fListResponse\x12\x14\n" +
+	"\x05paths\x18\x01 \x03(\tR\x05paths\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"!\n" +
+	"\vStatRequest\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\"#\n" +
+	"\rDeleteRequest\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\"\x10\n" +
+	"\x0eDeleteResponse\"\x9e\x01\n" +
+	"\x17GetTestingRecordRequest\x12\x18\n" +
+	"\acontest\x18\x01 \x01(\tR\acontest\x12\x16\n" +
+	"\x06submit\x18\x02 \x01(\tR\x06submit\x12\x18\n" +
+	"\atesting\x18\x03 \x01(\tR\atesting\x12\x18\n" +
+	"\aproblem\x18\x04 \x01(\tR\aproblem\x12\x1d\n" +
+	"\n" +
+	"size_limit\x18\x05 \x01(\x03R\tsizeLimit*>\n" +
 	"\n" +
 	"AuthAction\x12\n" +
 	"\n" +
 	"\x06A_NONE\x10\x00\x12\n" +
 	"\n" +
 	"\x06A_READ\x10\x01\x12\v\n" +
-	"\aA_WRITE\x10\x02B0Z$github.com/contester/advfiler/protos\x92\x03\a\xd2>\x02\x10\x03 \x03b\beditionsp\xe9\a"
+	"\aA_WRITE\x10\x02\x12\v\n" +
+	"\aA_ADMIN\x10\x032\xf1\x02\n" +
+	"\fFilerService\x129\n" +
+	"\x06Upload\x12\x15.protos.UploadRequest\x1a\x16.protos.UploadResponse(\x01\x12?\n" +
+	"\bDownload\x12\x17.protos.DownloadRequest\x1a\x18.protos.DownloadResponse0\x01\x121\n" +
+	"\x04List\x12\x13.protos.ListRequest\x1a\x14.protos.ListResponse\x12-\n" +
+	"\x04Stat\x12\x13.protos.StatRequest\x1a\x10.protos.FileStat\x127\n" +
+	"\x06Delete\x12\x15.protos.DeleteRequest\x1a\x16.protos.DeleteResponse\x12J\n" +
+	"\x10GetTestingRecord\x12\x1f.protos.GetTestingRecordRequest\x1a\x15.protos.TestingRecordB0Z$github.com/contester/advfiler/protos\x92\x03\a\xd2>\x02\x10\x03 \x03b\beditionsp\xe9\a"
 
 var file_protos_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_protos_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_protos_proto_msgTypes = make([]protoimpl.MessageInfo, 26)
 var file_protos_proto_goTypes = []any{
-	(AuthAction)(0),        // 0: protos.AuthAction
-	(*Digests)(nil),        // 1: protos.Digests
-	(*DigestsAndSize)(nil), // 2: protos.DigestsAndSize
-	(*ContestRecord)(nil),  // 3: protos.ContestRecord
-	(*ProblemRecord)(nil),  // 4: protos.ProblemRecord
-	(*DirectoryEntry)(nil), // 5: protos.DirectoryEntry
-	(*PathList)(nil),       // 6: protos.PathList
-	(*HashEntry)(nil),      // 7: protos.HashEntry
-	(*Asset)(nil),          // 8: protos.Asset
-	(*TestRecord)(nil),     // 9: protos.TestRecord
-	(*TestingRecord)(nil),  // 10: protos.TestingRecord
+	(AuthAction)(0),                 // 0: protos.AuthAction
+	(*Digests)(nil),                 // 1: protos.Digests
+	(*DigestsAndSize)(nil),          // 2: protos.DigestsAndSize
+	(*ContestRecord)(nil),           // 3: protos.ContestRecord
+	(*ProblemRecord)(nil),           // 4: protos.ProblemRecord
+	(*DirectoryEntry)(nil),          // 5: protos.DirectoryEntry
+	(*AuditRecord)(nil),             // 6: protos.AuditRecord
+	(*PathList)(nil),                // 7: protos.PathList
+	(*HashEntry)(nil),               // 8: protos.HashEntry
+	(*UploadSession)(nil),           // 9: protos.UploadSession
+	(*Asset)(nil),                   // 10: protos.Asset
+	(*TestRecord)(nil),              // 11: protos.TestRecord
+	(*TestingRecord)(nil),           // 12: protos.TestingRecord
+	(*FileStat)(nil),                // 13: protos.FileStat
+	(*UploadRequest)(nil),           // 14: protos.UploadRequest
+	(*UploadResponse)(nil),          // 15: protos.UploadResponse
+	(*DownloadRequest)(nil),         // 16: protos.DownloadRequest
+	(*DownloadResponse)(nil),        // 17: protos.DownloadResponse
+	(*ListRequest)(nil),             // 18: protos.ListRequest
+	(*ListResponse)(nil),            // 19: protos.ListResponse
+	(*StatRequest)(nil),             // 20: protos.StatRequest
+	(*DeleteRequest)(nil),           // 21: protos.DeleteRequest
+	(*DeleteResponse)(nil),          // 22: protos.DeleteResponse
+	(*GetTestingRecordRequest)(nil), // 23: protos.GetTestingRecordRequest
+	nil,                             // 24: protos.DirectoryEntry.AttributesEntry
+	nil,                             // 25: protos.FileStat.AttributesEntry
+	nil,                             // 26: protos.UploadRequest.AttributesEntry
 }
 var file_protos_proto_depIdxs = []int32{
-	1, // 0: protos.DigestsAndSize.digests:type_name -> protos.Digests
-	2, // 1: protos.DirectoryEntry.digests_and_size:type_name -> protos.DigestsAndSize
-	6, // 2: protos.HashEntry.inline_paths:type_name -> protos.PathList
-	8, // 3: protos.TestRecord.input:type_name -> protos.Asset
-	8, // 4: protos.TestRecord.output:type_name -> protos.Asset
-	8, // 5: protos.TestRecord.answer:type_name -> protos.Asset
-	8, // 6: protos.TestRecord.tester_output:type_name -> protos.Asset
-	8, // 7: protos.TestingRecord.solution:type_name -> protos.Asset
-	9, // 8: protos.TestingRecord.test:type_name -> protos.TestRecord
-	9, // [9:9] is the sub-list for method output_type
-	9, // [9:9] is the sub-list for method input_type
-	9, // [9:9] is the sub-list for extension type_name
-	9, // [9:9] is the sub-list for extension extendee
-	0, // [0:9] is the sub-list for field type_name
+	1,  // 0: protos.DigestsAndSize.digests:type_name -> protos.Digests
+	2,  // 1: protos.DirectoryEntry.digests_and_size:type_name -> protos.DigestsAndSize
+	24, // 2: protos.DirectoryEntry.attributes:type_name -> protos.DirectoryEntry.AttributesEntry
+	7,  // 3: protos.HashEntry.inline_paths:type_name -> protos.PathList
+	10, // 4: protos.TestRecord.input:type_name -> protos.Asset
+	10, // 5: protos.TestRecord.output:type_name -> protos.Asset
+	10, // 6: protos.TestRecord.answer:type_name -> protos.Asset
+	10, // 7: protos.TestRecord.tester_output:type_name -> protos.Asset
+	10, // 8: protos.TestingRecord.solution:type_name -> protos.Asset
+	11, // 9: protos.TestingRecord.test:type_name -> protos.TestRecord
+	1,  // 10: protos.FileStat.digests:type_name -> protos.Digests
+	25, // 11: protos.FileStat.attributes:type_name -> protos.FileStat.AttributesEntry
+	1,  // 12: protos.UploadRequest.digests:type_name -> protos.Digests
+	26, // 13: protos.UploadRequest.attributes:type_name -> protos.UploadRequest.AttributesEntry
+	1,  // 14: protos.UploadResponse.digests:type_name -> protos.Digests
+	13, // 15: protos.DownloadResponse.stat:type_name -> protos.FileStat
+	14, // 16: protos.FilerService.Upload:input_type -> protos.UploadRequest
+	16, // 17: protos.FilerService.Download:input_type -> protos.DownloadRequest
+	18, // 18: protos.FilerService.List:input_type -> protos.ListRequest
+	20, // 19: protos.FilerService.Stat:input_type -> protos.StatRequest
+	21, // 20: protos.FilerService.Delete:input_type -> protos.DeleteRequest
+	23, // 21: protos.FilerService.GetTestingRecord:input_type -> protos.GetTestingRecordRequest
+	15, // 22: protos.FilerService.Upload:output_type -> protos.UploadResponse
+	17, // 23: protos.FilerService.Download:output_type -> protos.DownloadResponse
+	19, // 24: protos.FilerService.List:output_type -> protos.ListResponse
+	13, // 25: protos.FilerService.Stat:output_type -> protos.FileStat
+	22, // 26: protos.FilerService.Delete:output_type -> protos.DeleteResponse
+	12, // 27: protos.FilerService.GetTestingRecord:output_type -> protos.TestingRecord
+	22, // [22:28] is the sub-list for method output_type
+	16, // [16:22] is the sub-list for method input_type
+	16, // [16:16] is the sub-list for extension type_name
+	16, // [16:16] is the sub-list for extension extendee
+	0,  // [0:16] is the sub-list for field type_name
 }
 
 func init() { file_protos_proto_init() }
@@ -1470,7 +3596,7 @@ func file_protos_proto_init() {
 	if File_protos_proto != nil {
 		return
 	}
-	file_protos_proto_msgTypes[6].OneofWrappers = []any{
+	file_protos_proto_msgTypes[7].OneofWrappers = []any{
 		(*hashEntry_InlinePaths)(nil),
 		(*hashEntry_Refcount)(nil),
 	}
@@ -1480,9 +3606,9 @@ func file_protos_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_protos_proto_rawDesc), len(file_protos_proto_rawDesc)),
 			NumEnums:      1,
-			NumMessages:   10,
+			NumMessages:   26,
 			NumExtensions: 0,
-			NumServices:   0,
+			NumServices:   1,
 		},
 		GoTypes:           file_protos_proto_goTypes,
 		DependencyIndexes: file_protos_proto_depIdxs,
@@ -0,0 +1,324 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v7.34.0
+// source: protos.proto
+
+package protos
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	FilerService_Upload_FullMethodName           = "/protos.FilerService/Upload"
+	FilerService_Download_FullMethodName         = "/protos.FilerService/Download"
+	FilerService_List_FullMethodName             = "/protos.FilerService/List"
+	FilerService_Stat_FullMethodName             = "/protos.FilerService/Stat"
+	FilerService_Delete_FullMethodName           = "/protos.FilerService/Delete"
+	FilerService_GetTestingRecord_FullMethodName = "/protos.FilerService/GetTestingRecord"
+)
+
+// FilerServiceClient is the client API for FilerService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// FilerService is the filer over gRPC. Callers authenticate with an
+// "authorization: Bearer <token>" metadata entry, like over HTTP.
+type FilerServiceClient interface {
+	// Upload takes the path and module type in the first message and the
+	// content in the data fields of it and the following ones. Expected
+	// digests, if any, go in the last message.
+	Upload(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadRequest, UploadResponse], error)
+	// Download sends the file's metadata in the first message, then its
+	// content starting at offset, in chunks.
+	Download(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DownloadResponse], error)
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*FileStat, error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	GetTestingRecord(ctx context.Context, in *GetTestingRecordRequest, opts ...grpc.CallOption) (*TestingRecord, error)
+}
+
+type filerServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFilerServiceClient(cc grpc.ClientConnInterface) FilerServiceClient {
+	return &filerServiceClient{cc}
+}
+
+func (c *filerServiceClient) Upload(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadRequest, UploadResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FilerService_ServiceDesc.Streams[0], FilerService_Upload_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[UploadRequest, UploadResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FilerService_UploadClient = grpc.ClientStreamingClient[UploadRequest, UploadResponse]
+
+func (c *filerServiceClient) Download(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DownloadResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FilerService_ServiceDesc.Streams[1], FilerService_Download_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DownloadRequest, DownloadResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FilerService_DownloadClient = grpc.ServerStreamingClient[DownloadResponse]
+
+func (c *filerServiceClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, FilerService_List_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *filerServiceClient) Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*FileStat, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FileStat)
+	err := c.cc.Invoke(ctx, FilerService_Stat_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *filerServiceClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, FilerService_Delete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *filerServiceClient) GetTestingRecord(ctx context.Context, in *GetTestingRecordRequest, opts ...grpc.CallOption) (*TestingRecord, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TestingRecord)
+	err := c.cc.Invoke(ctx, FilerService_GetTestingRecord_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FilerServiceServer is the server API for FilerService service.
+// All implementations must embed UnimplementedFilerServiceServer
+// for forward compatibility.
+//
+// FilerService is the filer over gRPC. Callers authenticate with an
+// "authorization: Bearer <token>" metadata entry, like over HTTP.
+type FilerServiceServer interface {
+	// Upload takes the path and module type in the first message and the
+	// content in the data fields of it and the following ones. Expected
+	// digests, if any, go in the last message.
+	Upload(grpc.ClientStreamingServer[UploadRequest, UploadResponse]) error
+	// Download sends the file's metadata in the first message, then its
+	// content starting at offset, in chunks.
+	Download(*DownloadRequest, grpc.ServerStreamingServer[DownloadResponse]) error
+	List(context.Context, *ListRequest) (*ListResponse, error)
+	Stat(context.Context, *StatRequest) (*FileStat, error)
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	GetTestingRecord(context.Context, *GetTestingRecordRequest) (*TestingRecord, error)
+	mustEmbedUnimplementedFilerServiceServer()
+}
+
+// UnimplementedFilerServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedFilerServiceServer struct{}
+
+func (UnimplementedFilerServiceServer) Upload(grpc.ClientStreamingServer[UploadRequest, UploadResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Upload not implemented")
+}
+func (UnimplementedFilerServiceServer) Download(*DownloadRequest, grpc.ServerStreamingServer[DownloadResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Download not implemented")
+}
+func (UnimplementedFilerServiceServer) List(context.Context, *ListRequest) (*ListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedFilerServiceServer) Stat(context.Context, *StatRequest) (*FileStat, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stat not implemented")
+}
+func (UnimplementedFilerServiceServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedFilerServiceServer) GetTestingRecord(context.Context, *GetTestingRecordRequest) (*TestingRecord, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTestingRecord not implemented")
+}
+func (UnimplementedFilerServiceServer) mustEmbedUnimplementedFilerServiceServer() {}
+func (UnimplementedFilerServiceServer) testEmbeddedByValue()                      {}
+
+// UnsafeFilerServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FilerServiceServer will
+// result in compilation errors.
+type UnsafeFilerServiceServer interface {
+	mustEmbedUnimplementedFilerServiceServer()
+}
+
+func RegisterFilerServiceServer(s grpc.ServiceRegistrar, srv FilerServiceServer) {
+	// If the following call pancis, it indicates UnimplementedFilerServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&FilerService_ServiceDesc, srv)
+}
+
+func _FilerService_Upload_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(FilerServiceServer).Upload(&grpc.GenericServerStream[UploadRequest, UploadResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FilerService_UploadServer = grpc.ClientStreamingServer[UploadRequest, UploadResponse]
+
+func _FilerService_Download_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FilerServiceServer).Download(m, &grpc.GenericServerStream[DownloadRequest, DownloadResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FilerService_DownloadServer = grpc.ServerStreamingServer[DownloadResponse]
+
+func _FilerService_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FilerServiceServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FilerService_List_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FilerServiceServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FilerService_Stat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FilerServiceServer).Stat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FilerService_Stat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FilerServiceServer).Stat(ctx, req.(*StatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FilerService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FilerServiceServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FilerService_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FilerServiceServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FilerService_GetTestingRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTestingRecordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FilerServiceServer).GetTestingRecord(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FilerService_GetTestingRecord_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FilerServiceServer).GetTestingRecord(ctx, req.(*GetTestingRecordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// FilerService_ServiceDesc is the grpc.ServiceDesc for FilerService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FilerService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "protos.FilerService",
+	HandlerType: (*FilerServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "List",
+			Handler:    _FilerService_List_Handler,
+		},
+		{
+			MethodName: "Stat",
+			Handler:    _FilerService_Stat_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _FilerService_Delete_Handler,
+		},
+		{
+			MethodName: "GetTestingRecord",
+			Handler:    _FilerService_GetTestingRecord_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Upload",
+			Handler:       _FilerService_Upload_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Download",
+			Handler:       _FilerService_Download_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "protos.proto",
+}
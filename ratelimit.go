@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/contester/advfiler/protos"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+var (
+	rateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "advfiler_rate_limited_requests_total",
+		Help: "Requests refused with 429, by endpoint group.",
+	}, []string{"group"})
+	bandwidthThrottled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "advfiler_bandwidth_throttled_seconds_total",
+		Help: "Time spent holding back request and response bodies over the bandwidth limit, by endpoint group.",
+	}, []string{"group"})
+)
+
+func init() {
+	prometheus.MustRegister(rateLimited, bandwidthThrottled)
+}
+
+// limiterSet holds token buckets for one kind of limit. An endpoint group is
+// a URL path prefix; a request belongs to the longest one it starts with,
+// and each client gets a bucket of its own in every group.
+type limiterSet struct {
+	groups map[string]rate.Limit
+
+	mu      sync.Mutex
+	buckets map[bucketKey]*rate.Limiter
+	swept   time.Time
+}
+
+type bucketKey struct {
+	group, client string
+}
+
+// sweepInterval is how often full buckets, which behave the same as new
+// ones, are dropped.
+const sweepInterval = time.Minute
+
+func newLimiterSet[T int64 | float64](groups map[string]T) *limiterSet {
+	ls := &limiterSet{groups: make(map[string]rate.Limit), buckets: make(map[bucketKey]*rate.Limiter)}
+	for prefix, v := range groups {
+		if v > 0 {
+			ls.groups[prefix] = rate.Limit(v)
+		}
+	}
+	return ls
+}
+
+// get returns the bucket of client for path, or nil if path is unlimited.
+// Buckets hold one second's worth of tokens.
+func (ls *limiterSet) get(path, client string) (*rate.Limiter, string) {
+	group, best := "", -1
+	for prefix := range ls.groups {
+		if len(prefix) > best && strings.HasPrefix(path, prefix) {
+			group, best = prefix, len(prefix)
+		}
+	}
+	if best < 0 {
+		return nil, ""
+	}
+
+	now := time.Now()
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if now.Sub(ls.swept) > sweepInterval {
+		for k, l := range ls.buckets {
+			if l.TokensAt(now) >= float64(l.Burst()) {
+				delete(ls.buckets, k)
+			}
+		}
+		ls.swept = now
+	}
+	k := bucketKey{group, client}
+	l := ls.buckets[k]
+	if l == nil {
+		limit := ls.groups[group]
+		l = rate.NewLimiter(limit, max(1, int(math.Ceil(float64(limit)))))
+		ls.buckets[k] = l
+	}
+	return l, group
+}
+
+// rateLimiter caps requests per second and shapes body bytes per second for
+// each client, known by the identity of its token or else by its address.
+type rateLimiter struct {
+	authChecker     AuthCheck
+	requests, bytes *limiterSet
+}
+
+// newRateLimiter takes the limits by path prefix; "/" covers everything
+// without a more specific entry.
+func newRateLimiter(authChecker AuthCheck, requests map[string]float64, bytes map[string]int64) *rateLimiter {
+	return &rateLimiter{authChecker: authChecker, requests: newLimiterSet(requests), bytes: newLimiterSet(bytes)}
+}
+
+// unlimitedPaths are the probes and metrics, which must answer however busy
+// the client asking is.
+var unlimitedPaths = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+// clientKey names the bucket owner. Only valid tokens count: anything else
+// would let a client get a fresh bucket with every made-up token. Without
+// auth configured every token is valid, so none of them count.
+func (rl *rateLimiter) clientKey(r *http.Request) string {
+	if token := tokenFromHeader(r); token != "" {
+		ctx := r.Context()
+		open, _ := rl.authChecker.Check(ctx, "", pb.AuthAction_A_READ, "")
+		if valid, _ := rl.authChecker.Check(ctx, token, pb.AuthAction_A_READ, ""); valid && !open {
+			return "id:" + rl.authChecker.Identify(token)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// wrap refuses requests over their rate with 429 and a Retry-After, and
+// slows down the bodies of those over their bandwidth.
+func (rl *rateLimiter) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unlimitedPaths[r.URL.Path] {
+			h.ServeHTTP(w, r)
+			return
+		}
+		client := rl.clientKey(r)
+		if l, group := rl.requests.get(r.URL.Path, client); l != nil {
+			now := time.Now()
+			res := l.ReserveN(now, 1)
+			if delay := res.DelayFrom(now); delay > 0 {
+				res.CancelAt(now)
+				rateLimited.WithLabelValues(group).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+				http.Error(w, "too many requests", http.StatusTooManyRequests)
+				return
+			}
+		}
+		if l, group := rl.bytes.get(r.URL.Path, client); l != nil {
+			s := shaper{ctx: r.Context(), l: l, group: group}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = &shapedBody{r.Body, s}
+			}
+			w = &shapedWriter{w, s}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+type shaper struct {
+	ctx   context.Context
+	l     *rate.Limiter
+	group string
+}
+
+func (s shaper) wait(n int) error {
+	start := time.Now()
+	err := s.l.WaitN(s.ctx, n)
+	if d := time.Since(start); d >= time.Millisecond {
+		bandwidthThrottled.WithLabelValues(s.group).Add(d.Seconds())
+	}
+	return err
+}
+
+type shapedBody struct {
+	io.ReadCloser
+	s shaper
+}
+
+func (b *shapedBody) Read(p []byte) (int, error) {
+	p = p[:min(len(p), b.s.l.Burst())]
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if werr := b.s.wait(n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+type shapedWriter struct {
+	http.ResponseWriter
+	s shaper
+}
+
+func (w *shapedWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p[:min(len(p), w.s.l.Burst())]
+		if err := w.s.wait(len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+func (w *shapedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
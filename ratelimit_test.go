@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRateLimits(t *testing.T) {
+	rl := newRateLimiter(NewAuthChecker([]string{"a", "b"}, nil, nil), map[string]float64{"/": 100, "/protopackage": 2}, map[string]int64{"/big": 1000})
+	srv := httptest.NewServer(rl.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if r.URL.Path == "/big" {
+			w.Write([]byte(strings.Repeat("x", 1500)))
+		}
+	})))
+	defer srv.Close()
+
+	get := func(path, token string) *http.Response {
+		t.Helper()
+		r := newTestRequest(t, http.MethodGet, srv.URL+path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, _ := doRequest(t, r)
+		return resp
+	}
+
+	before := testutil.ToFloat64(rateLimited.WithLabelValues("/protopackage"))
+	for i := range 2 {
+		if resp := get("/protopackage", "a"); resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: %s", i, resp.Status)
+		}
+	}
+	resp := get("/protopackage", "a")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "1" {
+		t.Errorf("over the limit: %s %v", resp.Status, resp.Header)
+	}
+	if n := testutil.ToFloat64(rateLimited.WithLabelValues("/protopackage")) - before; n != 1 {
+		t.Errorf("%v requests counted as limited", n)
+	}
+	// Other tokens, anonymous clients and other groups have buckets of their own.
+	for _, c := range []struct{ path, token string }{{"/protopackage", "b"}, {"/protopackage", ""}, {"/fs/x", "a"}} {
+		if resp := get(c.path, c.token); resp.StatusCode != http.StatusOK {
+			t.Errorf("%s as %q: %s", c.path, c.token, resp.Status)
+		}
+	}
+	// Made-up tokens share the bucket of the address they come from.
+	if resp := get("/protopackage", "made-up"); resp.StatusCode != http.StatusOK {
+		t.Errorf("second anonymous request: %s", resp.Status)
+	}
+	if resp := get("/protopackage", "made-up-too"); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("fresh invalid token: %s", resp.Status)
+	}
+
+	// A second's burst goes through, the rest of the body at 1000 bytes/s.
+	start := time.Now()
+	get("/big", "a")
+	if d := time.Since(start); d < 400*time.Millisecond {
+		t.Errorf("1500 bytes at 1000 bytes/s took %v", d)
+	}
+	if testutil.ToFloat64(bandwidthThrottled.WithLabelValues("/big")) == 0 {
+		t.Error("no throttling counted")
+	}
+}
+
+func TestRateLimitsSkipProbes(t *testing.T) {
+	rl := newRateLimiter(NewAuthChecker(nil, nil, nil), map[string]float64{"/": 1}, nil)
+	h := rl.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(path string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+	if serve("/fs/a") != http.StatusOK || serve("/fs/a") != http.StatusTooManyRequests {
+		t.Fatal("limit of 1 request/s not applied")
+	}
+	for _, path := range []string{"/healthz", "/readyz", "/metrics"} {
+		if code := serve(path); code != http.StatusOK {
+			t.Errorf("%s: %d", path, code)
+		}
+	}
+}
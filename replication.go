@@ -0,0 +1,565 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/contester/advfiler/protos"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+// Key prefix for local replication state (never replicated itself).
+const prefixReplication byte = 0x08
+
+var (
+	replicationCursorKey   = []byte{prefixReplication, 'c'}
+	replicationPromotedKey = []byte{prefixReplication, 'p'}
+)
+
+// Replication record kinds.
+const (
+	ReplFile     = "file"
+	ReplManifest = "manifest"
+	ReplContest  = "contest"
+	ReplProblem  = "problem"
+	// ReplEnd terminates a complete stream; its Version is the next cursor.
+	ReplEnd = "end"
+)
+
+// ReplicationRecord is one logical change, as streamed from a primary to
+// its replicas. Files carry metadata only; content is fetched by Blake3.
+type ReplicationRecord struct {
+	Kind       string `json:"kind"`
+	Key        string `json:"key,omitempty"`
+	Revision   int64  `json:"revision,omitempty"`
+	Version    uint64 `json:"version"`
+	Deleted    bool   `json:"deleted,omitempty"`
+	Blake3     []byte `json:"blake3,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	ModuleType string `json:"moduleType,omitempty"`
+	Timestamp  int64  `json:"timestamp,omitempty"`
+	Content    []byte `json:"content,omitempty"`
+
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// replicatedPrefixes are the key spaces holding logical state. Blobs follow
+// from file records; audit and replication state stay local.
+var replicatedPrefixes = []byte{prefixDirEntry, prefixManifest, prefixContest, prefixProblem}
+
+// StreamReplication calls fn for every logical record whose latest version
+// is newer than since, in a single consistent snapshot, and returns the
+// snapshot's read timestamp to use as the next since. With since == 0 the
+// stream is a full snapshot and deletions are omitted.
+func (s *Store) StreamReplication(ctx context.Context, since uint64, fn func(ReplicationRecord) error) (uint64, error) {
+	var readTs uint64
+	err := s.view(func(tx *badger.Txn) error {
+		readTs = tx.ReadTs()
+		for _, prefix := range replicatedPrefixes {
+			opts := badger.DefaultIteratorOptions
+			opts.AllVersions = true
+			opts.Prefix = []byte{prefix}
+			opts.SinceTs = since
+			it := tx.NewIterator(opts)
+			var last []byte
+			for it.Rewind(); it.Valid(); it.Next() {
+				if err := ctx.Err(); err != nil {
+					it.Close()
+					return err
+				}
+				item := it.Item()
+				// Versions come newest first; only the latest one counts.
+				if last != nil && bytes.Equal(item.Key(), last) {
+					continue
+				}
+				last = item.KeyCopy(last[:0])
+				if item.Version() <= since {
+					continue
+				}
+				rec, ok, err := replicationRecordFromItem(tx, item)
+				if err != nil {
+					it.Close()
+					return err
+				}
+				if !ok || (rec.Deleted && since == 0) {
+					continue
+				}
+				if err := fn(rec); err != nil {
+					it.Close()
+					return err
+				}
+			}
+			it.Close()
+		}
+		return nil
+	})
+	return readTs, err
+}
+
+func replicationRecordFromItem(tx *badger.Txn, item *badger.Item) (ReplicationRecord, bool, error) {
+	k := item.Key()
+	rec := ReplicationRecord{Version: item.Version(), Deleted: item.IsDeletedOrExpired()}
+	switch k[0] {
+	case prefixDirEntry:
+		path, err := extractPathFromDirMetaKey(k)
+		if err != nil {
+			return rec, false, nil
+		}
+		rec.Kind, rec.Key = ReplFile, path
+	case prefixManifest:
+		rec.Kind, rec.Key = ReplManifest, string(k[1:])
+	case prefixContest:
+		rec.Kind, rec.Key = ReplContest, string(k[1:])
+	case prefixProblem:
+		if len(k) < 10 || k[len(k)-9] != 0x00 {
+			return rec, false, nil
+		}
+		rec.Kind = ReplProblem
+		rec.Key = string(k[1 : len(k)-9])
+		rec.Revision = int64(binary.BigEndian.Uint64(k[len(k)-8:]))
+	default:
+		return rec, false, nil
+	}
+	if rec.Deleted {
+		return rec, true, nil
+	}
+
+	err := item.Value(func(v []byte) error {
+		switch rec.Kind {
+		case ReplFile:
+			var de pb.DirectoryEntry
+			if err := proto.Unmarshal(v, &de); err != nil {
+				return err
+			}
+			rec.ModuleType = de.GetModuleType()
+			rec.Timestamp = de.GetLastModifiedTimestamp()
+			rec.Attributes = de.GetAttributes()
+			rec.Blake3 = de.GetBlake3Hash()
+			if de.HasDigestsAndSize() {
+				rec.Size = de.GetDigestsAndSize().GetSize()
+			} else if len(rec.Blake3) > 0 {
+				das, err := getProto[pb.DigestsAndSize](tx, blobDigestsKey(rec.Blake3))
+				if err != nil && err != badger.ErrKeyNotFound {
+					return err
+				}
+				rec.Size = das.GetSize()
+			}
+		case ReplManifest:
+			rec.Content = append([]byte(nil), v...)
+		case ReplContest:
+			var cr pb.ContestRecord
+			if err := proto.Unmarshal(v, &cr); err != nil {
+				return err
+			}
+			rec.Content, rec.Timestamp = cr.GetContent(), cr.GetTimestampUnix()
+		case ReplProblem:
+			var pr pb.ProblemRecord
+			if err := proto.Unmarshal(v, &pr); err != nil {
+				return err
+			}
+			rec.Content, rec.Timestamp = pr.GetContent(), pr.GetTimestampUnix()
+		}
+		return nil
+	})
+	if err != nil {
+		return rec, false, fmt.Errorf("decoding %q: %w", k, err)
+	}
+	return rec, true, nil
+}
+
+func (s *Store) getReplicationCursor() (uint64, error) {
+	var cursor uint64
+	err := s.view(func(tx *badger.Txn) error {
+		item, err := tx.Get(replicationCursorKey)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			if len(v) == 8 {
+				cursor = binary.BigEndian.Uint64(v)
+			}
+			return nil
+		})
+	})
+	return cursor, err
+}
+
+func (s *Store) setReplicationCursor(cursor uint64) error {
+	var v [8]byte
+	binary.BigEndian.PutUint64(v[:], cursor)
+	return s.update(func(tx *badger.Txn) error {
+		return tx.Set(replicationCursorKey, v[:])
+	})
+}
+
+// IsPromoted reports whether this store was once a replica and got promoted,
+// in which case it must not go back to following its old primary.
+func (s *Store) IsPromoted() (bool, error) {
+	err := s.view(func(tx *badger.Txn) error {
+		_, err := tx.Get(replicationPromotedKey)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *Store) setPromoted() error {
+	return s.update(func(tx *badger.Txn) error {
+		return tx.Set(replicationPromotedKey, []byte(strconv.FormatInt(time.Now().Unix(), 10)))
+	})
+}
+
+var (
+	replicaLastSync = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "advfiler_replica_last_sync_timestamp_seconds",
+		Help: "Start time of the last replication pass that caught up with the primary.",
+	})
+	replicaCursor = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "advfiler_replica_cursor_version",
+		Help: "Primary version the replica has caught up to.",
+	})
+	replicaErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "advfiler_replica_errors_total",
+		Help: "Failed replication passes.",
+	})
+	replicaBlobsFetched = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "advfiler_replica_blobs_fetched_total",
+		Help: "Blobs fetched from the primary because the replica lacked them.",
+	})
+
+	// activeReplica feeds the lag gauge; nil when not following a primary.
+	activeReplica atomic.Pointer[Replica]
+)
+
+func init() {
+	prometheus.MustRegister(replicaLastSync, replicaCursor, replicaErrors, replicaBlobsFetched,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "advfiler_replica_lag_seconds",
+			Help: "Time since the replica last caught up with the primary.",
+		}, func() float64 {
+			if r := activeReplica.Load(); r != nil {
+				return r.lag()
+			}
+			return 0
+		}))
+}
+
+// ReplicaConfig configures a Replica.
+type ReplicaConfig struct {
+	// Primary is the primary's base URL, e.g. http://primary:8080/.
+	Primary   string
+	AuthToken string
+	// Interval between incremental passes.
+	Interval time.Duration
+	// ResyncInterval between full passes, which also catch deletions whose
+	// tombstones the primary has already compacted away.
+	ResyncInterval time.Duration
+	Client         *http.Client
+}
+
+// Replica follows a primary over HTTP, keeping the store read-only for
+// everyone else until it is promoted.
+type Replica struct {
+	store *Store
+	cfg   ReplicaConfig
+
+	mu       sync.Mutex
+	lastSync time.Time
+
+	stopChan chan struct{}
+	doneChan chan struct{}
+	stopOnce sync.Once
+
+	// promoteMu serializes Promote; promoted is set once it succeeded.
+	promoteMu sync.Mutex
+	promoted  bool
+}
+
+// NewReplica makes the store read-only and starts following the primary.
+func NewReplica(store *Store, cfg ReplicaConfig) *Replica {
+	r := newReplica(store, cfg)
+	activeReplica.Store(r)
+	go r.loop()
+	return r
+}
+
+func newReplica(store *Store, cfg ReplicaConfig) *Replica {
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if !strings.HasSuffix(cfg.Primary, "/") {
+		cfg.Primary += "/"
+	}
+	store.SetReadOnly(true)
+	r := &Replica{
+		store:    store,
+		cfg:      cfg,
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+	}
+	return r
+}
+
+func (r *Replica) lag() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lastSync.IsZero() {
+		return 0
+	}
+	return time.Since(r.lastSync).Seconds()
+}
+
+func (r *Replica) loop() {
+	defer close(r.doneChan)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-r.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var lastFull time.Time
+	for {
+		full := r.cfg.ResyncInterval > 0 && time.Since(lastFull) >= r.cfg.ResyncInterval
+		if cursor, err := r.store.getReplicationCursor(); err == nil && cursor == 0 {
+			full = true
+		}
+		if err := r.SyncOnce(ctx, full); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			replicaErrors.Inc()
+			log.Errorf("replication from %s: %v", r.cfg.Primary, err)
+		} else if full {
+			lastFull = time.Now()
+		}
+		select {
+		case <-r.stopChan:
+			return
+		case <-time.After(r.cfg.Interval):
+		}
+	}
+}
+
+// Close stops following the primary. The store stays read-only.
+func (r *Replica) Close() {
+	r.stopOnce.Do(func() { close(r.stopChan) })
+	<-r.doneChan
+}
+
+// Promote stops replication for good and makes the store writable. Once
+// it has succeeded, further calls do nothing.
+func (r *Replica) Promote() error {
+	r.promoteMu.Lock()
+	defer r.promoteMu.Unlock()
+	if r.promoted {
+		return nil
+	}
+	r.Close()
+	if err := r.store.setPromoted(); err != nil {
+		return err
+	}
+	r.promoted = true
+	activeReplica.CompareAndSwap(r, nil)
+	r.store.SetReadOnly(false)
+	return nil
+}
+
+// SyncOnce pulls one batch of changes from the primary. A full pass starts
+// from version 0 and then deletes local files the primary no longer has.
+func (r *Replica) SyncOnce(ctx context.Context, full bool) error {
+	started := time.Now()
+	ctx = withReplicationWrite(WithAuditActor(ctx, AuditActor{Identity: "replication", RemoteAddr: r.cfg.Primary}))
+
+	since := uint64(0)
+	if !full {
+		var err error
+		if since, err = r.store.getReplicationCursor(); err != nil {
+			return err
+		}
+	}
+	resp, err := r.get(ctx, "replication/log?since="+strconv.FormatUint(since, 10))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var seen map[string]struct{}
+	if full {
+		seen = make(map[string]struct{})
+	}
+	var next uint64
+	complete := false
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 256<<20)
+	for scanner.Scan() {
+		var rec ReplicationRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("decoding replication record: %w", err)
+		}
+		if rec.Kind == ReplEnd {
+			next, complete = rec.Version, true
+			break
+		}
+		if seen != nil && rec.Kind == ReplFile {
+			seen[rec.Key] = struct{}{}
+		}
+		if err := r.apply(ctx, rec); err != nil {
+			return fmt.Errorf("applying %s %q: %w", rec.Kind, rec.Key, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if !complete {
+		return errors.New("replication stream ended early")
+	}
+
+	if full {
+		local, err := r.store.List(ctx, "")
+		if err != nil {
+			return err
+		}
+		for _, path := range local {
+			if _, ok := seen[path]; ok {
+				continue
+			}
+			if err := r.store.Delete(ctx, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := r.store.setReplicationCursor(next); err != nil {
+		return err
+	}
+	replicaCursor.Set(float64(next))
+	replicaLastSync.Set(float64(started.Unix()))
+	r.mu.Lock()
+	r.lastSync = started
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Replica) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.cfg.Primary+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.cfg.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+r.cfg.AuthToken)
+	}
+	resp, err := r.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return resp, nil
+}
+
+func (r *Replica) apply(ctx context.Context, rec ReplicationRecord) error {
+	switch rec.Kind {
+	case ReplFile:
+		if rec.Deleted {
+			return r.store.Delete(ctx, rec.Key)
+		}
+		return r.applyFile(ctx, rec)
+	case ReplManifest:
+		if rec.Deleted {
+			return nil
+		}
+		if cur, err := r.store.GetManifest(ctx, rec.Key); err == nil && bytes.Equal(cur, rec.Content) {
+			return nil
+		}
+		return r.store.SetManifest(ctx, rec.Key, rec.Content)
+	case ReplContest:
+		if rec.Deleted {
+			return nil
+		}
+		if cur, ts, err := r.store.GetContest(ctx, rec.Key); err == nil && ts == rec.Timestamp && bytes.Equal(cur, rec.Content) {
+			return nil
+		}
+		return r.store.SetContest(ctx, rec.Key, rec.Content, rec.Timestamp)
+	case ReplProblem:
+		if rec.Deleted {
+			return nil
+		}
+		if cur, ts, err := r.store.GetProblem(ctx, rec.Key, rec.Revision); err == nil && ts == rec.Timestamp && bytes.Equal(cur, rec.Content) {
+			return nil
+		}
+		return r.store.SetProblem(ctx, rec.Key, rec.Revision, rec.Content, rec.Timestamp)
+	}
+	return nil
+}
+
+func (r *Replica) applyFile(ctx context.Context, rec ReplicationRecord) error {
+	if cur, err := r.store.Stat(ctx, rec.Key); err == nil && bytes.Equal(cur.Digests.Blake3, rec.Blake3) &&
+		cur.ModuleType == rec.ModuleType && cur.LastModifiedTimestamp == rec.Timestamp &&
+		maps.Equal(cur.Attributes, rec.Attributes) {
+		return nil
+	}
+	fi := FileInfo{
+		Name:          rec.Key,
+		ModuleType:    rec.ModuleType,
+		ContentLength: rec.Size,
+		TimestampUnix: rec.Timestamp,
+		Attributes:    rec.Attributes,
+	}
+	if len(rec.Blake3) == 0 {
+		_, err := r.store.Upload(ctx, fi, bytes.NewReader(nil))
+		return err
+	}
+	fi.RecvDigests.Blake3 = rec.Blake3
+
+	var data []byte
+	err := r.store.ReadBlob(ctx, rec.Blake3, func(dr DownloadResult) error {
+		var err error
+		data, err = io.ReadAll(dr.Body)
+		return err
+	})
+	if err == nil {
+		_, err = r.store.Upload(ctx, fi, bytes.NewReader(data))
+		return err
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	resp, err := r.get(ctx, "replication/blob/"+hex.EncodeToString(rec.Blake3))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	replicaBlobsFetched.Inc()
+	_, err = r.store.Upload(ctx, fi, resp.Body)
+	return err
+}
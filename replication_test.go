@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestPrimary(t *testing.T) (*Store, *httptest.Server) {
+	t.Helper()
+	s := newTestStore(t)
+	rs := NewReplicationServer(s, NewAuthChecker(nil, []string{"repl"}, nil), nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/replication/log", rs.handleLog)
+	mux.HandleFunc("/replication/blob/", rs.handleBlob)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func readFile(t *testing.T, s *Store, path string) string {
+	t.Helper()
+	var got string
+	err := s.Download(context.Background(), path, func(dr DownloadResult) error {
+		b, err := io.ReadAll(dr.Body)
+		got = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	return got
+}
+
+func TestReplication(t *testing.T) {
+	primary, srv := newTestPrimary(t)
+	replicaStore := newTestStore(t)
+	r := newReplica(replicaStore, ReplicaConfig{Primary: srv.URL, AuthToken: "repl"})
+	ctx := context.Background()
+
+	big := strings.Repeat("b", 1000)
+	for path, content := range map[string]string{
+		"p/a": "alpha", "p/b": big, "p/c": big, "p/empty": "",
+	} {
+		if _, err := primary.Upload(ctx, FileInfo{Name: path, ModuleType: "txt"}, strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := primary.SetManifest(ctx, "m/1", []byte(`{"id":"m"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.SetContest(ctx, "c", []byte("<contest/>"), 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.SetProblem(ctx, "pr", 7, []byte("<problem/>"), 200); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.SyncOnce(ctx, true); err != nil {
+		t.Fatalf("full sync: %v", err)
+	}
+	for path, want := range map[string]string{"p/a": "alpha", "p/b": big, "p/c": big, "p/empty": ""} {
+		if got := readFile(t, replicaStore, path); got != want {
+			t.Errorf("%s: expected %d bytes, got %d", path, len(want), len(got))
+		}
+	}
+	if st, err := replicaStore.Stat(ctx, "p/a"); err != nil || st.ModuleType != "txt" {
+		t.Errorf("module type not replicated: %+v %v", st, err)
+	}
+	if m, err := replicaStore.GetManifest(ctx, "m/1"); err != nil || string(m) != `{"id":"m"}` {
+		t.Errorf("manifest not replicated: %q %v", m, err)
+	}
+	if c, ts, err := replicaStore.GetContest(ctx, "c"); err != nil || string(c) != "<contest/>" || ts != 100 {
+		t.Errorf("contest not replicated: %q %d %v", c, ts, err)
+	}
+	if p, ts, err := replicaStore.GetProblem(ctx, "pr", 7); err != nil || string(p) != "<problem/>" || ts != 200 {
+		t.Errorf("problem not replicated: %q %d %v", p, ts, err)
+	}
+
+	// Incremental pass: an overwrite, a delete and a new path whose content
+	// the replica already has.
+	if _, err := primary.Upload(ctx, FileInfo{Name: "p/a"}, strings.NewReader("alpha2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.Delete(ctx, "p/c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := primary.Upload(ctx, FileInfo{Name: "p/d"}, strings.NewReader(big)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SyncOnce(ctx, false); err != nil {
+		t.Fatalf("incremental sync: %v", err)
+	}
+	if got := readFile(t, replicaStore, "p/a"); got != "alpha2" {
+		t.Errorf("overwrite not replicated: %q", got)
+	}
+	if got := readFile(t, replicaStore, "p/d"); got != big {
+		t.Error("new path not replicated")
+	}
+	if _, err := replicaStore.Stat(ctx, "p/c"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("delete not replicated: %v", err)
+	}
+}
+
+func TestReplicaReadOnlyAndPromote(t *testing.T) {
+	_, srv := newTestPrimary(t)
+	s := newTestStore(t)
+	r := NewReplica(s, ReplicaConfig{Primary: srv.URL, AuthToken: "repl", Interval: time.Hour})
+	ctx := context.Background()
+
+	if _, err := s.Upload(ctx, FileInfo{Name: "x"}, strings.NewReader("x")); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+	if err := s.SetManifest(ctx, "m", nil); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+	// Promotions racing each other and shutdown must not close the replica twice.
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- r.Promote()
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.Close()
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Upload(ctx, FileInfo{Name: "x"}, strings.NewReader("x")); err != nil {
+		t.Fatalf("upload after promote: %v", err)
+	}
+	if promoted, err := s.IsPromoted(); err != nil || !promoted {
+		t.Errorf("promotion not persisted: %v %v", promoted, err)
+	}
+}
+
+func TestReplicationFullSyncDeletesExtras(t *testing.T) {
+	primary, srv := newTestPrimary(t)
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	if _, err := s.Upload(ctx, FileInfo{Name: "stale"}, strings.NewReader("old")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := primary.Upload(ctx, FileInfo{Name: "fresh"}, strings.NewReader("new")); err != nil {
+		t.Fatal(err)
+	}
+	r := newReplica(s, ReplicaConfig{Primary: srv.URL, AuthToken: "repl"})
+	if err := r.SyncOnce(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	names, err := s.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "fresh" {
+		t.Errorf("expected only fresh, got %v", names)
+	}
+}
+
+func TestReplicationRequiresAuth(t *testing.T) {
+	_, srv := newTestPrimary(t)
+	r := newReplica(newTestStore(t), ReplicaConfig{Primary: srv.URL, AuthToken: "wrong"})
+	if err := r.SyncOnce(context.Background(), true); err == nil {
+		t.Fatal("expected sync with a bad token to fail")
+	}
+}
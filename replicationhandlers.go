@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/contester/advfiler/hashes"
+	pb "github.com/contester/advfiler/protos"
+)
+
+type replicationServer struct {
+	store       *Store
+	authChecker AuthCheck
+	replica     *Replica
+}
+
+func NewReplicationServer(store *Store, authChecker AuthCheck, replica *Replica) *replicationServer {
+	return &replicationServer{store: store, authChecker: authChecker, replica: replica}
+}
+
+// handleLog serves GET /replication/log?since=N as JSON lines, ending with
+// an "end" record carrying the cursor for the next request.
+func (x *replicationServer) handleLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	if v, _ := x.authChecker.Check(r.Context(), tokenFromHeader(r), pb.AuthAction_A_ADMIN, ""); !v {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var since uint64
+	if v := r.URL.Query().Get("since"); v != "" {
+		var err error
+		if since, err = strconv.ParseUint(v, 10, 64); err != nil {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	next, err := x.store.StreamReplication(r.Context(), since, func(rec ReplicationRecord) error {
+		return enc.Encode(&rec)
+	})
+	if err != nil {
+		// Without the end record the replica discards this pass.
+		requestLog(r.Context()).Errorf("replication log: %v", err)
+		return
+	}
+	enc.Encode(&ReplicationRecord{Kind: ReplEnd, Version: next})
+}
+
+// handleBlob serves GET /replication/blob/<blake3 hex>.
+func (x *replicationServer) handleBlob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	if v, _ := x.authChecker.Check(r.Context(), tokenFromHeader(r), pb.AuthAction_A_ADMIN, ""); !v {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	hash, err := hex.DecodeString(strings.TrimPrefix(r.URL.Path, "/replication/blob/"))
+	if err != nil || len(hash) != 32 {
+		http.Error(w, "invalid hash", http.StatusBadRequest)
+		return
+	}
+	err = x.store.ReadBlob(r.Context(), hash, func(dr DownloadResult) error {
+		w.Header().Set("Content-Length", strconv.FormatInt(dr.Size, 10))
+		hashes.AddDigests(w.Header(), dr.Digests)
+		_, err := io.Copy(w, dr.Body)
+		return err
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		requestLog(r.Context()).Errorf("replication blob %x: %v", hash, err)
+	}
+}
+
+// handlePromote serves POST /replication/promote on a replica.
+func (x *replicationServer) handlePromote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	if v, _ := x.authChecker.Check(r.Context(), tokenFromHeader(r), pb.AuthAction_A_ADMIN, ""); !v {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if x.replica == nil {
+		http.Error(w, "not a replica", http.StatusConflict)
+		return
+	}
+	if err := x.replica.Promote(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	requestLog(r.Context()).Infof("promoted to primary by %s", x.authChecker.Identify(tokenFromHeader(r)))
+	fmt.Fprintln(w, "promoted")
+}
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/contester/advfiler/hashes"
+	pb "github.com/contester/advfiler/protos"
+	log "github.com/sirupsen/logrus"
+)
+
+// The S3 API maps bucket B to the top-level directory B/ of the store and
+// object key K to the path B/K. Buckets exist as long as they have files;
+// CreateBucket is accepted and does nothing. Only path-style addressing
+// (http://host/s3/bucket/key) is supported.
+
+const s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// s3TimeFormat is what S3 uses for timestamps in XML bodies.
+const s3TimeFormat = "2006-01-02T15:04:05.000Z"
+
+type s3Server struct {
+	store       *Store
+	authChecker AuthCheck
+	urlPrefix   string
+	// keys maps access key IDs to secret keys. A secret is also the
+	// advfiler token the request is authorized as.
+	keys map[string]string
+	now  func() time.Time
+}
+
+func NewS3Server(store *Store, authChecker AuthCheck, keys map[string]string) *s3Server {
+	return &s3Server{
+		store:       store,
+		authChecker: authChecker,
+		urlPrefix:   "/s3/",
+		keys:        keys,
+		now:         time.Now,
+	}
+}
+
+var (
+	errNoSuchKey      = &s3Error{"NoSuchKey", http.StatusNotFound, "The specified key does not exist."}
+	errNotImplemented = &s3Error{"NotImplemented", http.StatusNotImplemented,
+		"A header or query you provided implies functionality that is not implemented."}
+)
+
+func invalidArgument(format string, args ...any) error {
+	return &s3Error{"InvalidArgument", http.StatusBadRequest, fmt.Sprintf(format, args...)}
+}
+
+// s3ErrorFrom converts Store and auth errors to their S3 equivalents.
+func s3ErrorFrom(err error) *s3Error {
+	if se, ok := errIsS3(err); ok {
+		return se
+	}
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return errNoSuchKey
+	case errors.Is(err, errUnauthorized), errors.Is(err, ErrReadOnly):
+		return errAccessDenied
+	case errors.Is(err, hashes.ErrDigestMismatch):
+		return &s3Error{"BadDigest", http.StatusBadRequest, err.Error()}
+	case errors.Is(err, errInvalidAttributes):
+		return &s3Error{"InvalidArgument", http.StatusBadRequest, err.Error()}
+	case errors.Is(err, errLengthMismatch):
+		return &s3Error{"IncompleteBody", http.StatusBadRequest, err.Error()}
+	case errors.Is(err, ErrTooLarge):
+		return &s3Error{"EntityTooLarge", http.StatusRequestEntityTooLarge, err.Error()}
+	case errors.Is(err, ErrOverloaded):
+		return &s3Error{"SlowDown", http.StatusServiceUnavailable, err.Error()}
+	case errors.Is(err, ErrMaintenance):
+		return &s3Error{"ServiceUnavailable", http.StatusServiceUnavailable, err.Error()}
+	}
+	return &s3Error{"InternalError", http.StatusInternalServerError, err.Error()}
+}
+
+type s3ErrorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string
+	Message   string
+	Resource  string
+	RequestId string
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header)
+	if err := xml.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("s3: writing response: %v", err)
+	}
+}
+
+func s3ETag(d hashes.Digests) string {
+	return `"` + hex.EncodeToString(d.MD5) + `"`
+}
+
+// s3Request is an authenticated S3 request.
+type s3Request struct {
+	*http.Request
+	ctx         context.Context
+	auth        *sigV4Auth
+	bucket, key string
+}
+
+func (s *s3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rid := requestID(r)
+	w.Header().Set("X-Amz-Request-Id", rid)
+	err := s.serve(w, r, rid)
+	if err == nil {
+		return
+	}
+	se := s3ErrorFrom(err)
+	if se.Status == http.StatusInternalServerError {
+		requestLog(r.Context()).Errorf("s3: %s %s: %v", r.Method, r.URL.Path, err)
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(se.Status)
+		return
+	}
+	writeXML(w, se.Status, &s3ErrorResponse{
+		Code:      se.Code,
+		Message:   se.Message,
+		Resource:  r.URL.Path,
+		RequestId: rid,
+	})
+}
+
+func (s *s3Server) serve(w http.ResponseWriter, r *http.Request, rid string) error {
+	path := r.URL.Path
+	if path+"/" == s.urlPrefix {
+		// The service root, without the trailing slash.
+		path = s.urlPrefix
+	}
+	rest, err := trimOr(path, s.urlPrefix, "s3 url")
+	if err != nil {
+		return &s3Error{"InvalidURI", http.StatusBadRequest, err.Error()}
+	}
+	auth, err := verifySigV4(r, s.keys, s.now())
+	if err != nil {
+		return err
+	}
+	req := &s3Request{
+		Request: r,
+		auth:    auth,
+		ctx: WithAuditActor(r.Context(), AuditActor{
+			Identity:   s.authChecker.Identify(auth.Secret),
+			RemoteAddr: r.RemoteAddr,
+			RequestID:  rid,
+		}),
+	}
+	req.bucket, req.key, _ = strings.Cut(rest, "/")
+
+	q := r.URL.Query()
+	switch {
+	case req.bucket == "":
+		if r.Method != http.MethodGet {
+			return errNotImplemented
+		}
+		return s.listBuckets(w, req)
+	case req.key == "":
+		switch r.Method {
+		case http.MethodGet:
+			if q.Get("list-type") != "2" {
+				return errNotImplemented
+			}
+			return s.listObjects(w, req)
+		case http.MethodHead, http.MethodPut:
+			if err := s.authorize(req, pb.AuthAction_A_READ, req.bucket+"/"); err != nil {
+				return err
+			}
+			return nil
+		}
+	default:
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			return s.getObject(w, req)
+		case http.MethodPut:
+			if r.Header.Get("X-Amz-Copy-Source") != "" {
+				return s.copyObject(w, req)
+			}
+			return s.putObject(w, req)
+		case http.MethodDelete:
+			return s.deleteObject(w, req)
+		}
+	}
+	return errNotImplemented
+}
+
+func (s *s3Server) authorize(req *s3Request, action pb.AuthAction, path string) error {
+	if v, _ := s.authChecker.Check(req.ctx, req.auth.Secret, action, path); !v {
+		return errAccessDenied
+	}
+	return nil
+}
+
+type s3Bucket struct {
+	Name         string
+	CreationDate string
+}
+
+type s3ListBucketsResult struct {
+	XMLName xml.Name   `xml:"ListAllMyBucketsResult"`
+	Xmlns   string     `xml:"xmlns,attr"`
+	Owner   s3Owner    `xml:"Owner"`
+	Buckets []s3Bucket `xml:"Buckets>Bucket"`
+}
+
+type s3Owner struct {
+	ID          string
+	DisplayName string
+}
+
+func (s *s3Server) listBuckets(w http.ResponseWriter, req *s3Request) error {
+	if err := s.authorize(req, pb.AuthAction_A_READ, ""); err != nil {
+		return err
+	}
+	names, err := s.store.List(req.ctx, "")
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	var buckets []string
+	for _, n := range names {
+		b, _, ok := strings.Cut(n, "/")
+		if ok && b != "" && !seen[b] {
+			seen[b] = true
+			buckets = append(buckets, b)
+		}
+	}
+	sort.Strings(buckets)
+	result := s3ListBucketsResult{
+		Xmlns: s3Namespace,
+		Owner: s3Owner{ID: "advfiler", DisplayName: "advfiler"},
+	}
+	created := time.Unix(0, 0).UTC().Format(s3TimeFormat)
+	for _, b := range buckets {
+		result.Buckets = append(result.Buckets, s3Bucket{Name: b, CreationDate: created})
+	}
+	writeXML(w, http.StatusOK, &result)
+	return nil
+}
+
+type s3Object struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type s3Prefix struct {
+	Prefix string
+}
+
+type s3ListObjectsResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Xmlns                 string   `xml:"xmlns,attr"`
+	Name                  string
+	Prefix                string
+	Delimiter             string `xml:",omitempty"`
+	StartAfter            string `xml:",omitempty"`
+	ContinuationToken     string `xml:",omitempty"`
+	NextContinuationToken string `xml:",omitempty"`
+	EncodingType          string `xml:",omitempty"`
+	MaxKeys               int
+	KeyCount              int
+	IsTruncated           bool
+	Contents              []s3Object
+	CommonPrefixes        []s3Prefix
+}
+
+const s3MaxKeys = 1000
+
+func (s *s3Server) listObjects(w http.ResponseWriter, req *s3Request) error {
+	q := req.URL.Query()
+	prefix, delim := q.Get("prefix"), q.Get("delimiter")
+	if err := s.authorize(req, pb.AuthAction_A_READ, req.bucket+"/"+prefix); err != nil {
+		return err
+	}
+	maxKeys := s3MaxKeys
+	if v := q.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return invalidArgument("invalid max-keys %q", v)
+		}
+		maxKeys = min(n, s3MaxKeys)
+	}
+	encodeKey := func(k string) string { return k }
+	switch et := q.Get("encoding-type"); et {
+	case "":
+	case "url":
+		encodeKey = func(k string) string { return uriEncode(k, false) }
+	default:
+		return invalidArgument("invalid encoding-type %q", et)
+	}
+
+	// Continuation tokens are the base64 of the last key or common prefix
+	// returned, so listing resumes right after it.
+	marker := q.Get("start-after")
+	if token := q.Get("continuation-token"); token != "" {
+		b, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			return invalidArgument("invalid continuation token")
+		}
+		marker = string(b)
+	}
+
+	root := req.bucket + "/"
+	names, err := s.store.List(req.ctx, root+prefix)
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	result := s3ListObjectsResult{
+		Xmlns:             s3Namespace,
+		Name:              req.bucket,
+		Prefix:            encodeKey(prefix),
+		Delimiter:         encodeKey(delim),
+		StartAfter:        encodeKey(q.Get("start-after")),
+		ContinuationToken: q.Get("continuation-token"),
+		EncodingType:      q.Get("encoding-type"),
+		MaxKeys:           maxKeys,
+	}
+	var last string
+	for _, n := range names {
+		key := strings.TrimPrefix(n, root)
+		if key <= marker {
+			continue
+		}
+		var cp string
+		if delim != "" {
+			if i := strings.Index(key[len(prefix):], delim); i >= 0 {
+				cp = key[:len(prefix)+i+len(delim)]
+				if cp == last || cp == marker {
+					continue
+				}
+			}
+		}
+		if result.KeyCount == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		result.KeyCount++
+		if cp != "" {
+			last = cp
+			result.CommonPrefixes = append(result.CommonPrefixes, s3Prefix{encodeKey(cp)})
+			continue
+		}
+		last = key
+		st, err := s.store.Stat(req.ctx, n)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Deleted since List.
+			result.KeyCount--
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		result.Contents = append(result.Contents, s3Object{
+			Key:          encodeKey(key),
+			LastModified: time.Unix(st.LastModifiedTimestamp, 0).UTC().Format(s3TimeFormat),
+			ETag:         s3ETag(st.Digests),
+			Size:         st.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+	if result.IsTruncated {
+		result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+	}
+	writeXML(w, http.StatusOK, &result)
+	return nil
+}
+
+func (s *s3Server) getObject(w http.ResponseWriter, req *s3Request) error {
+	path := req.bucket + "/" + req.key
+	if err := s.authorize(req, pb.AuthAction_A_READ, path); err != nil {
+		return err
+	}
+	return s.store.Download(req.ctx, path, func(result DownloadResult) error {
+		h := w.Header()
+		h.Set("ETag", s3ETag(result.Digests))
+		h.Set("Content-Type", "binary/octet-stream")
+		if result.ModuleType != "" {
+			h.Set("X-Amz-Meta-Module-Type", result.ModuleType)
+		}
+		for k, v := range result.Attributes {
+			h.Set("X-Amz-Meta-"+k, v)
+		}
+		http.ServeContent(w, req.Request, "", time.Unix(result.LastModifiedTimestamp, 0), result.Body)
+		return nil
+	})
+}
+
+// putBody returns the request payload, decoding aws-chunked transfers, and
+// the SHA-256 the client signed, if any.
+func putBody(req *s3Request) (io.Reader, []byte, error) {
+	switch ph := req.auth.PayloadHash; ph {
+	case unsignedPayload:
+		return req.Body, nil, nil
+	case streamingPayload:
+		return newAWSChunkedReader(req.Body, req.auth), nil, nil
+	case streamingUnsignedPayload:
+		return newAWSChunkedReader(req.Body, nil), nil, nil
+	default:
+		if strings.HasPrefix(ph, "STREAMING-") {
+			return nil, nil, errNotImplemented
+		}
+		sum, err := hex.DecodeString(ph)
+		if err != nil || len(sum) != 32 {
+			return nil, nil, &s3Error{"XAmzContentSHA256Mismatch", http.StatusBadRequest,
+				"invalid x-amz-content-sha256"}
+		}
+		return req.Body, sum, nil
+	}
+}
+
+func (s *s3Server) putObject(w http.ResponseWriter, req *s3Request) error {
+	path := req.bucket + "/" + req.key
+	if err := s.authorize(req, pb.AuthAction_A_WRITE, path); err != nil {
+		return err
+	}
+	body, sum, err := putBody(req)
+	if err != nil {
+		return err
+	}
+	fi := FileInfo{
+		Name:        path,
+		ModuleType:  req.Header.Get("X-Amz-Meta-Module-Type"),
+		RecvDigests: hashes.ParseDigests(req.Header),
+		Attributes:  s3Attributes(req.Header),
+	}
+	fi.RecvDigests.SHA256 = sum
+	if req.Header.Get("Content-MD5") != "" && len(fi.RecvDigests.MD5) != md5Size {
+		return &s3Error{"InvalidDigest", http.StatusBadRequest, "The Content-MD5 you specified is not valid."}
+	}
+	fi.ContentLength = req.ContentLength
+	if v := req.Header.Get("X-Amz-Decoded-Content-Length"); v != "" {
+		if fi.ContentLength, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return invalidArgument("invalid x-amz-decoded-content-length")
+		}
+	}
+	st, err := s.store.Upload(req.ctx, fi, body)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("ETag", s3ETag(hashes.DigestsFromMap(st.Digests)))
+	return nil
+}
+
+const md5Size = 16
+
+// s3Attributes maps x-amz-meta-* headers, other than the module type, to
+// file attributes.
+func s3Attributes(h http.Header) map[string]string {
+	var attrs map[string]string
+	for k, v := range h {
+		name, ok := strings.CutPrefix(http.CanonicalHeaderKey(k), "X-Amz-Meta-")
+		if !ok || name == "Module-Type" || len(v) == 0 || v[0] == "" {
+			continue
+		}
+		if attrs == nil {
+			attrs = make(map[string]string)
+		}
+		attrs[strings.ToLower(name)] = v[0]
+	}
+	return attrs
+}
+
+type s3CopyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	LastModified string
+	ETag         string
+}
+
+func (s *s3Server) copyObject(w http.ResponseWriter, req *s3Request) error {
+	src := req.Header.Get("X-Amz-Copy-Source")
+	src, _, _ = strings.Cut(src, "?")
+	src, err := url.PathUnescape(strings.TrimPrefix(src, "/"))
+	if err != nil || !strings.Contains(src, "/") {
+		return invalidArgument("invalid x-amz-copy-source")
+	}
+	dst := req.bucket + "/" + req.key
+	if err := s.authorize(req, pb.AuthAction_A_READ, src); err != nil {
+		return err
+	}
+	if err := s.authorize(req, pb.AuthAction_A_WRITE, dst); err != nil {
+		return err
+	}
+
+	// Read the source in full before writing: Upload must not run inside
+	// the Download transaction.
+	var data []byte
+	fi := FileInfo{Name: dst}
+	err = s.store.Download(req.ctx, src, func(result DownloadResult) error {
+		fi.ModuleType, fi.Attributes = result.ModuleType, result.Attributes
+		var err error
+		data, err = io.ReadAll(result.Body)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if req.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+		fi.ModuleType = req.Header.Get("X-Amz-Meta-Module-Type")
+		fi.Attributes = s3Attributes(req.Header)
+	}
+	fi.ContentLength = int64(len(data))
+	st, err := s.store.Upload(req.ctx, fi, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	writeXML(w, http.StatusOK, &s3CopyObjectResult{
+		LastModified: s.now().UTC().Format(s3TimeFormat),
+		ETag:         s3ETag(hashes.DigestsFromMap(st.Digests)),
+	})
+	return nil
+}
+
+func (s *s3Server) deleteObject(w http.ResponseWriter, req *s3Request) error {
+	path := req.bucket + "/" + req.key
+	if err := s.authorize(req, pb.AuthAction_A_WRITE, path); err != nil {
+		return err
+	}
+	if err := s.store.Delete(req.ctx, path); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+// cutoffGrace is how long requests cut off by shutdown get to notice before
+// the Store is closed under them.
+const cutoffGrace = 5 * time.Second
+
+// inflight tracks the HTTP requests and gRPC calls being served, so shutdown
+// can wait for them and name the ones it had to cut off.
+type inflight struct {
+	mu    sync.Mutex
+	calls map[*inflightCall]struct{}
+	idle  chan struct{} // closed when calls becomes empty
+}
+
+type inflightCall struct {
+	requestID, method, path string
+	start                   time.Time
+}
+
+func newInflight() *inflight {
+	return &inflight{calls: make(map[*inflightCall]struct{})}
+}
+
+func (t *inflight) enter(c *inflightCall) func() {
+	t.mu.Lock()
+	t.calls[c] = struct{}{}
+	t.mu.Unlock()
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.calls, c)
+		if len(t.calls) == 0 && t.idle != nil {
+			close(t.idle)
+			t.idle = nil
+		}
+	}
+}
+
+// wait returns once nothing is in flight, or ctx's error.
+func (t *inflight) wait(ctx context.Context) error {
+	t.mu.Lock()
+	if len(t.calls) == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	if t.idle == nil {
+		t.idle = make(chan struct{})
+	}
+	idle := t.idle
+	t.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// logRemaining logs whatever is still in flight and returns how many.
+func (t *inflight) logRemaining(what string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for c := range t.calls {
+		e := log.NewEntry(log.StandardLogger())
+		if c.requestID != "" {
+			e = e.WithField("request_id", c.requestID)
+		}
+		e.Warnf("%s: %s %s, running for %v", what, c.method, c.path, time.Since(c.start).Round(time.Millisecond))
+	}
+	return len(t.calls)
+}
+
+func (t *inflight) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer t.enter(&inflightCall{requestID: requestID(r), method: r.Method, path: r.URL.Path, start: time.Now()})()
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (t *inflight) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	defer t.enter(&inflightCall{method: "gRPC", path: info.FullMethod, start: time.Now()})()
+	return handler(ctx, req)
+}
+
+func (t *inflight) stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	defer t.enter(&inflightCall{method: "gRPC", path: info.FullMethod, start: time.Now()})()
+	return handler(srv, ss)
+}
+
+// shutdown stops srv and gs (which may be nil) taking new work and gives
+// what's in flight timeout to finish. Whatever is left then is logged and
+// cut off by cancelBase, the base context of srv's requests, and closing
+// the connections. It returns when nothing is in flight any more, or after
+// cutoffGrace if something won't stop.
+func shutdown(srv *http.Server, cancelBase context.CancelFunc, gs *grpc.Server, calls *inflight, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	grpcDone := make(chan struct{})
+	if gs != nil {
+		go func() {
+			gs.GracefulStop()
+			close(grpcDone)
+		}()
+	} else {
+		close(grpcDone)
+	}
+	if err := srv.Shutdown(ctx); err == nil {
+		select {
+		case <-grpcDone:
+			return
+		case <-ctx.Done():
+		}
+	}
+
+	n := calls.logRemaining("cut off by shutdown")
+	log.Warnf("shutdown: cutting off %d requests after %v", n, timeout)
+	cancelBase()
+	srv.Close()
+	if gs != nil {
+		gs.Stop()
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), cutoffGrace)
+	defer cancel()
+	if calls.wait(ctx) != nil {
+		calls.logRemaining("still running as the store closes")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestShutdown(t *testing.T) {
+	calls := newInflight()
+	started := make(chan struct{}, 2)
+	handlerDone := make(chan struct{})
+	srv := &http.Server{Handler: calls.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(100 * time.Millisecond)
+			io.WriteString(w, "done")
+		case "/stuck":
+			<-r.Context().Done()
+			close(handlerDone)
+		}
+	}))}
+	base, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+	srv.BaseContext = func(net.Listener) context.Context { return base }
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	url := "http://" + l.Addr().String()
+
+	slow := make(chan string)
+	go func() {
+		resp, err := http.Get(url + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		slow <- string(b)
+	}()
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, url+"/stuck", nil)
+		req.Header.Set("X-Request-Id", "stuck-id")
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+	<-started
+
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	shutdown(srv, cancelBase, nil, calls, 300*time.Millisecond)
+
+	if got := <-slow; got != "done" {
+		t.Errorf("request finishing within the timeout: %q", got)
+	}
+	select {
+	case <-handlerDone:
+	default:
+		t.Error("shutdown returned with a request still running")
+	}
+	var logged bool
+	for _, e := range hook.AllEntries() {
+		if e.Data["request_id"] == "stuck-id" && strings.Contains(e.Message, "GET /stuck") {
+			logged = true
+		}
+	}
+	if !logged {
+		t.Errorf("cut-off request not logged: %v", hook.AllEntries())
+	}
+	if _, err := http.Get(url + "/slow"); err == nil {
+		t.Error("new request served after shutdown")
+	}
+}
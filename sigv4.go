@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AWS Signature Version 4, as far as S3 clients use it: the Authorization
+// header (no presigned URLs) and aws-chunked payloads.
+
+const (
+	sigV4Algorithm           = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat          = "20060102T150405Z"
+	unsignedPayload          = "UNSIGNED-PAYLOAD"
+	streamingPayload         = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingUnsignedPayload = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+
+	sigV4MaxSkew = 15 * time.Minute
+	// maxAWSChunk bounds the memory a single aws-chunked chunk may take;
+	// clients send 64KiB to a few MiB.
+	maxAWSChunk = 16 << 20
+)
+
+// s3Error is an error with its S3 error code and HTTP status.
+type s3Error struct {
+	Code    string
+	Status  int
+	Message string
+}
+
+func (e *s3Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+var (
+	errAccessDenied      = &s3Error{"AccessDenied", http.StatusForbidden, "Access Denied"}
+	errSignatureMismatch = &s3Error{"SignatureDoesNotMatch", http.StatusForbidden,
+		"The request signature we calculated does not match the signature you provided."}
+)
+
+func malformedAuth(format string, args ...any) error {
+	return &s3Error{"AuthorizationHeaderMalformed", http.StatusBadRequest, fmt.Sprintf(format, args...)}
+}
+
+// sigV4Auth is a verified request signature.
+type sigV4Auth struct {
+	AccessKey, Secret string
+	AmzDate, Scope    string
+	Signature         string
+	PayloadHash       string
+	signingKey        []byte
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// uriEncode percent-encodes everything but unreserved characters, and '/'
+// unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func canonicalQuery(rawQuery string) string {
+	q, _ := url.ParseQuery(rawQuery)
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func canonicalHeaderValue(r *http.Request, name string) string {
+	if name == "host" {
+		return r.Host
+	}
+	// Values is the header map's own slice; normalise a copy.
+	vs := append([]string(nil), r.Header.Values(name)...)
+	if name == "content-length" && len(vs) == 0 && r.ContentLength >= 0 {
+		return strconv.FormatInt(r.ContentLength, 10)
+	}
+	for i, v := range vs {
+		vs[i] = strings.Join(strings.Fields(v), " ")
+	}
+	return strings.Join(vs, ",")
+}
+
+func canonicalRequest(r *http.Request, signedHeaders []string, payloadHash string) string {
+	path := r.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	var b strings.Builder
+	b.WriteString(r.Method + "\n")
+	b.WriteString(uriEncode(path, false) + "\n")
+	b.WriteString(canonicalQuery(r.URL.RawQuery) + "\n")
+	for _, h := range signedHeaders {
+		b.WriteString(h + ":" + canonicalHeaderValue(r, h) + "\n")
+	}
+	b.WriteString("\n" + strings.Join(signedHeaders, ";") + "\n")
+	b.WriteString(payloadHash)
+	return b.String()
+}
+
+func signingKey(secret, scope string) []byte {
+	k := []byte("AWS4" + secret)
+	for _, part := range strings.Split(scope, "/") {
+		k = hmacSHA256(k, part)
+	}
+	return k
+}
+
+// verifySigV4 checks the request's Authorization header against keys, which
+// map access key IDs to secrets.
+func verifySigV4(r *http.Request, keys map[string]string, now time.Time) (*sigV4Auth, error) {
+	ah := r.Header.Get("Authorization")
+	if ah == "" {
+		return nil, errAccessDenied
+	}
+	alg, rest, _ := strings.Cut(ah, " ")
+	if alg != sigV4Algorithm {
+		return nil, malformedAuth("unsupported authorization type %q", alg)
+	}
+	fields := make(map[string]string)
+	for _, f := range strings.Split(rest, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(f), "=")
+		fields[k] = v
+	}
+	cred := strings.SplitN(fields["Credential"], "/", 2)
+	if len(cred) != 2 || fields["SignedHeaders"] == "" || fields["Signature"] == "" {
+		return nil, malformedAuth("the authorization header is malformed")
+	}
+	a := &sigV4Auth{
+		AccessKey:   cred[0],
+		Scope:       cred[1],
+		Signature:   fields["Signature"],
+		AmzDate:     r.Header.Get("X-Amz-Date"),
+		PayloadHash: r.Header.Get("X-Amz-Content-Sha256"),
+	}
+	scope := strings.Split(a.Scope, "/")
+	if len(scope) != 4 || scope[2] != "s3" || scope[3] != "aws4_request" {
+		return nil, malformedAuth("invalid credential scope %q", a.Scope)
+	}
+	secret, ok := keys[a.AccessKey]
+	if !ok {
+		return nil, &s3Error{"InvalidAccessKeyId", http.StatusForbidden,
+			"The AWS Access Key Id you provided does not exist in our records."}
+	}
+	a.Secret = secret
+	var t time.Time
+	var err error
+	dateHeader := "x-amz-date"
+	if a.AmzDate != "" {
+		t, err = time.Parse(sigV4TimeFormat, a.AmzDate)
+	} else {
+		// The Date header is signed as sent.
+		dateHeader = "date"
+		a.AmzDate = r.Header.Get("Date")
+		t, err = http.ParseTime(a.AmzDate)
+	}
+	if err != nil {
+		return nil, &s3Error{"AccessDenied", http.StatusForbidden, "missing or invalid X-Amz-Date"}
+	}
+	if t.UTC().Format("20060102") != scope[0] {
+		return nil, malformedAuth("credential date doesn't match X-Amz-Date")
+	}
+	if d := now.Sub(t); d > sigV4MaxSkew || d < -sigV4MaxSkew {
+		return nil, &s3Error{"RequestTimeTooSkewed", http.StatusForbidden,
+			"The difference between the request time and the current time is too large."}
+	}
+	if a.PayloadHash == "" {
+		return nil, &s3Error{"InvalidRequest", http.StatusBadRequest, "missing x-amz-content-sha256"}
+	}
+
+	// Leaving out host would let the signature be replayed against another
+	// server, and leaving out the date or payload hash would let them change.
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	for _, h := range []string{"host", dateHeader, "x-amz-content-sha256"} {
+		if !slices.Contains(signed, h) {
+			return nil, &s3Error{"AccessDenied", http.StatusForbidden, fmt.Sprintf("%s must be a signed header", h)}
+		}
+	}
+	stringToSign := sigV4Algorithm + "\n" + a.AmzDate + "\n" + a.Scope + "\n" +
+		sha256Hex([]byte(canonicalRequest(r, signed, a.PayloadHash)))
+	a.signingKey = signingKey(secret, a.Scope)
+	want := hex.EncodeToString(hmacSHA256(a.signingKey, stringToSign))
+	if !hmac.Equal([]byte(want), []byte(a.Signature)) {
+		return nil, errSignatureMismatch
+	}
+	return a, nil
+}
+
+// chunkSignature signs one aws-chunked chunk, chained to the previous one.
+func (a *sigV4Auth) chunkSignature(prev string, data []byte) string {
+	stringToSign := sigV4Algorithm + "-PAYLOAD\n" + a.AmzDate + "\n" + a.Scope + "\n" +
+		prev + "\n" + sha256Hex(nil) + "\n" + sha256Hex(data)
+	return hex.EncodeToString(hmacSHA256(a.signingKey, stringToSign))
+}
+
+// awsChunkedReader decodes an aws-chunked body, verifying chunk signatures
+// when auth is set. Trailers are read and ignored.
+type awsChunkedReader struct {
+	r    *bufio.Reader
+	auth *sigV4Auth
+	prev string
+	buf  []byte
+	done bool
+}
+
+func newAWSChunkedReader(r io.Reader, auth *sigV4Auth) *awsChunkedReader {
+	c := &awsChunkedReader{r: bufio.NewReader(r), auth: auth}
+	if auth != nil {
+		c.prev = auth.Signature
+	}
+	return c
+}
+
+func (c *awsChunkedReader) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		if err := c.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+var errBadChunk = &s3Error{"IncompleteBody", http.StatusBadRequest, "malformed aws-chunked body"}
+
+func (c *awsChunkedReader) next() error {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return errBadChunk
+	}
+	sizeStr, ext, _ := strings.Cut(strings.TrimRight(line, "\r\n"), ";")
+	size, err := strconv.ParseInt(sizeStr, 16, 64)
+	if err != nil || size < 0 || size > maxAWSChunk {
+		return errBadChunk
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return errBadChunk
+	}
+	if c.auth != nil {
+		sig, ok := strings.CutPrefix(ext, "chunk-signature=")
+		if !ok || !hmac.Equal([]byte(sig), []byte(c.auth.chunkSignature(c.prev, data))) {
+			return errSignatureMismatch
+		}
+		c.prev = sig
+	}
+	if size == 0 {
+		c.done = true
+		_, err := io.Copy(io.Discard, c.r)
+		return err
+	}
+	if crlf, err := c.r.ReadString('\n'); err != nil || strings.TrimRight(crlf, "\r\n") != "" {
+		return errBadChunk
+	}
+	c.buf = data
+	return nil
+}
+
+// errIsS3 extracts an *s3Error from err's chain.
+func errIsS3(err error) (*s3Error, bool) {
+	var se *s3Error
+	ok := errors.As(err, &se)
+	return se, ok
+}
@@ -3,13 +3,18 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
+	"github.com/contester/advfiler/hashes"
 	pb "github.com/contester/advfiler/protos"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -30,6 +35,14 @@ const (
 	blobOverheadB = 50
 )
 
+// UserMeta values on dirMetaKey entries, telling change subscribers why an
+// entry was written.
+const (
+	entryMetaCreated   byte = 0x00
+	entryMetaReplaced  byte = 0x01
+	entryMetaRewritten byte = 0x02 // storage-layout change only, content unchanged
+)
+
 // dirDataKey returns the key for inline data stored under a directory entry.
 // Format: 0x01 + path + 0x00 + 0x00
 func dirDataKey(path string) []byte {
@@ -110,7 +123,16 @@ type FileInfo struct {
 	Name, ModuleType string
 	ContentLength    int64
 	TimestampUnix    int64
-	RecvDigests      Digests
+	RecvDigests      hashes.Digests
+	Attributes       map[string]string
+}
+
+// trailingDigests is an upload body that learns the client's digests only
+// as it's read, like a gRPC stream whose last message carries them. Upload
+// verifies those instead of FileInfo.RecvDigests once the body has ended.
+type trailingDigests interface {
+	io.Reader
+	RecvDigests() hashes.Digests
 }
 
 // UploadStatus is returned after a successful upload.
@@ -118,6 +140,10 @@ type UploadStatus struct {
 	Digests    map[string]string
 	Size       int64
 	Hardlinked bool
+	// Replaced is set if the path existed, Skipped if it was left alone
+	// under the ConflictPolicy in effect.
+	Replaced bool `json:",omitempty"`
+	Skipped  bool `json:",omitempty"`
 }
 
 // DownloadResult holds data returned from a Download operation.
@@ -125,15 +151,30 @@ type DownloadResult struct {
 	Size                  int64
 	ModuleType            string
 	LastModifiedTimestamp int64
-	Digests               Digests
+	Digests               hashes.Digests
+	Attributes            map[string]string
 	Body                  io.ReadSeeker
 }
 
+// emptyDigests holds the digests of zero-length input, synthesized once.
+// Zero-size files don't store their digests; they're served from here.
+var emptyDigests = hashes.NewHashes().Digests()
+
+// ErrReadOnly is returned by mutating Store methods while the store is
+// read-only (e.g. a replica).
+var ErrReadOnly = errors.New("store is read-only")
+
 // Store is the content-addressable file store backed by a Badger database.
 type Store struct {
-	db       *badger.DB
-	stopChan chan struct{}
-	doneChan chan struct{}
+	db          *badger.DB
+	stopChan    chan struct{}
+	doneChan    chan struct{}
+	readOnly    atomic.Bool
+	maintenance atomic.Bool
+	// loadMu is held exclusively by Restore, which must not run alongside
+	// any other transaction, and shared by everything else.
+	loadMu    sync.RWMutex
+	admission admission
 }
 
 // NewStore creates a new Store using the provided Badger DB and starts a GC goroutine.
@@ -156,11 +197,13 @@ func (s *Store) gcLoop() {
 		case <-s.stopChan:
 			return
 		case <-ticker.C:
+			s.loadMu.RLock()
 			for {
 				if err := s.db.RunValueLogGC(0.5); err != nil {
 					break
 				}
 			}
+			s.loadMu.RUnlock()
 		}
 	}
 }
@@ -171,6 +214,47 @@ func (s *Store) Close() {
 	<-s.doneChan
 }
 
+// SetReadOnly makes mutating methods fail with ErrReadOnly, except for
+// callers whose context was marked by withReplicationWrite.
+func (s *Store) SetReadOnly(v bool) {
+	s.readOnly.Store(v)
+}
+
+type replicationWriteKey struct{}
+
+// withReplicationWrite marks ctx as the replication follower applying
+// changes, which is allowed to write to a read-only store.
+func withReplicationWrite(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicationWriteKey{}, true)
+}
+
+func (s *Store) checkWritable(ctx context.Context) error {
+	if ctx.Value(replicationWriteKey{}) != nil {
+		return nil
+	}
+	if s.readOnly.Load() {
+		return ErrReadOnly
+	}
+	if s.maintenance.Load() {
+		return ErrMaintenance
+	}
+	return nil
+}
+
+// view runs a read-only transaction.
+func (s *Store) view(fn func(tx *badger.Txn) error) error {
+	s.loadMu.RLock()
+	defer s.loadMu.RUnlock()
+	return s.db.View(fn)
+}
+
+// update runs a read-write transaction.
+func (s *Store) update(fn func(tx *badger.Txn) error) error {
+	s.loadMu.RLock()
+	defer s.loadMu.RUnlock()
+	return s.db.Update(fn)
+}
+
 // getProto is a generic helper to read and unmarshal a proto message from a Badger transaction.
 func getProto[T any, PT interface {
 	*T
@@ -200,23 +284,46 @@ func setProto(tx *badger.Txn, key []byte, msg proto.Message) error {
 	return tx.Set(key, b)
 }
 
+// setProtoMeta is setProto with a UserMeta byte attached to the entry.
+func setProtoMeta(tx *badger.Txn, key []byte, msg proto.Message, meta byte) error {
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return tx.SetEntry(badger.NewEntry(key, b).WithMeta(meta))
+}
+
 // shouldExternalize returns true if (numPaths-1)*dataSize > blobOverheadB.
 func shouldExternalize(numPaths int, dataSize int64) bool {
 	return int64(numPaths-1)*dataSize > blobOverheadB
 }
 
 // Upload stores data and metadata for a file using content-addressable storage.
-func (s *Store) Upload(ctx context.Context, info FileInfo, body io.Reader) (UploadStatus, error) {
-	// Buffer the body while hashing it.
-	hashes := NewHashes()
-	data, err := io.ReadAll(io.TeeReader(body, hashes))
+// The body is read within the UploadLimits and must match a positive
+// info.ContentLength. A Precondition attached to ctx is checked against the
+// existing entry, and a ConflictPolicy decides whether it gets replaced.
+func (s *Store) Upload(ctx context.Context, info FileInfo, body io.Reader) (_ UploadStatus, err error) {
+	ctx, span := startSpan(ctx, "Store.Upload", info.Name)
+	defer func() { endSpan(span, err) }()
+	if err := s.checkWritable(ctx); err != nil {
+		return UploadStatus{}, err
+	}
+	if err := validateAttributes(info.Attributes); err != nil {
+		return UploadStatus{}, err
+	}
+	// Buffer the body, then hash it.
+	data, release, err := s.admission.readUpload(ctx, info.Name, info.ContentLength, body)
 	if err != nil {
-		return UploadStatus{}, fmt.Errorf("reading body: %w", err)
+		return UploadStatus{}, err
 	}
-	digests := hashes.Digests()
+	defer release()
+	if t, ok := body.(trailingDigests); ok {
+		info.RecvDigests = t.RecvDigests()
+	}
+	digests := hashData(ctx, data)
 
 	// Verify any client-provided digests (transit corruption check).
-	if err := VerifyDigests(digests, info.RecvDigests); err != nil {
+	if err := hashes.VerifyDigests(digests, info.RecvDigests); err != nil {
 		return UploadStatus{}, err
 	}
 
@@ -228,15 +335,37 @@ func (s *Store) Upload(ctx context.Context, info FileInfo, body io.Reader) (Uplo
 		info.TimestampUnix = time.Now().Unix()
 	}
 
-	var hardlinked bool
+	var hardlinked, replaced, skipped bool
+	// dedup is how the content got stored, for the trace.
+	var dedup string
 
-	err = s.db.Update(func(tx *badger.Txn) error {
+	err = s.tracedUpdate(ctx, func(tx *badger.Txn) error {
 		// Check if this path already exists (overwrite scenario).
 		existing, err := getProto[pb.DirectoryEntry](tx, dirMetaKey(info.Name))
 		if err != nil && err != badger.ErrKeyNotFound {
 			return fmt.Errorf("checking existing entry: %w", err)
 		}
+		if pcErr := checkEntryPrecondition(ctx, existing); pcErr != nil {
+			return pcErr
+		}
+		if existing != nil {
+			skip, cfErr := resolveConflict(ctx, existing, blake3Hash, info.TimestampUnix)
+			if cfErr != nil {
+				return cfErr
+			}
+			if skipped = skip; skipped {
+				return nil
+			}
+			replaced = true
+		}
+		meta := entryMetaCreated
+		var oldBlake3 []byte
 		if err == nil && existing != nil {
+			meta = entryMetaReplaced
+			oldBlake3 = existing.GetBlake3Hash()
+			if len(oldBlake3) == 0 {
+				oldBlake3 = emptyDigests.Blake3
+			}
 			// Path exists: unlink the old hash, delete old inline data if applicable.
 			if existing.HasDigestsAndSize() {
 				if delErr := tx.Delete(dirDataKey(info.Name)); delErr != nil && delErr != badger.ErrKeyNotFound {
@@ -250,6 +379,10 @@ func (s *Store) Upload(ctx context.Context, info FileInfo, body io.Reader) (Uplo
 			}
 		}
 
+		if auErr := recordAudit(ctx, tx, AuditUpload, info.Name, oldBlake3, blake3Hash); auErr != nil {
+			return fmt.Errorf("writing audit record: %w", auErr)
+		}
+
 		// Zero-size files: store a minimal entry with no blake3 hash, no
 		// DigestsAndSize, no inline data, and no HashEntry. Digests are
 		// synthesized on read.
@@ -257,8 +390,10 @@ func (s *Store) Upload(ctx context.Context, info FileInfo, body io.Reader) (Uplo
 			dirEntry := pb.DirectoryEntry_builder{
 				ModuleType:            proto.String(info.ModuleType),
 				LastModifiedTimestamp: proto.Int64(info.TimestampUnix),
+				Attributes:            info.Attributes,
 			}.Build()
-			return setProto(tx, dirMetaKey(info.Name), dirEntry)
+			dedup = "empty"
+			return setProtoMeta(tx, dirMetaKey(info.Name), dirEntry, meta)
 		}
 
 		// Look up HashEntry for this blob.
@@ -273,12 +408,13 @@ func (s *Store) Upload(ctx context.Context, info FileInfo, body io.Reader) (Uplo
 				Blake3Hash:            blake3Hash,
 				ModuleType:            proto.String(info.ModuleType),
 				LastModifiedTimestamp: proto.Int64(info.TimestampUnix),
+				Attributes:            info.Attributes,
 				DigestsAndSize: pb.DigestsAndSize_builder{
 					Digests: digests.ToProto(),
 					Size:    proto.Int64(dataSize),
 				}.Build(),
 			}.Build()
-			if setErr := setProto(tx, dirMetaKey(info.Name), dirEntry); setErr != nil {
+			if setErr := setProtoMeta(tx, dirMetaKey(info.Name), dirEntry, meta); setErr != nil {
 				return fmt.Errorf("writing dir meta: %w", setErr)
 			}
 			if setErr := tx.Set(dirDataKey(info.Name), data); setErr != nil {
@@ -290,6 +426,7 @@ func (s *Store) Upload(ctx context.Context, info FileInfo, body io.Reader) (Uplo
 			if setErr := setProto(tx, blobHashEntryKey(blake3Hash), newHE); setErr != nil {
 				return fmt.Errorf("writing hash entry: %w", setErr)
 			}
+			dedup = "new"
 			return nil
 		}
 
@@ -322,7 +459,7 @@ func (s *Store) Upload(ctx context.Context, info FileInfo, body io.Reader) (Uplo
 						return fmt.Errorf("reading dir entry for %s: %w", existingPath, deErr)
 					}
 					existingDE.ClearDigestsAndSize()
-					if setErr := setProto(tx, dirMetaKey(existingPath), existingDE); setErr != nil {
+					if setErr := setProtoMeta(tx, dirMetaKey(existingPath), existingDE, entryMetaRewritten); setErr != nil {
 						return fmt.Errorf("updating dir entry for %s: %w", existingPath, setErr)
 					}
 					if delErr := tx.Delete(dirDataKey(existingPath)); delErr != nil && delErr != badger.ErrKeyNotFound {
@@ -335,8 +472,9 @@ func (s *Store) Upload(ctx context.Context, info FileInfo, body io.Reader) (Uplo
 					Blake3Hash:            blake3Hash,
 					ModuleType:            proto.String(info.ModuleType),
 					LastModifiedTimestamp: proto.Int64(info.TimestampUnix),
+					Attributes:            info.Attributes,
 				}.Build()
-				if setErr := setProto(tx, dirMetaKey(info.Name), dirEntry); setErr != nil {
+				if setErr := setProtoMeta(tx, dirMetaKey(info.Name), dirEntry, meta); setErr != nil {
 					return fmt.Errorf("writing new external dir entry: %w", setErr)
 				}
 
@@ -348,18 +486,20 @@ func (s *Store) Upload(ctx context.Context, info FileInfo, body io.Reader) (Uplo
 					return fmt.Errorf("writing updated hash entry: %w", setErr)
 				}
 				hardlinked = true
+				dedup = "externalized"
 			} else {
 				// Keep inline, just add path.
 				dirEntry := pb.DirectoryEntry_builder{
 					Blake3Hash:            blake3Hash,
 					ModuleType:            proto.String(info.ModuleType),
 					LastModifiedTimestamp: proto.Int64(info.TimestampUnix),
+					Attributes:            info.Attributes,
 					DigestsAndSize: pb.DigestsAndSize_builder{
 						Digests: digests.ToProto(),
 						Size:    proto.Int64(dataSize),
 					}.Build(),
 				}.Build()
-				if setErr := setProto(tx, dirMetaKey(info.Name), dirEntry); setErr != nil {
+				if setErr := setProtoMeta(tx, dirMetaKey(info.Name), dirEntry, meta); setErr != nil {
 					return fmt.Errorf("writing dir meta (inline dup): %w", setErr)
 				}
 				if setErr := tx.Set(dirDataKey(info.Name), data); setErr != nil {
@@ -371,6 +511,7 @@ func (s *Store) Upload(ctx context.Context, info FileInfo, body io.Reader) (Uplo
 				if setErr := setProto(tx, blobHashEntryKey(blake3Hash), updatedHE); setErr != nil {
 					return fmt.Errorf("writing updated hash entry: %w", setErr)
 				}
+				dedup = "inline-copy"
 			}
 
 		case pb.HashEntry_Refcount_case:
@@ -380,8 +521,9 @@ func (s *Store) Upload(ctx context.Context, info FileInfo, body io.Reader) (Uplo
 				Blake3Hash:            blake3Hash,
 				ModuleType:            proto.String(info.ModuleType),
 				LastModifiedTimestamp: proto.Int64(info.TimestampUnix),
+				Attributes:            info.Attributes,
 			}.Build()
-			if setErr := setProto(tx, dirMetaKey(info.Name), dirEntry); setErr != nil {
+			if setErr := setProtoMeta(tx, dirMetaKey(info.Name), dirEntry, meta); setErr != nil {
 				return fmt.Errorf("writing external dir entry: %w", setErr)
 			}
 			newHE := pb.HashEntry_builder{
@@ -391,6 +533,7 @@ func (s *Store) Upload(ctx context.Context, info FileInfo, body io.Reader) (Uplo
 				return fmt.Errorf("writing updated hash entry (refcount): %w", setErr)
 			}
 			hardlinked = true
+			dedup = "shared"
 		}
 
 		return nil
@@ -399,11 +542,21 @@ func (s *Store) Upload(ctx context.Context, info FileInfo, body io.Reader) (Uplo
 	if err != nil {
 		return UploadStatus{}, err
 	}
+	noteAccess(ctx, digests, hardlinked)
+	span.SetAttributes(
+		attribute.Int64("advfiler.size", dataSize),
+		attribute.String("advfiler.dedup", dedup),
+		attribute.Bool("advfiler.hardlinked", hardlinked),
+		attribute.Bool("advfiler.replaced", replaced),
+		attribute.Bool("advfiler.skipped", skipped),
+	)
 
 	return UploadStatus{
-		Digests:    DigestsToMap(digests),
+		Digests:    hashes.DigestsToMap(digests),
 		Size:       dataSize,
 		Hardlinked: hardlinked,
+		Replaced:   replaced,
+		Skipped:    skipped,
 	}, nil
 }
 
@@ -471,8 +624,16 @@ func unlinkHash(tx *badger.Txn, blake3Hash []byte, path string) error {
 
 // Download retrieves a file by path and calls fn with the result.
 // Returns fs.ErrNotExist if the path is not found.
-func (s *Store) Download(ctx context.Context, path string, fn func(DownloadResult) error) error {
-	return s.db.View(func(tx *badger.Txn) error {
+func (s *Store) Download(ctx context.Context, path string, fn func(DownloadResult) error) (err error) {
+	ctx, span := startSpan(ctx, "Store.Download", path)
+	defer func() { endSpan(span, err) }()
+	read := fn
+	fn = func(dr DownloadResult) error {
+		span.SetAttributes(attribute.Int64("advfiler.size", dr.Size))
+		noteAccess(ctx, dr.Digests, false)
+		return read(dr)
+	}
+	return s.tracedView(ctx, func(tx *badger.Txn) error {
 		de, err := getProto[pb.DirectoryEntry](tx, dirMetaKey(path))
 		if err == badger.ErrKeyNotFound {
 			return fs.ErrNotExist
@@ -484,6 +645,7 @@ func (s *Store) Download(ctx context.Context, path string, fn func(DownloadResul
 		dr := DownloadResult{
 			ModuleType:            de.GetModuleType(),
 			LastModifiedTimestamp: de.GetLastModifiedTimestamp(),
+			Attributes:            de.GetAttributes(),
 		}
 
 		// Zero-size file: no blake3 hash, no data, digests synthesized.
@@ -497,7 +659,8 @@ func (s *Store) Download(ctx context.Context, path string, fn func(DownloadResul
 			// Internal (inline) data: digests and size are in the entry.
 			das := de.GetDigestsAndSize()
 			dr.Size = das.GetSize()
-			dr.Digests = DigestsFromProto(das.GetDigests())
+			dr.Digests = hashes.DigestsFromProto(das.GetDigests())
+			dr.Digests.Blake3 = de.GetBlake3Hash()
 			dataItem, err := tx.Get(dirDataKey(path))
 			if err != nil {
 				return fmt.Errorf("reading inline data: %w", err)
@@ -518,8 +681,9 @@ func (s *Store) Download(ctx context.Context, path string, fn func(DownloadResul
 		}
 		if err == nil {
 			dr.Size = das.GetSize()
-			dr.Digests = DigestsFromProto(das.GetDigests())
+			dr.Digests = hashes.DigestsFromProto(das.GetDigests())
 		}
+		dr.Digests.Blake3 = de.GetBlake3Hash()
 
 		dataItem, err := tx.Get(blobDataKey(de.GetBlake3Hash()))
 		if err != nil {
@@ -537,16 +701,130 @@ func (s *Store) Download(ctx context.Context, path string, fn func(DownloadResul
 	})
 }
 
+// Stat returns the metadata of a file without its content (Body is nil).
+// Returns fs.ErrNotExist if the path is not found.
+func (s *Store) Stat(ctx context.Context, path string) (DownloadResult, error) {
+	var dr DownloadResult
+	err := s.view(func(tx *badger.Txn) error {
+		de, err := getProto[pb.DirectoryEntry](tx, dirMetaKey(path))
+		if err == badger.ErrKeyNotFound {
+			return fs.ErrNotExist
+		}
+		if err != nil {
+			return fmt.Errorf("reading dir entry: %w", err)
+		}
+		dr, err = statEntry(tx, de)
+		return err
+	})
+	return dr, err
+}
+
+// statEntry is Stat for an entry already read within tx.
+func statEntry(tx *badger.Txn, de *pb.DirectoryEntry) (DownloadResult, error) {
+	dr := DownloadResult{
+		ModuleType:            de.GetModuleType(),
+		LastModifiedTimestamp: de.GetLastModifiedTimestamp(),
+		Attributes:            de.GetAttributes(),
+	}
+	switch {
+	case !de.HasBlake3Hash():
+		dr.Digests = emptyDigests
+		return dr, nil
+	case de.HasDigestsAndSize():
+		das := de.GetDigestsAndSize()
+		dr.Size = das.GetSize()
+		dr.Digests = hashes.DigestsFromProto(das.GetDigests())
+	default:
+		das, err := getProto[pb.DigestsAndSize](tx, blobDigestsKey(de.GetBlake3Hash()))
+		if err != nil && err != badger.ErrKeyNotFound {
+			return dr, fmt.Errorf("reading blob digests: %w", err)
+		}
+		dr.Size = das.GetSize()
+		dr.Digests = hashes.DigestsFromProto(das.GetDigests())
+	}
+	dr.Digests.Blake3 = de.GetBlake3Hash()
+	return dr, nil
+}
+
+// ReadBlob retrieves content by its blake3 hash, wherever it is stored, and
+// calls fn with it. Only Size, Digests and Body are set in the result.
+// Returns fs.ErrNotExist if no path references the hash.
+func (s *Store) ReadBlob(ctx context.Context, hash []byte, fn func(DownloadResult) error) error {
+	return s.view(func(tx *badger.Txn) error {
+		he, err := getProto[pb.HashEntry](tx, blobHashEntryKey(hash))
+		if err == badger.ErrKeyNotFound {
+			return fs.ErrNotExist
+		}
+		if err != nil {
+			return fmt.Errorf("reading hash entry: %w", err)
+		}
+
+		var dr DownloadResult
+		var dataKey []byte
+		switch he.WhichState() {
+		case pb.HashEntry_InlinePaths_case:
+			paths := he.GetInlinePaths().GetPaths()
+			if len(paths) == 0 {
+				return fs.ErrNotExist
+			}
+			de, err := getProto[pb.DirectoryEntry](tx, dirMetaKey(paths[0]))
+			if err != nil {
+				return fmt.Errorf("reading dir entry for %s: %w", paths[0], err)
+			}
+			das := de.GetDigestsAndSize()
+			dr.Size = das.GetSize()
+			dr.Digests = hashes.DigestsFromProto(das.GetDigests())
+			dataKey = dirDataKey(paths[0])
+		case pb.HashEntry_Refcount_case:
+			das, err := getProto[pb.DigestsAndSize](tx, blobDigestsKey(hash))
+			if err != nil && err != badger.ErrKeyNotFound {
+				return fmt.Errorf("reading blob digests: %w", err)
+			}
+			if err == nil {
+				dr.Size = das.GetSize()
+				dr.Digests = hashes.DigestsFromProto(das.GetDigests())
+			}
+			dataKey = blobDataKey(hash)
+		default:
+			return fs.ErrNotExist
+		}
+		dr.Digests.Blake3 = hash
+
+		dataItem, err := tx.Get(dataKey)
+		if err != nil {
+			return fmt.Errorf("reading blob data: %w", err)
+		}
+		return dataItem.Value(func(v []byte) error {
+			if dr.Size == 0 {
+				dr.Size = int64(len(v))
+			}
+			buf := make([]byte, len(v))
+			copy(buf, v)
+			dr.Body = bytes.NewReader(buf)
+			return fn(dr)
+		})
+	})
+}
+
 // Delete unlinks the hash and removes all directory entries for a path.
-func (s *Store) Delete(ctx context.Context, path string) error {
-	return s.db.Update(func(tx *badger.Txn) error {
+// A Precondition attached to ctx is checked against the existing entry.
+func (s *Store) Delete(ctx context.Context, path string) (err error) {
+	ctx, span := startSpan(ctx, "Store.Delete", path)
+	defer func() { endSpan(span, err) }()
+	if err := s.checkWritable(ctx); err != nil {
+		return err
+	}
+	return s.tracedUpdate(ctx, func(tx *badger.Txn) error {
 		de, err := getProto[pb.DirectoryEntry](tx, dirMetaKey(path))
 		if err == badger.ErrKeyNotFound {
-			return nil
+			return checkEntryPrecondition(ctx, nil)
 		}
 		if err != nil {
 			return fmt.Errorf("reading dir entry: %w", err)
 		}
+		if err := checkEntryPrecondition(ctx, de); err != nil {
+			return err
+		}
 
 		if de.HasDigestsAndSize() {
 			if delErr := tx.Delete(dirDataKey(path)); delErr != nil && delErr != badger.ErrKeyNotFound {
@@ -564,18 +842,23 @@ func (s *Store) Delete(ctx context.Context, path string) error {
 			return fmt.Errorf("deleting dir meta: %w", delErr)
 		}
 
-		return nil
+		oldBlake3 := de.GetBlake3Hash()
+		if len(oldBlake3) == 0 {
+			oldBlake3 = emptyDigests.Blake3
+		}
+		return recordAudit(ctx, tx, AuditDelete, path, oldBlake3, nil)
 	})
 }
 
 // List returns all paths stored under the given prefix.
-func (s *Store) List(ctx context.Context, prefix string) ([]string, error) {
-	var result []string
+func (s *Store) List(ctx context.Context, prefix string) (result []string, err error) {
+	ctx, span := startSpan(ctx, "Store.List", prefix)
+	defer func() { endSpan(span, err) }()
 
 	// Build the key prefix to scan (0x01 + prefix).
 	scanPrefix := append([]byte{prefixDirEntry}, []byte(prefix)...)
 
-	err := s.db.View(func(tx *badger.Txn) error {
+	err = s.tracedView(ctx, func(tx *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
 		opts.PrefetchValues = false
 		it := tx.NewIterator(opts)
@@ -596,6 +879,38 @@ func (s *Store) List(ctx context.Context, prefix string) ([]string, error) {
 	return result, err
 }
 
+// ListStat calls fn with the path and metadata (as Stat returns it) of every
+// file under the given prefix, in path order.
+func (s *Store) ListStat(ctx context.Context, prefix string, fn func(path string, dr DownloadResult) error) error {
+	scanPrefix := append([]byte{prefixDirEntry}, []byte(prefix)...)
+
+	return s.view(func(tx *badger.Txn) error {
+		it := tx.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(scanPrefix); it.ValidForPrefix(scanPrefix); it.Next() {
+			path, err := extractPathFromDirMetaKey(it.Item().Key())
+			if err != nil {
+				continue
+			}
+			var de pb.DirectoryEntry
+			if err := it.Item().Value(func(v []byte) error {
+				return proto.Unmarshal(v, &de)
+			}); err != nil {
+				return fmt.Errorf("reading dir entry for %s: %w", path, err)
+			}
+			dr, err := statEntry(tx, &de)
+			if err != nil {
+				return err
+			}
+			if err := fn(path, dr); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // Wipe deletes all files in the store.
 func (s *Store) Wipe(ctx context.Context) error {
 	paths, err := s.List(ctx, "")
@@ -613,7 +928,7 @@ func (s *Store) Wipe(ctx context.Context) error {
 // GetManifest retrieves a manifest by key.
 func (s *Store) GetManifest(ctx context.Context, key string) ([]byte, error) {
 	var result []byte
-	err := s.db.View(func(tx *badger.Txn) error {
+	err := s.view(func(tx *badger.Txn) error {
 		item, err := tx.Get(manifestKey(key))
 		if err == badger.ErrKeyNotFound {
 			return fs.ErrNotExist
@@ -632,7 +947,29 @@ func (s *Store) GetManifest(ctx context.Context, key string) ([]byte, error) {
 
 // SetManifest stores a manifest by key.
 func (s *Store) SetManifest(ctx context.Context, key string, value []byte) error {
-	return s.db.Update(func(tx *badger.Txn) error {
+	if err := s.checkWritable(ctx); err != nil {
+		return err
+	}
+	return s.update(func(tx *badger.Txn) error {
+		var oldBlake3 []byte
+		item, err := tx.Get(manifestKey(key))
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
+		}
+		if err == nil {
+			if err := item.Value(func(v []byte) error {
+				oldBlake3 = blake3Sum(v)
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		if err := checkPrecondition(ctx, oldBlake3 != nil, oldBlake3, 0); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, AuditManifest, key, oldBlake3, blake3Sum(value)); err != nil {
+			return err
+		}
 		return tx.Set(manifestKey(key), value)
 	})
 }
@@ -642,7 +979,7 @@ func (s *Store) ListManifests(ctx context.Context, prefix string) ([]string, err
 	var result []string
 	scanPrefix := append([]byte{prefixManifest}, []byte(prefix)...)
 
-	err := s.db.View(func(tx *badger.Txn) error {
+	err := s.view(func(tx *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
 		opts.PrefetchValues = false
 		it := tx.NewIterator(opts)
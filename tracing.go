@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+
+	"github.com/contester/advfiler/hashes"
+	"github.com/dgraph-io/badger/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer goes through the global provider, a no-op until setupTracing.
+var tracer = otel.Tracer("github.com/contester/advfiler")
+
+// Trace exporters.
+const (
+	traceOTLP   = "otlp"
+	traceStdout = "stdout"
+)
+
+// setupTracing installs a tracer provider exporting to kind: "otlp", set up
+// by the standard OTEL_EXPORTER_OTLP_* variables, "stdout", or "" for none.
+// The returned function flushes the spans left and stops it.
+func setupTracing(ctx context.Context, kind string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	var exp sdktrace.SpanExporter
+	var err error
+	switch kind {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case traceOTLP:
+		exp, err = otlptracehttp.New(ctx)
+	case traceStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "advfiler")),
+		resource.WithFromEnv(), resource.WithTelemetrySDK())
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// startSpan starts a child span of ctx for a Store operation on path.
+func startSpan(ctx context.Context, name, path string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attribute.String("advfiler.path", path)))
+}
+
+// endSpan ends span, marking it failed by err. A missing file isn't a
+// failure worth flagging.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracedView is view in a span of its own, commit included.
+func (s *Store) tracedView(ctx context.Context, fn func(tx *badger.Txn) error) (err error) {
+	_, span := tracer.Start(ctx, "badger.View")
+	defer func() { endSpan(span, err) }()
+	return s.view(fn)
+}
+
+// tracedUpdate is update in a span of its own, commit included.
+func (s *Store) tracedUpdate(ctx context.Context, fn func(tx *badger.Txn) error) (err error) {
+	_, span := tracer.Start(ctx, "badger.Update")
+	defer func() { endSpan(span, err) }()
+	return s.update(fn)
+}
+
+// hashData computes the digests of an upload.
+func hashData(ctx context.Context, data []byte) hashes.Digests {
+	_, span := tracer.Start(ctx, "hashes.Compute", trace.WithAttributes(attribute.Int("advfiler.size", len(data))))
+	defer span.End()
+	h := hashes.NewHashes()
+	h.Write(data)
+	return h.Digests()
+}
+
+// withTracing serves each request in a span, continuing the trace of an
+// incoming traceparent header. Spans are named after the mux pattern
+// that matched.
+func withTracing(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+		))
+		defer span.End()
+		sw := &statusWriter{ResponseWriter: w}
+		r = r.WithContext(ctx)
+
+		h.ServeHTTP(sw, r)
+
+		if r.Pattern != "" {
+			span.SetName(r.Method + " " + r.Pattern)
+		}
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", sw.status))
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	s := newTestStore(t)
+	ac := NewAuthChecker([]string{"tok"}, nil, nil)
+	mux := http.NewServeMux()
+	mux.Handle("/fs/", NewFiler(s, ac))
+	srv := httptest.NewServer(withTracing(mux))
+	defer srv.Close()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := authorized(t, http.MethodPut, srv.URL+"/fs/p/a", strings.NewReader("content"))
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, sp := range rec.Ended() {
+		spans[sp.Name()] = sp
+	}
+	server, upload := spans["PUT /fs/"], spans["Store.Upload"]
+	if server == nil || upload == nil || spans["hashes.Compute"] == nil || spans["badger.Update"] == nil {
+		t.Fatalf("spans: %v", spans)
+	}
+	if server.SpanContext().TraceID().String() != traceID || server.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("traceparent not continued: %v", server.SpanContext())
+	}
+	if upload.Parent().SpanID() != server.SpanContext().SpanID() ||
+		spans["badger.Update"].Parent().SpanID() != upload.SpanContext().SpanID() ||
+		spans["hashes.Compute"].Parent().SpanID() != upload.SpanContext().SpanID() {
+		t.Error("Store spans aren't nested under the request")
+	}
+	attrs := attribute.NewSet(upload.Attributes()...)
+	if v, _ := attrs.Value("advfiler.path"); v.AsString() != "p/a" {
+		t.Errorf("path: %v", v)
+	}
+	if v, _ := attrs.Value("advfiler.size"); v.AsInt64() != int64(len("content")) {
+		t.Errorf("size: %v", v)
+	}
+	if v, _ := attrs.Value("advfiler.dedup"); v.AsString() != "new" {
+		t.Errorf("dedup: %v", v)
+	}
+
+	resp, err = http.DefaultClient.Do(authorized(t, http.MethodGet, srv.URL+"/fs/p/missing", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	var found bool
+	for _, sp := range rec.Ended() {
+		if sp.Name() == "Store.Download" {
+			found = true
+			if sp.Status().Code != 0 {
+				t.Errorf("a missing file failed the span: %v", sp.Status())
+			}
+		}
+	}
+	if !found {
+		t.Error("no Store.Download span")
+	}
+}
@@ -0,0 +1,544 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/contester/advfiler/hashes"
+	pb "github.com/contester/advfiler/protos"
+	"github.com/dgraph-io/badger/v4"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+// Resumable uploads, in the style of tus: a client creates a session, sends
+// the data in PATCH requests at increasing offsets, asks for the offset
+// after a dropped connection, and finally stores the data at a path.
+
+// Key prefix for upload sessions. Sessions are local to a store: they aren't
+// replicated or included in backups.
+const prefixUpload byte = 0x09
+
+const (
+	subkeyUploadSession byte = 0x00
+	subkeyUploadChunk   byte = 0x01
+
+	// uploadIDLen is the length of a hex session ID.
+	uploadIDLen = 32
+)
+
+// uploadSessionKey: 0x09 + id + 0x00
+func uploadSessionKey(id string) []byte {
+	k := make([]byte, 0, 1+len(id)+1)
+	k = append(k, prefixUpload)
+	k = append(k, id...)
+	return append(k, subkeyUploadSession)
+}
+
+// uploadChunkPrefix: 0x09 + id + 0x01
+func uploadChunkPrefix(id string) []byte {
+	k := make([]byte, 0, 1+len(id)+1+8)
+	k = append(k, prefixUpload)
+	k = append(k, id...)
+	return append(k, subkeyUploadChunk)
+}
+
+// uploadChunkKey: 0x09 + id + 0x01 + be64(offset), so chunks sort by offset.
+func uploadChunkKey(id string, offset int64) []byte {
+	return binary.BigEndian.AppendUint64(uploadChunkPrefix(id), uint64(offset))
+}
+
+var (
+	errUploadOffset     = errors.New("upload offset doesn't match the session")
+	errUploadTooLarge   = errors.New("upload exceeds its length")
+	errUploadIncomplete = errors.New("upload is incomplete")
+)
+
+// UploadSessionInfo describes an upload session. Length is -1 until known.
+type UploadSessionInfo struct {
+	ID, Owner      string
+	Length, Offset int64
+	Expires        time.Time
+}
+
+func uploadSessionInfo(id string, sess *pb.UploadSession) UploadSessionInfo {
+	info := UploadSessionInfo{
+		ID:      id,
+		Owner:   sess.GetOwner(),
+		Length:  -1,
+		Offset:  sess.GetOffset(),
+		Expires: time.Unix(sess.GetExpiresUnix(), 0),
+	}
+	if sess.HasLength() {
+		info.Length = sess.GetLength()
+	}
+	return info
+}
+
+// getUploadSession reads a session, treating expired ones as gone.
+func getUploadSession(tx *badger.Txn, id string) (*pb.UploadSession, error) {
+	sess, err := getProto[pb.UploadSession](tx, uploadSessionKey(id))
+	if err == badger.ErrKeyNotFound {
+		return nil, fs.ErrNotExist
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading upload session: %w", err)
+	}
+	if time.Now().Unix() >= sess.GetExpiresUnix() {
+		return nil, fs.ErrNotExist
+	}
+	return sess, nil
+}
+
+// CreateUpload starts an upload session for owner. length is the total size
+// if known, or -1.
+func (s *Store) CreateUpload(ctx context.Context, owner string, length int64, expires time.Time) (UploadSessionInfo, error) {
+	if err := s.checkWritable(ctx); err != nil {
+		return UploadSessionInfo{}, err
+	}
+	if err := s.admission.checkSessionSize(length); err != nil {
+		return UploadSessionInfo{}, err
+	}
+	var b [uploadIDLen / 2]byte
+	rand.Read(b[:])
+	id := hex.EncodeToString(b[:])
+	sess := pb.UploadSession_builder{
+		Owner:       proto.String(owner),
+		Offset:      proto.Int64(0),
+		CreatedUnix: proto.Int64(time.Now().Unix()),
+		ExpiresUnix: proto.Int64(expires.Unix()),
+	}.Build()
+	if length >= 0 {
+		sess.SetLength(length)
+	}
+	if err := s.update(func(tx *badger.Txn) error {
+		return setProto(tx, uploadSessionKey(id), sess)
+	}); err != nil {
+		return UploadSessionInfo{}, err
+	}
+	return uploadSessionInfo(id, sess), nil
+}
+
+// GetUpload returns the state of an upload session, or fs.ErrNotExist.
+func (s *Store) GetUpload(ctx context.Context, id string) (UploadSessionInfo, error) {
+	var info UploadSessionInfo
+	err := s.view(func(tx *badger.Txn) error {
+		sess, err := getUploadSession(tx, id)
+		if err != nil {
+			return err
+		}
+		info = uploadSessionInfo(id, sess)
+		return nil
+	})
+	return info, err
+}
+
+// AppendUpload stores data at offset, which must be the session's current
+// offset, and moves the expiry to expires. length sets the total size if
+// the session doesn't have one yet; pass -1 to leave it.
+func (s *Store) AppendUpload(ctx context.Context, id string, offset, length int64, data []byte, expires time.Time) (UploadSessionInfo, error) {
+	if err := s.checkWritable(ctx); err != nil {
+		return UploadSessionInfo{}, err
+	}
+	var info UploadSessionInfo
+	err := s.update(func(tx *badger.Txn) error {
+		sess, err := getUploadSession(tx, id)
+		if err != nil {
+			return err
+		}
+		if offset != sess.GetOffset() {
+			return fmt.Errorf("%w: at %d, got %d", errUploadOffset, sess.GetOffset(), offset)
+		}
+		if length >= 0 {
+			if sess.HasLength() && sess.GetLength() != length {
+				return fmt.Errorf("%w: length is already %d", errUploadOffset, sess.GetLength())
+			}
+			sess.SetLength(length)
+		}
+		end := offset + int64(len(data))
+		if sess.HasLength() && end > sess.GetLength() {
+			return fmt.Errorf("%w: %d > %d", errUploadTooLarge, end, sess.GetLength())
+		}
+		if err := s.admission.checkSessionSize(max(end, sess.GetLength())); err != nil {
+			return err
+		}
+		if len(data) != 0 {
+			if err := tx.Set(uploadChunkKey(id, offset), data); err != nil {
+				return fmt.Errorf("writing upload chunk: %w", err)
+			}
+		}
+		sess.SetOffset(end)
+		sess.SetExpiresUnix(expires.Unix())
+		info = uploadSessionInfo(id, sess)
+		return setProto(tx, uploadSessionKey(id), sess)
+	})
+	return info, err
+}
+
+// FinishUpload stores the session's data through Upload, with the usual
+// dedup and digest verification, and removes the session. The session stays
+// if Upload fails, so the client can retry with different preconditions.
+func (s *Store) FinishUpload(ctx context.Context, id string, fi FileInfo) (UploadStatus, error) {
+	err := s.view(func(tx *badger.Txn) error {
+		sess, err := getUploadSession(tx, id)
+		if err != nil {
+			return err
+		}
+		if sess.HasLength() && sess.GetOffset() != sess.GetLength() {
+			return fmt.Errorf("%w: have %d of %d bytes", errUploadIncomplete, sess.GetOffset(), sess.GetLength())
+		}
+		fi.ContentLength = sess.GetOffset()
+		return nil
+	})
+	if err != nil {
+		return UploadStatus{}, err
+	}
+	// Upload checks the declared length against its limits before reading
+	// any of the chunks.
+	st, err := s.Upload(ctx, fi, &sessionReader{s: s, id: id, size: fi.ContentLength})
+	if err != nil {
+		return UploadStatus{}, err
+	}
+	if err := s.AbortUpload(ctx, id); err != nil {
+		requestLog(ctx).Errorf("removing finished upload %s: %v", id, err)
+	}
+	return st, nil
+}
+
+// sessionReader reads the first size bytes of a session, a chunk per
+// transaction.
+type sessionReader struct {
+	s      *Store
+	id     string
+	offset int64
+	size   int64
+	chunk  []byte
+}
+
+func (r *sessionReader) Read(p []byte) (int, error) {
+	if len(r.chunk) == 0 {
+		if r.offset >= r.size {
+			return 0, io.EOF
+		}
+		if err := r.s.view(func(tx *badger.Txn) error {
+			item, err := tx.Get(uploadChunkKey(r.id, r.offset))
+			if err != nil {
+				return err
+			}
+			r.chunk, err = item.ValueCopy(nil)
+			return err
+		}); err != nil {
+			return 0, fmt.Errorf("reading upload chunk at %d: %w", r.offset, err)
+		}
+		if len(r.chunk) == 0 {
+			return 0, fmt.Errorf("empty upload chunk at %d", r.offset)
+		}
+		r.offset += int64(len(r.chunk))
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+// AbortUpload removes a session and its data.
+func (s *Store) AbortUpload(ctx context.Context, id string) error {
+	return s.update(func(tx *badger.Txn) error {
+		if err := tx.Delete(uploadSessionKey(id)); err != nil {
+			return err
+		}
+		it := tx.NewIterator(badger.IteratorOptions{Prefix: uploadChunkPrefix(id)})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if err := tx.Delete(it.Item().KeyCopy(nil)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ExpireUploads removes the sessions that expired before now and returns
+// how many there were.
+func (s *Store) ExpireUploads(ctx context.Context, now time.Time) (int, error) {
+	var expired []string
+	err := s.view(func(tx *badger.Txn) error {
+		it := tx.NewIterator(badger.IteratorOptions{Prefix: []byte{prefixUpload}})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			k := it.Item().Key()
+			if len(k) != 1+uploadIDLen+1 || k[len(k)-1] != subkeyUploadSession {
+				continue
+			}
+			var sess pb.UploadSession
+			if err := it.Item().Value(func(v []byte) error {
+				return proto.Unmarshal(v, &sess)
+			}); err != nil {
+				return err
+			}
+			if now.Unix() >= sess.GetExpiresUnix() {
+				expired = append(expired, string(k[1:1+uploadIDLen]))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range expired {
+		if err := s.AbortUpload(ctx, id); err != nil {
+			return 0, fmt.Errorf("removing upload %s: %w", id, err)
+		}
+	}
+	return len(expired), nil
+}
+
+const (
+	tusVersion = "1.0.0"
+	// maxUploadChunk bounds the data a single PATCH may carry.
+	maxUploadChunk = 64 << 20
+
+	uploadExpireInterval = 5 * time.Minute
+)
+
+type uploadServer struct {
+	store       *Store
+	authChecker AuthCheck
+	urlPrefix   string
+	ttl         time.Duration
+
+	stopChan chan struct{}
+	doneChan chan struct{}
+}
+
+// NewUploadServer serves resumable uploads under /upload/ and removes
+// sessions that haven't been written to for ttl.
+func NewUploadServer(store *Store, authChecker AuthCheck, ttl time.Duration) *uploadServer {
+	u := &uploadServer{
+		store:       store,
+		authChecker: authChecker,
+		urlPrefix:   "/upload/",
+		ttl:         ttl,
+		stopChan:    make(chan struct{}),
+		doneChan:    make(chan struct{}),
+	}
+	go u.expireLoop()
+	return u
+}
+
+func (u *uploadServer) expireLoop() {
+	defer close(u.doneChan)
+	ticker := time.NewTicker(min(u.ttl, uploadExpireInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-u.stopChan:
+			return
+		case <-ticker.C:
+			n, err := u.store.ExpireUploads(context.Background(), time.Now())
+			if err != nil {
+				log.Errorf("expiring uploads: %v", err)
+			} else if n != 0 {
+				log.Infof("expired %d unfinished uploads", n)
+			}
+		}
+	}
+}
+
+// Close stops the expiry goroutine.
+func (u *uploadServer) Close() {
+	close(u.stopChan)
+	<-u.doneChan
+}
+
+func uploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errUploadOffset), errors.Is(err, errUploadIncomplete):
+		return http.StatusConflict
+	case errors.Is(err, errUploadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	}
+	return storeErrorStatus(err)
+}
+
+func setUploadHeaders(h http.Header, info UploadSessionInfo) {
+	h.Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+	if info.Length >= 0 {
+		h.Set("Upload-Length", strconv.FormatInt(info.Length, 10))
+	}
+	h.Set("Upload-Expires", info.Expires.UTC().Format(http.TimeFormat))
+	h.Set("Cache-Control", "no-store")
+}
+
+// parseLengthHeader reads a non-negative integer header, or -1 if absent.
+func parseLengthHeader(h http.Header, name string) (int64, error) {
+	v := h.Get(name)
+	if v == "" {
+		return -1, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+	return n, nil
+}
+
+func (u *uploadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, err := trimOr(r.URL.Path, u.urlPrefix, "upload url")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", "creation,creation-defer-length,expiration,termination")
+		w.Header().Set("Tus-Max-Chunk-Size", strconv.Itoa(maxUploadChunk))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	token := tokenFromHeader(r)
+	if v, _ := u.authChecker.Check(r.Context(), token, pb.AuthAction_A_WRITE, ""); !v {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	owner := u.authChecker.Identify(token)
+
+	if id == "" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		err = u.handleCreate(w, r, owner)
+	} else {
+		err = u.handleSession(w, r, id, owner)
+	}
+	if err != nil {
+		if status := uploadErrorStatus(err); status != http.StatusInternalServerError {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		requestLog(r.Context()).Errorf("upload %q: %v", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (u *uploadServer) handleCreate(w http.ResponseWriter, r *http.Request, owner string) error {
+	length, err := parseLengthHeader(r.Header, "Upload-Length")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	info, err := u.store.CreateUpload(r.Context(), owner, length, time.Now().Add(u.ttl))
+	if err != nil {
+		return err
+	}
+	setUploadHeaders(w.Header(), info)
+	w.Header().Set("Location", u.urlPrefix+info.ID)
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+func (u *uploadServer) handleSession(w http.ResponseWriter, r *http.Request, id, owner string) error {
+	ctx := r.Context()
+	info, err := u.store.GetUpload(ctx, id)
+	if err != nil {
+		return err
+	}
+	// Someone else's session is none of the caller's business.
+	if info.Owner != owner {
+		return fs.ErrNotExist
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		setUploadHeaders(w.Header(), info)
+		return nil
+
+	case http.MethodPatch:
+		if ct := r.Header.Get("Content-Type"); ct != "application/offset+octet-stream" {
+			http.Error(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+			return nil
+		}
+		offset, err := parseLengthHeader(r.Header, "Upload-Offset")
+		if err == nil && offset < 0 {
+			err = errors.New("missing Upload-Offset")
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil
+		}
+		length, err := parseLengthHeader(r.Header, "Upload-Length")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil
+		}
+		if offset != info.Offset {
+			return fmt.Errorf("%w: at %d, got %d", errUploadOffset, info.Offset, offset)
+		}
+		// Keep whatever arrived before a dropped connection, so the client
+		// can resume from there.
+		data, rerr := io.ReadAll(io.LimitReader(r.Body, maxUploadChunk+1))
+		if len(data) > maxUploadChunk {
+			return fmt.Errorf("%w: chunks are limited to %d bytes", errUploadTooLarge, maxUploadChunk)
+		}
+		info, err = u.store.AppendUpload(ctx, id, offset, length, data, time.Now().Add(u.ttl))
+		if err != nil {
+			return err
+		}
+		if rerr != nil {
+			return rerr
+		}
+		setUploadHeaders(w.Header(), info)
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+
+	case http.MethodPut:
+		path := r.Header.Get("X-Fs-Path")
+		if path == "" || strings.HasSuffix(path, "/") {
+			http.Error(w, "X-Fs-Path must name a file", http.StatusBadRequest)
+			return nil
+		}
+		if v, _ := u.authChecker.Check(ctx, tokenFromHeader(r), pb.AuthAction_A_WRITE, path); !v {
+			return errUnauthorized
+		}
+		fi := FileInfo{
+			Name:        path,
+			ModuleType:  r.Header.Get("X-Fs-Module-Type"),
+			RecvDigests: hashes.ParseDigests(r.Header),
+			Attributes:  attributesFromHeader(r.Header),
+		}
+		maps.DeleteFunc(fi.Attributes, func(_, v string) bool { return v == "" })
+		ctx = WithPrecondition(auditContext(r, u.authChecker, ""), preconditionFromRequest(r))
+		st, err := u.store.FinishUpload(ctx, id, fi)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("ETag", blake3ETag(hashes.DigestsFromMap(st.Digests).Blake3))
+		return json.NewEncoder(w).Encode(&st)
+
+	case http.MethodDelete:
+		if err := u.store.AbortUpload(ctx, id); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	http.Error(w, "", http.StatusMethodNotAllowed)
+	return nil
+}
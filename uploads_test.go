@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/contester/advfiler/client"
+	"github.com/contester/advfiler/hashes"
+)
+
+func TestStoreUploadSessions(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour)
+
+	info, err := s.CreateUpload(ctx, "judge", 10, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AppendUpload(ctx, info.ID, 0, -1, []byte("0123"), expires); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AppendUpload(ctx, info.ID, 0, -1, []byte("0123"), expires); !errors.Is(err, errUploadOffset) {
+		t.Errorf("expected errUploadOffset, got %v", err)
+	}
+	if _, err := s.AppendUpload(ctx, info.ID, 4, -1, []byte("4567890"), expires); !errors.Is(err, errUploadTooLarge) {
+		t.Errorf("expected errUploadTooLarge, got %v", err)
+	}
+	if _, err := s.FinishUpload(ctx, info.ID, FileInfo{Name: "f"}); !errors.Is(err, errUploadIncomplete) {
+		t.Errorf("expected errUploadIncomplete, got %v", err)
+	}
+	if info, err = s.AppendUpload(ctx, info.ID, 4, -1, []byte("456789"), expires); err != nil || info.Offset != 10 {
+		t.Fatalf("append: %+v %v", info, err)
+	}
+
+	// Finishing verifies digests like any other upload.
+	bad := FileInfo{Name: "f", RecvDigests: hashes.Digests{SHA256: make([]byte, 32)}}
+	if _, err := s.FinishUpload(ctx, info.ID, bad); !errors.Is(err, hashes.ErrDigestMismatch) {
+		t.Errorf("expected a digest mismatch, got %v", err)
+	}
+	st, err := s.FinishUpload(ctx, info.ID, FileInfo{Name: "f", ModuleType: "txt"})
+	if err != nil || st.Size != 10 {
+		t.Fatalf("finish: %+v %v", st, err)
+	}
+	if err := s.Download(ctx, "f", func(dr DownloadResult) error {
+		b, _ := io.ReadAll(dr.Body)
+		if string(b) != "0123456789" || dr.ModuleType != "txt" {
+			t.Errorf("downloaded %q %q", b, dr.ModuleType)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetUpload(ctx, info.ID); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("finished session still exists: %v", err)
+	}
+
+	// A session of unknown length takes it later.
+	info, err = s.CreateUpload(ctx, "judge", -1, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err = s.AppendUpload(ctx, info.ID, 0, 3, []byte("abc"), expires); err != nil || info.Length != 3 {
+		t.Fatalf("deferred length: %+v %v", info, err)
+	}
+
+	if n, err := s.ExpireUploads(ctx, time.Now()); err != nil || n != 0 {
+		t.Errorf("expired %d, %v", n, err)
+	}
+	if n, err := s.ExpireUploads(ctx, expires.Add(time.Second)); err != nil || n != 1 {
+		t.Errorf("expired %d, %v", n, err)
+	}
+	if _, err := s.GetUpload(ctx, info.ID); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expired session still exists: %v", err)
+	}
+}
+
+func TestUploadSessionLimits(t *testing.T) {
+	s := newTestStore(t)
+	s.SetUploadLimits(UploadLimits{MaxFileSize: 10, PrefixMaxFileSize: map[string]int64{"big/": 20}})
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour)
+
+	// Sessions may hold the largest file any path takes.
+	if _, err := s.CreateUpload(ctx, "judge", 21, expires); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge for the declared length, got %v", err)
+	}
+	info, err := s.CreateUpload(ctx, "judge", -1, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err = s.AppendUpload(ctx, info.ID, 0, -1, []byte("0123456789"), expires); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AppendUpload(ctx, info.ID, 10, -1, []byte("0123456789a"), expires); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge for the end offset, got %v", err)
+	}
+	if _, err := s.AppendUpload(ctx, info.ID, 10, 21, nil, expires); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge for a deferred length, got %v", err)
+	}
+	if info, err = s.AppendUpload(ctx, info.ID, 10, -1, []byte("abcde"), expires); err != nil {
+		t.Fatal(err)
+	}
+
+	// Finishing applies the limit of the path.
+	if _, err := s.FinishUpload(ctx, info.ID, FileInfo{Name: "small"}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge for the path, got %v", err)
+	}
+	if st, err := s.FinishUpload(ctx, info.ID, FileInfo{Name: "big/f"}); err != nil || st.Size != 15 {
+		t.Errorf("finish: %+v %v", st, err)
+	}
+}
+
+// lostResponses delivers every second PATCH to the server but reports a
+// network error to the client.
+type lostResponses struct {
+	n atomic.Int32
+}
+
+func (l *lostResponses) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(r)
+	if err == nil && r.Method == http.MethodPatch && l.n.Add(1)%2 == 0 {
+		resp.Body.Close()
+		return nil, errors.New("connection reset")
+	}
+	return resp, err
+}
+
+func TestResumableUploadHTTP(t *testing.T) {
+	_, srv := newTestServer(t)
+	ctx := context.Background()
+	c := client.New(srv.URL, "tok")
+	c.HTTPClient = &http.Client{Transport: &lostResponses{}}
+
+	data := strings.Repeat("0123456789", 1000)
+	st, err := c.UploadResumable(ctx, "big/file", strings.NewReader(data), "bin", 3000)
+	if err != nil || st.Size != int64(len(data)) {
+		t.Fatalf("upload: %+v %v", st, err)
+	}
+	fi, err := client.New(srv.URL, "tok").Stat(ctx, "big/file")
+	if err != nil || fi.Size != int64(len(data)) || fi.ModuleType != "bin" {
+		t.Errorf("stat: %+v %v", fi, err)
+	}
+
+	// A connection dropped in the middle of a chunk keeps what arrived.
+	resp, _ := doRequest(t, authorized(t, http.MethodPost, srv.URL+"/upload/", nil), "Upload-Length", "10")
+	loc := resp.Header.Get("Location")
+	if resp.StatusCode != http.StatusCreated || loc == "" {
+		t.Fatalf("create: %s", resp.Status)
+	}
+	u, _ := url.Parse(srv.URL)
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(conn, "PATCH %s HTTP/1.1\r\nHost: %s\r\nAuthorization: Bearer tok\r\n"+
+		"Content-Type: application/offset+octet-stream\r\nUpload-Offset: 0\r\nContent-Length: 10\r\n\r\n0123", loc, u.Host)
+	conn.Close()
+	var offset string
+	for range 100 {
+		resp, _ := doRequest(t, authorized(t, http.MethodHead, srv.URL+loc, nil))
+		if offset = resp.Header.Get("Upload-Offset"); offset == "4" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if offset != "4" {
+		t.Fatalf("offset after a dropped chunk: %q", offset)
+	}
+	if resp, _ := doRequest(t, authorized(t, http.MethodPut, srv.URL+loc, nil), "X-Fs-Path", "short"); resp.StatusCode != http.StatusConflict {
+		t.Errorf("finishing an incomplete upload: %s", resp.Status)
+	}
+	if resp, _ := doRequest(t, authorized(t, http.MethodHead, srv.URL+loc, nil), "Authorization", "Bearer other"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("head with a bad token: %s", resp.Status)
+	}
+	if resp, _ := doRequest(t, authorized(t, http.MethodDelete, srv.URL+loc, nil)); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("delete: %s", resp.Status)
+	}
+	if resp, _ := doRequest(t, authorized(t, http.MethodHead, srv.URL+loc, nil)); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("head after delete: %s", resp.Status)
+	}
+}
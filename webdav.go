@@ -0,0 +1,609 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/contester/advfiler/protos"
+	"golang.org/x/net/webdav"
+)
+
+// The WebDAV tree is the filer tree: a file at a/b/c shows up as c in
+// directory b in directory a. The Store has no directories of its own, so a
+// directory exists while there are files under it. Directories made with
+// MKCOL are remembered in memory until they get files, are removed, or the
+// server restarts.
+
+type davTokenKey struct{}
+
+// davUploadErrKey holds an *error for the Store.Upload error of a PUT.
+type davUploadErrKey struct{}
+
+// davFS adapts Store to webdav.FileSystem. Every method checks the token
+// carried in ctx against AuthCheck for the paths it touches.
+type davFS struct {
+	store       *Store
+	authChecker AuthCheck
+
+	mu   sync.Mutex
+	dirs map[string]bool
+}
+
+// davPath converts a webdav name ("/a/b") to a store path ("a/b").
+func davPath(name string) string {
+	return strings.Trim(name, "/")
+}
+
+func davErr(err error) error {
+	if errors.Is(err, ErrReadOnly) {
+		return fs.ErrPermission
+	}
+	return err
+}
+
+func (d *davFS) check(ctx context.Context, action pb.AuthAction, p string) error {
+	token, _ := ctx.Value(davTokenKey{}).(string)
+	if v, _ := d.authChecker.Check(ctx, token, action, p); !v {
+		return fs.ErrPermission
+	}
+	return nil
+}
+
+func (d *davFS) isDir(ctx context.Context, p string) (bool, error) {
+	if p == "" {
+		return true, nil
+	}
+	d.mu.Lock()
+	made := d.dirs[p]
+	d.mu.Unlock()
+	if made {
+		return true, nil
+	}
+	names, err := d.store.List(ctx, p+"/")
+	return len(names) != 0, err
+}
+
+func (d *davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	p := davPath(name)
+	if err := d.check(ctx, pb.AuthAction_A_WRITE, p); err != nil {
+		return err
+	}
+	if _, err := d.stat(ctx, p); err == nil {
+		return fs.ErrExist
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	d.mu.Lock()
+	d.dirs[p] = true
+	d.mu.Unlock()
+	return nil
+}
+
+func (d *davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	p := davPath(name)
+	if err := d.check(ctx, pb.AuthAction_A_READ, p); err != nil {
+		return nil, err
+	}
+	return d.stat(ctx, p)
+}
+
+func (d *davFS) stat(ctx context.Context, p string) (*davFileInfo, error) {
+	if p != "" {
+		st, err := d.store.Stat(ctx, p)
+		if err == nil {
+			return newDAVFileInfo(p, st), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	dir, err := d.isDir(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if !dir {
+		return nil, fs.ErrNotExist
+	}
+	return &davFileInfo{name: path.Base("/" + p), dir: true}, nil
+}
+
+func (d *davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	p := davPath(name)
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return d.openWrite(ctx, p, flag)
+	}
+	if err := d.check(ctx, pb.AuthAction_A_READ, p); err != nil {
+		return nil, err
+	}
+	fi, err := d.stat(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if fi.dir {
+		return &davDir{fs: d, ctx: ctx, p: p, info: fi}, nil
+	}
+	var data []byte
+	err = d.store.Download(ctx, p, func(result DownloadResult) error {
+		var err error
+		data, err = io.ReadAll(result.Body)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &davReadFile{Reader: bytes.NewReader(data), info: fi}, nil
+}
+
+func (d *davFS) openWrite(ctx context.Context, p string, flag int) (webdav.File, error) {
+	if err := d.check(ctx, pb.AuthAction_A_WRITE, p); err != nil {
+		return nil, err
+	}
+	dir, err := d.isDir(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if dir {
+		return nil, fs.ErrInvalid
+	}
+	f := &davWriteFile{fs: d, ctx: ctx, p: p}
+	// Overwriting keeps the module type and attributes.
+	var kept []byte
+	if flag&os.O_TRUNC != 0 {
+		var st DownloadResult
+		st, err = d.store.Stat(ctx, p)
+		f.moduleType, f.attributes = st.ModuleType, st.Attributes
+	} else {
+		err = d.store.Download(ctx, p, func(result DownloadResult) error {
+			f.moduleType, f.attributes = result.ModuleType, result.Attributes
+			kept, err = io.ReadAll(result.Body)
+			return err
+		})
+	}
+	if errors.Is(err, fs.ErrNotExist) && flag&os.O_CREATE != 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.start(kept)
+	return f, nil
+}
+
+func (d *davFS) RemoveAll(ctx context.Context, name string) error {
+	p := davPath(name)
+	if p == "" {
+		return fs.ErrPermission
+	}
+	if err := d.check(ctx, pb.AuthAction_A_WRITE, p); err != nil {
+		return err
+	}
+	if err := d.store.Delete(ctx, p); err != nil {
+		return davErr(err)
+	}
+	names, err := d.store.List(ctx, p+"/")
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		if err := d.check(ctx, pb.AuthAction_A_WRITE, n); err != nil {
+			return err
+		}
+		if err := d.store.Delete(ctx, n); err != nil {
+			return davErr(err)
+		}
+	}
+	d.mu.Lock()
+	for dir := range d.dirs {
+		if dir == p || strings.HasPrefix(dir, p+"/") {
+			delete(d.dirs, dir)
+		}
+	}
+	d.mu.Unlock()
+	return nil
+}
+
+// Rename copies and then deletes, file by file; it is not atomic.
+func (d *davFS) Rename(ctx context.Context, oldName, newName string) error {
+	from, to := davPath(oldName), davPath(newName)
+	if from == "" || to == "" {
+		return fs.ErrPermission
+	}
+	if err := d.check(ctx, pb.AuthAction_A_WRITE, from); err != nil {
+		return err
+	}
+	if err := d.check(ctx, pb.AuthAction_A_WRITE, to); err != nil {
+		return err
+	}
+	fi, err := d.stat(ctx, from)
+	if err != nil {
+		return err
+	}
+	if !fi.dir {
+		return d.moveFile(ctx, from, to)
+	}
+	names, err := d.store.List(ctx, from+"/")
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		dst := to + strings.TrimPrefix(n, from)
+		if err := d.check(ctx, pb.AuthAction_A_WRITE, n); err != nil {
+			return err
+		}
+		if err := d.check(ctx, pb.AuthAction_A_WRITE, dst); err != nil {
+			return err
+		}
+		if err := d.moveFile(ctx, n, dst); err != nil {
+			return err
+		}
+	}
+	d.mu.Lock()
+	for dir := range d.dirs {
+		if dir == from || strings.HasPrefix(dir, from+"/") {
+			delete(d.dirs, dir)
+			d.dirs[to+strings.TrimPrefix(dir, from)] = true
+		}
+	}
+	d.mu.Unlock()
+	return nil
+}
+
+func (d *davFS) moveFile(ctx context.Context, from, to string) error {
+	// Read the source in full before writing: Upload must not run inside
+	// the Download transaction. The file keeps its modification time.
+	var data []byte
+	fi := FileInfo{Name: to}
+	err := d.store.Download(ctx, from, func(result DownloadResult) error {
+		fi.ModuleType, fi.Attributes = result.ModuleType, result.Attributes
+		fi.TimestampUnix = result.LastModifiedTimestamp
+		var err error
+		data, err = io.ReadAll(result.Body)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	fi.ContentLength = int64(len(data))
+	if _, err := d.store.Upload(ctx, fi, bytes.NewReader(data)); err != nil {
+		return davErr(err)
+	}
+	return davErr(d.store.Delete(ctx, from))
+}
+
+// children lists the entries directly under directory p.
+func (d *davFS) children(ctx context.Context, p string) ([]os.FileInfo, error) {
+	prefix := ""
+	if p != "" {
+		prefix = p + "/"
+	}
+	names, err := d.store.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	seen := make(map[string]bool)
+	var result []os.FileInfo
+	for _, n := range names {
+		rest := strings.TrimPrefix(n, prefix)
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			if dir := rest[:i]; dir != "" && !seen[dir] {
+				seen[dir] = true
+				result = append(result, &davFileInfo{name: dir, dir: true})
+			}
+			continue
+		}
+		if rest == "" || seen[rest] {
+			continue
+		}
+		st, err := d.store.Stat(ctx, n)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		seen[rest] = true
+		result = append(result, newDAVFileInfo(n, st))
+	}
+	d.mu.Lock()
+	for dir := range d.dirs {
+		if parent, name := path.Split(dir); parent == prefix && !seen[name] {
+			seen[name] = true
+			result = append(result, &davFileInfo{name: name, dir: true})
+		}
+	}
+	d.mu.Unlock()
+	return result, nil
+}
+
+type davFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+	blake3  []byte
+}
+
+func newDAVFileInfo(p string, st DownloadResult) *davFileInfo {
+	return &davFileInfo{
+		name:    path.Base(p),
+		size:    st.Size,
+		modTime: time.Unix(st.LastModifiedTimestamp, 0),
+		blake3:  st.Digests.Blake3,
+	}
+}
+
+func (fi *davFileInfo) Name() string       { return fi.name }
+func (fi *davFileInfo) Size() int64        { return fi.size }
+func (fi *davFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *davFileInfo) IsDir() bool        { return fi.dir }
+func (fi *davFileInfo) Sys() any           { return nil }
+
+func (fi *davFileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+// ETag implements webdav.ETager.
+func (fi *davFileInfo) ETag(ctx context.Context) (string, error) {
+	if len(fi.blake3) == 0 {
+		return "", webdav.ErrNotImplemented
+	}
+	return `"` + hex.EncodeToString(fi.blake3) + `"`, nil
+}
+
+// ContentType implements webdav.ContentTyper, so listings don't have to
+// read every file to sniff it.
+func (fi *davFileInfo) ContentType(ctx context.Context) (string, error) {
+	if t := mime.TypeByExtension(path.Ext(fi.name)); t != "" {
+		return t, nil
+	}
+	return "application/octet-stream", nil
+}
+
+var errNotSupported = errors.New("not supported")
+
+type davReadFile struct {
+	*bytes.Reader
+	info *davFileInfo
+}
+
+func (f *davReadFile) Close() error                             { return nil }
+func (f *davReadFile) Stat() (os.FileInfo, error)               { return f.info, nil }
+func (f *davReadFile) Readdir(count int) ([]os.FileInfo, error) { return nil, errNotSupported }
+func (f *davReadFile) Write(p []byte) (int, error)              { return 0, fs.ErrPermission }
+
+type davDir struct {
+	fs      *davFS
+	ctx     context.Context
+	p       string
+	info    *davFileInfo
+	entries []os.FileInfo
+	listed  bool
+}
+
+func (f *davDir) Close() error                                 { return nil }
+func (f *davDir) Stat() (os.FileInfo, error)                   { return f.info, nil }
+func (f *davDir) Read(p []byte) (int, error)                   { return 0, errNotSupported }
+func (f *davDir) Seek(offset int64, whence int) (int64, error) { return 0, errNotSupported }
+func (f *davDir) Write(p []byte) (int, error)                  { return 0, errNotSupported }
+
+func (f *davDir) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.listed {
+		entries, err := f.fs.children(f.ctx, f.p)
+		if err != nil {
+			return nil, err
+		}
+		f.entries, f.listed = entries, true
+	}
+	if count <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(f.entries))
+	entries := f.entries[:n]
+	f.entries = f.entries[n:]
+	return entries, nil
+}
+
+// davWriteFile streams writes into Store.Upload, which runs from open to
+// Close, so the upload limits apply as the data arrives.
+type davWriteFile struct {
+	fs         *davFS
+	ctx        context.Context
+	p          string
+	moduleType string
+	attributes map[string]string
+	pw         *io.PipeWriter
+	size       int64
+	done       chan error
+	closed     bool
+}
+
+// start begins the upload with kept, what stays of the old content.
+func (f *davWriteFile) start(kept []byte) {
+	pr, pw := io.Pipe()
+	f.pw, f.size, f.done = pw, int64(len(kept)), make(chan error, 1)
+	fi := FileInfo{Name: f.p, ModuleType: f.moduleType, Attributes: f.attributes}
+	go func() {
+		_, err := f.fs.store.Upload(f.ctx, fi, io.MultiReader(bytes.NewReader(kept), pr))
+		// Writes after a failed upload get its error instead of blocking.
+		if err != nil {
+			pr.CloseWithError(err)
+		}
+		f.done <- err
+	}()
+}
+
+func (f *davWriteFile) Write(p []byte) (int, error) {
+	n, err := f.pw.Write(p)
+	f.size += int64(n)
+	if err != nil {
+		return n, f.failed(err)
+	}
+	return n, nil
+}
+
+func (f *davWriteFile) Read(p []byte) (int, error)                   { return 0, errNotSupported }
+func (f *davWriteFile) Seek(offset int64, whence int) (int64, error) { return 0, errNotSupported }
+func (f *davWriteFile) Readdir(count int) ([]os.FileInfo, error)     { return nil, errNotSupported }
+
+func (f *davWriteFile) Stat() (os.FileInfo, error) {
+	return &davFileInfo{name: path.Base(f.p), size: f.size, modTime: time.Now()}, nil
+}
+
+func (f *davWriteFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	f.pw.Close()
+	if err := <-f.done; err != nil {
+		return f.failed(err)
+	}
+	f.fs.mu.Lock()
+	for dir := path.Dir(f.p); dir != "."; dir = path.Dir(dir) {
+		delete(f.fs.dirs, dir)
+	}
+	f.fs.mu.Unlock()
+	return nil
+}
+
+// failed records err for the response to the PUT, which the webdav
+// package answers with 405 whatever went wrong.
+func (f *davWriteFile) failed(err error) error {
+	if slot, ok := f.ctx.Value(davUploadErrKey{}).(*error); ok && *slot == nil {
+		*slot = err
+	}
+	return davErr(err)
+}
+
+type davServer struct {
+	store       *Store
+	authChecker AuthCheck
+	urlPrefix   string
+	handler     *webdav.Handler
+}
+
+func NewDAVServer(store *Store, authChecker AuthCheck) *davServer {
+	s := &davServer{
+		store:       store,
+		authChecker: authChecker,
+		urlPrefix:   "/dav/",
+	}
+	s.handler = &webdav.Handler{
+		Prefix:     strings.TrimSuffix(s.urlPrefix, "/"),
+		FileSystem: &davFS{store: store, authChecker: authChecker, dirs: make(map[string]bool)},
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				requestLog(r.Context()).Infof("webdav: %s %s: %v", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+	return s
+}
+
+// davToken takes the token from a bearer Authorization header or, since
+// that's what WebDAV clients can send, from the password of basic auth.
+func davToken(r *http.Request) string {
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	return tokenFromHeader(r)
+}
+
+// davAction is the access a request needs to its own path.
+func davAction(method string) pb.AuthAction {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND", "COPY":
+		return pb.AuthAction_A_READ
+	}
+	return pb.AuthAction_A_WRITE
+}
+
+func (s *davServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := davToken(r)
+	p, err := trimOr(r.URL.Path, s.urlPrefix, "dav url")
+	if err != nil && r.URL.Path+"/" != s.urlPrefix {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	allowed, _ := s.authChecker.Check(r.Context(), token, davAction(r.Method), davPath(p))
+	if dst := r.Header.Get("Destination"); allowed && dst != "" {
+		if u, err := url.Parse(dst); err == nil {
+			dp, _ := strings.CutPrefix(u.Path, s.urlPrefix)
+			allowed, _ = s.authChecker.Check(r.Context(), token, pb.AuthAction_A_WRITE, davPath(dp))
+		}
+	}
+	if !allowed {
+		w.Header().Set("WWW-Authenticate", `Basic realm="advfiler"`)
+		http.Error(w, errUnauthorized.Error(), http.StatusUnauthorized)
+		return
+	}
+	// The webdav package turns Store errors into 403 or 500; maintenance
+	// needs its 503.
+	if davAction(r.Method) == pb.AuthAction_A_WRITE && s.store.InMaintenance() {
+		http.Error(w, ErrMaintenance.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	ctx := WithAuditActor(r.Context(), AuditActor{
+		Identity:   s.authChecker.Identify(token),
+		RemoteAddr: r.RemoteAddr,
+		RequestID:  requestID(r),
+	})
+	ctx = context.WithValue(ctx, davTokenKey{}, token)
+	if r.Method == http.MethodPut {
+		pw := &davPutWriter{ResponseWriter: w}
+		ctx = context.WithValue(ctx, davUploadErrKey{}, &pw.err)
+		w = pw
+	}
+	s.handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// davPutWriter answers a PUT that the webdav package fails with 405 with
+// the status of the Store.Upload error behind it, such as 413.
+type davPutWriter struct {
+	http.ResponseWriter
+	err      error
+	replaced bool
+}
+
+func (w *davPutWriter) WriteHeader(code int) {
+	if code == http.StatusMethodNotAllowed && w.err != nil {
+		w.replaced = true
+		http.Error(w.ResponseWriter, w.err.Error(), storeErrorStatus(w.err))
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *davPutWriter) Write(p []byte) (int, error) {
+	if w.replaced {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *davPutWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
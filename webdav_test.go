@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pb "github.com/contester/advfiler/protos"
+)
+
+// prefixAuth allows reads everywhere and writes only under writable.
+type prefixAuth struct {
+	writable string
+}
+
+func (a prefixAuth) Check(ctx context.Context, token string, action pb.AuthAction, path string) (bool, error) {
+	if token != "tok" {
+		return false, nil
+	}
+	return action == pb.AuthAction_A_READ || strings.HasPrefix(path, a.writable), nil
+}
+
+func (a prefixAuth) Identify(token string) string { return token }
+
+// davRequest returns a request with the given headers that authenticates
+// the way a WebDAV client does, with the token as the basic auth password.
+func davRequest(t *testing.T, method, url, body string, hdr ...string) *http.Request {
+	t.Helper()
+	r := setHeaders(newTestRequest(t, method, url, strings.NewReader(body)), hdr...)
+	r.SetBasicAuth("judge", "tok")
+	return r
+}
+
+func TestWebDAV(t *testing.T) {
+	s := newTestStore(t)
+	srv := httptest.NewServer(NewDAVServer(s, prefixAuth{writable: "w/"}))
+	defer srv.Close()
+
+	if resp, _ := doRequest(t, davRequest(t, http.MethodPut, srv.URL+"/dav/w/a/1.txt", "one")); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("put: %d", resp.StatusCode)
+	}
+	if resp, _ := doRequest(t, davRequest(t, http.MethodPut, srv.URL+"/dav/w/a/b/2.txt", "two")); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("put: %d", resp.StatusCode)
+	}
+	if resp, body := doRequest(t, davRequest(t, http.MethodGet, srv.URL+"/dav/w/a/1.txt", "")); resp.StatusCode != http.StatusOK || body != "one" {
+		t.Errorf("get: %d %q", resp.StatusCode, body)
+	}
+	if resp, _ := doRequest(t, davRequest(t, http.MethodPut, srv.URL+"/dav/ro/x", "x")); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("put outside the writable prefix: %d", resp.StatusCode)
+	}
+
+	resp, body := doRequest(t, davRequest(t, "PROPFIND", srv.URL+"/dav/w/a/", "", "Depth", "1"))
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("propfind: %d", resp.StatusCode)
+	}
+	for _, want := range []string{"/dav/w/a/1.txt", "/dav/w/a/b/", "<D:getcontentlength>3</D:getcontentlength>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("propfind response lacks %s:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "2.txt") {
+		t.Errorf("depth 1 propfind went too deep:\n%s", body)
+	}
+
+	if resp, _ := doRequest(t, davRequest(t, "MKCOL", srv.URL+"/dav/w/empty", "")); resp.StatusCode != http.StatusCreated {
+		t.Errorf("mkcol: %d", resp.StatusCode)
+	}
+	if resp, _ := doRequest(t, davRequest(t, "PROPFIND", srv.URL+"/dav/w/empty", "", "Depth", "0")); resp.StatusCode != http.StatusMultiStatus {
+		t.Errorf("propfind of an empty collection: %d", resp.StatusCode)
+	}
+
+	if resp, _ := doRequest(t, davRequest(t, "COPY", srv.URL+"/dav/w/a/", "", "Destination", srv.URL+"/dav/w/c/")); resp.StatusCode != http.StatusCreated {
+		t.Errorf("copy: %d", resp.StatusCode)
+	}
+	if resp, _ := doRequest(t, davRequest(t, "MOVE", srv.URL+"/dav/w/a/1.txt", "", "Destination", srv.URL+"/dav/w/moved.txt")); resp.StatusCode != http.StatusCreated {
+		t.Errorf("move: %d", resp.StatusCode)
+	}
+	if resp, _ := doRequest(t, davRequest(t, "MOVE", srv.URL+"/dav/w/moved.txt", "", "Destination", srv.URL+"/dav/ro/moved.txt")); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("move outside the writable prefix: %d", resp.StatusCode)
+	}
+	if resp, _ := doRequest(t, davRequest(t, http.MethodDelete, srv.URL+"/dav/w/c/", "")); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("delete: %d", resp.StatusCode)
+	}
+
+	names, err := s.List(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(names, ","); got != "w/a/b/2.txt,w/moved.txt" {
+		t.Errorf("store contents: %s", got)
+	}
+
+	if _, err := s.Upload(context.Background(), FileInfo{Name: "w/old.txt", TimestampUnix: 1700000000}, strings.NewReader("old")); err != nil {
+		t.Fatal(err)
+	}
+	if resp, _ := doRequest(t, davRequest(t, "MOVE", srv.URL+"/dav/w/old.txt", "", "Destination", srv.URL+"/dav/w/old-moved.txt")); resp.StatusCode != http.StatusCreated {
+		t.Errorf("move: %d", resp.StatusCode)
+	}
+	if dr, err := s.Stat(context.Background(), "w/old-moved.txt"); err != nil || dr.LastModifiedTimestamp != 1700000000 {
+		t.Errorf("moved file modified at %d, %v", dr.LastModifiedTimestamp, err)
+	}
+}
+
+func TestWebDAVUploadLimits(t *testing.T) {
+	s := newTestStore(t)
+	s.SetUploadLimits(UploadLimits{MaxFileSize: 10})
+	srv := httptest.NewServer(NewDAVServer(s, prefixAuth{writable: "w/"}))
+	defer srv.Close()
+
+	if resp, _ := doRequest(t, davRequest(t, http.MethodPut, srv.URL+"/dav/w/big", strings.Repeat("x", 11))); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("put over the limit: %d", resp.StatusCode)
+	}
+	if _, err := s.Stat(context.Background(), "w/big"); err == nil {
+		t.Error("file over the limit was stored")
+	}
+	if resp, _ := doRequest(t, davRequest(t, http.MethodPut, srv.URL+"/dav/w/small", strings.Repeat("x", 10))); resp.StatusCode != http.StatusCreated {
+		t.Errorf("put at the limit: %d", resp.StatusCode)
+	}
+}
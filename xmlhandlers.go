@@ -51,10 +51,12 @@ func (x *xmlServer) handleContest(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		ctx := WithPrecondition(auditContext(r, x.authChecker, ""), preconditionFromRequest(r))
 		if err := x.store.SetContest(ctx, key, body, parseTimestampHeader(r)); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), storeErrorStatus(err))
 			return
 		}
+		w.Header().Set("ETag", blake3ETag(blake3Sum(body)))
 
 	case http.MethodGet, http.MethodHead:
 		if v, _ := x.authChecker.Check(ctx, tokenFromHeader(r), pb.AuthAction_A_READ, key); !v {
@@ -71,6 +73,7 @@ func (x *xmlServer) handleContest(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		w.Header().Set("X-Timestamp", strconv.FormatInt(ts, 10))
+		w.Header().Set("ETag", blake3ETag(blake3Sum(content)))
 		http.ServeContent(w, r, "", time.Unix(ts, 0), bytes.NewReader(content))
 
 	default:
@@ -102,10 +105,12 @@ func (x *xmlServer) handleProblem(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		ctx := WithPrecondition(auditContext(r, x.authChecker, ""), preconditionFromRequest(r))
 		if err := x.store.SetProblem(ctx, key, rev, body, parseTimestampHeader(r)); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), storeErrorStatus(err))
 			return
 		}
+		w.Header().Set("ETag", blake3ETag(blake3Sum(body)))
 
 	case http.MethodGet, http.MethodHead:
 		if v, _ := x.authChecker.Check(ctx, tokenFromHeader(r), pb.AuthAction_A_READ, key); !v {
@@ -137,6 +142,7 @@ func (x *xmlServer) handleProblem(w http.ResponseWriter, r *http.Request) {
 		}
 		w.Header().Set("X-Revision", strconv.FormatInt(rev, 10))
 		w.Header().Set("X-Timestamp", strconv.FormatInt(ts, 10))
+		w.Header().Set("ETag", blake3ETag(blake3Sum(content)))
 		http.ServeContent(w, r, "", time.Unix(ts, 0), bytes.NewReader(content))
 
 	default:
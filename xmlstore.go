@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io/fs"
+	"strconv"
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
@@ -53,18 +54,35 @@ func nowIfZero(ts int64) int64 {
 // SetContest stores (or overwrites) a contest's XML and timestamp.
 // ts == 0 means "use the current time".
 func (s *Store) SetContest(ctx context.Context, key string, content []byte, ts int64) error {
+	if err := s.checkWritable(ctx); err != nil {
+		return err
+	}
 	rec := pb.ContestRecord_builder{
 		Content:       content,
 		TimestampUnix: proto.Int64(nowIfZero(ts)),
 	}.Build()
-	return s.db.Update(func(tx *badger.Txn) error {
+	return s.update(func(tx *badger.Txn) error {
+		var oldBlake3 []byte
+		old, err := getProto[pb.ContestRecord](tx, contestRecordKey(key))
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
+		}
+		if err == nil {
+			oldBlake3 = blake3Sum(old.GetContent())
+		}
+		if err := checkPrecondition(ctx, oldBlake3 != nil, oldBlake3, old.GetTimestampUnix()); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, AuditContestXML, key, oldBlake3, blake3Sum(content)); err != nil {
+			return err
+		}
 		return setProto(tx, contestRecordKey(key), rec)
 	})
 }
 
 // GetContest returns a contest's XML and timestamp, or a wrapped fs.ErrNotExist.
 func (s *Store) GetContest(ctx context.Context, key string) (content []byte, ts int64, err error) {
-	err = s.db.View(func(tx *badger.Txn) error {
+	err = s.view(func(tx *badger.Txn) error {
 		rec, gerr := getProto[pb.ContestRecord](tx, contestRecordKey(key))
 		if gerr == badger.ErrKeyNotFound {
 			return fmt.Errorf("%w: contest %s", fs.ErrNotExist, key)
@@ -82,6 +100,9 @@ func (s *Store) GetContest(ctx context.Context, key string) (content []byte, ts
 // SetProblem stores (or overwrites) one revision of a problem.
 // ts == 0 means "use the current time".
 func (s *Store) SetProblem(ctx context.Context, key string, revision int64, content []byte, ts int64) error {
+	if err := s.checkWritable(ctx); err != nil {
+		return err
+	}
 	if revision < 0 {
 		return fmt.Errorf("revision must be non-negative, got %d", revision)
 	}
@@ -90,14 +111,29 @@ func (s *Store) SetProblem(ctx context.Context, key string, revision int64, cont
 		TimestampUnix: proto.Int64(nowIfZero(ts)),
 		Revision:      proto.Int64(revision),
 	}.Build()
-	return s.db.Update(func(tx *badger.Txn) error {
+	return s.update(func(tx *badger.Txn) error {
+		var oldBlake3 []byte
+		old, err := getProto[pb.ProblemRecord](tx, problemRecordKey(key, revision))
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
+		}
+		if err == nil {
+			oldBlake3 = blake3Sum(old.GetContent())
+		}
+		if err := checkPrecondition(ctx, oldBlake3 != nil, oldBlake3, old.GetTimestampUnix()); err != nil {
+			return err
+		}
+		path := key + "/" + strconv.FormatInt(revision, 10)
+		if err := recordAudit(ctx, tx, AuditProblemXML, path, oldBlake3, blake3Sum(content)); err != nil {
+			return err
+		}
 		return setProto(tx, problemRecordKey(key, revision), rec)
 	})
 }
 
 // GetProblem returns a specific revision's XML and timestamp.
 func (s *Store) GetProblem(ctx context.Context, key string, revision int64) (content []byte, ts int64, err error) {
-	err = s.db.View(func(tx *badger.Txn) error {
+	err = s.view(func(tx *badger.Txn) error {
 		rec, gerr := getProto[pb.ProblemRecord](tx, problemRecordKey(key, revision))
 		if gerr == badger.ErrKeyNotFound {
 			return fmt.Errorf("%w: problem %s revision %d", fs.ErrNotExist, key, revision)
@@ -115,7 +151,7 @@ func (s *Store) GetProblem(ctx context.Context, key string, revision int64) (con
 // GetLatestProblem returns the highest-numbered revision of a problem.
 func (s *Store) GetLatestProblem(ctx context.Context, key string) (content []byte, revision int64, ts int64, err error) {
 	prefix := problemRecordPrefix(key)
-	err = s.db.View(func(tx *badger.Txn) error {
+	err = s.view(func(tx *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
 		opts.Reverse = true
 		it := tx.NewIterator(opts)